@@ -15,12 +15,12 @@ if [ -e /.dockerenv ]; then
       ext='.exe'
       export CC=x86_64-w64-mingw32-gcc
       export CXX=x86_64-w64-mingw32-g++
+      GOOS=$os go build -trimpath -tags urfave_cli_no_docs -ldflags="-s -w -linkmode external --extldflags '-static'" -o go-portScan_$os$ext ./cmd/go-portScan.go
     else
+      # linux: syn scan uses AF_PACKET instead of libpcap, pure static without cgo
       ext=''
-      export CC=gcc
-      export CXX=g++
+      CGO_ENABLED=0 GOOS=$os go build -trimpath -tags urfave_cli_no_docs,nopcap -ldflags="-s -w" -o go-portScan_$os$ext ./cmd/go-portScan.go
     fi
-    GOOS=$os go build -trimpath -tags urfave_cli_no_docs -ldflags="-s -w -linkmode external --extldflags '-static'" -o go-portScan_$os$ext ./cmd/go-portScan.go
   done
   # It needs to run on a mac
   # GOOS=darwin go build -trimpath -ldflags="-s -w" -o go-portScan_darwin ./cmd/go-portScan.go
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/diff"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/urfave/cli/v2"
+	"os"
+)
+
+// diffCommand 比较两次扫描的结果, 输出新开放、关闭的端口, 服务变化和新出现、消失的主机
+var diffCommand = &cli.Command{
+	Name:      "diff",
+	Usage:     "compare two scan results (jsonl, csv or hosts), report opened/closed ports, changed services and appeared/disappeared hosts",
+	ArgsUsage: "old-result new-result",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "json",
+			Aliases: []string{"j"},
+			Usage:   "output json",
+		},
+		&cli.BoolFlag{
+			Name:  "exitCode",
+			Usage: "exit with code 1 when there are differences",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return errors.New("diff: need two result files, eg: diff last.json now.json")
+		}
+		oldOps, err := readResults(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		newOps, err := readResults(c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		r := diff.Compare(oldOps, newOps)
+		if c.Bool("json") {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else if err = r.WriteText(os.Stdout); err != nil {
+			return err
+		}
+		if c.Bool("exitCode") && !r.Empty() {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func readResults(file string) ([]port.OpenIpPort, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ops, err := diff.ReadResults(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return ops, nil
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
-	"encoding/csv"
 	"fmt"
 	"github.com/XinRoom/go-portScan/core/host"
+	"github.com/XinRoom/go-portScan/core/output"
 	"github.com/XinRoom/go-portScan/core/port"
 	"github.com/XinRoom/go-portScan/core/port/syn"
 	"github.com/XinRoom/go-portScan/core/port/tcp"
+	"github.com/XinRoom/go-portScan/core/port/udp"
+	"github.com/XinRoom/go-portScan/core/scan"
 	"github.com/XinRoom/go-portScan/util"
 	"github.com/XinRoom/iprange"
 	"github.com/panjf2000/ants/v2"
 	"github.com/urfave/cli/v2"
+	"io"
 	"math/rand"
 	"net"
 	"os"
@@ -18,68 +21,216 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// 每批目标的最大行数
+const targetBatchSize = 65536
+
 var (
 	ipStr       string
 	portStr     string
 	pn          bool
 	pt          bool
 	sT          bool
+	sU          bool
 	rate        int
 	miniRate    int
 	sV          bool
 	timeout     int
 	rateP       int
+	rateDns     int
+	allRecords  bool
 	hostGroup   int
 	iL          string
+	inputFile   string
+	urls        []string
+	uL          string
 	devices     bool
 	nexthop     string
+	backend     string
 	httpx       bool
 	netLive     bool
 	maxOpenPort int
 	oCsv        string
-	oFile       string
+	oXml        string
+	oFiles      []string
 	debug       bool
 	oJson       bool
+	allState    bool
+	retries     int
+	scanType    port.ScanType
+	seed        int64
+	shard       scan.Shard
+	exclude     string
+	excludeFile string
+	excludeRsv  bool
+	scopeFile   string
+	maxTargets  uint64
 )
 
-func parseFlag(c *cli.Context) {
+func parseFlag(c *cli.Context) (err error) {
 	ipStr = c.String("ip")
 	iL = c.String("iL")
+	inputFile = c.String("input")
+	urls = c.StringSlice("url")
+	uL = c.String("uL")
 	portStr = c.String("port")
 	nexthop = c.String("nexthop")
+	backend = c.String("backend")
 	devices = c.Bool("devices")
 	pn = c.Bool("Pn")
 	rateP = c.Int("rateP")
+	rateDns = c.Int("rateDns")
+	allRecords = c.Bool("allRecords")
 	hostGroup = c.Int("hostGroup")
 	pt = c.Bool("PT")
 	rate = c.Int("rate")
 	miniRate = c.Int("miniRate")
 	sT = c.Bool("sT")
+	sU = c.Bool("sU")
 	sV = c.Bool("sV")
 	timeout = c.Int("timeout")
 	httpx = c.Bool("httpx")
 	netLive = c.Bool("netLive")
 	maxOpenPort = c.Int("maxOpenPort")
 	oCsv = c.String("oCsv")
-	oFile = c.String("oFile")
+	oXml = c.String("oX")
+	oFiles = c.StringSlice("oFile")
 	debug = c.Bool("debug")
 	oJson = c.Bool("json")
+	allState = c.Bool("allState")
+	retries = c.Int("retries")
+	seed = c.Int64("seed")
+	exclude = c.String("exclude")
+	excludeFile = c.String("excludeFile")
+	excludeRsv = c.Bool("excludeReserved")
+	scopeFile = c.String("scope")
+	maxTargets = c.Uint64("maxTargets")
+	scanType, err = parseScanType(c)
+	return
+}
+
+// synScanTypes SYN-mode的扫描类型参数
+var synScanTypes = []struct {
+	flag     string
+	scanType port.ScanType
+}{
+	{"sA", port.ScanTypeAck},
+	{"sF", port.ScanTypeFin},
+	{"sN", port.ScanTypeNull},
+	{"sX", port.ScanTypeXmas},
+	{"sW", port.ScanTypeWindow},
+	{"sY", port.ScanTypeSctpInit},
+}
+
+// parseScanType 解析SYN-mode的扫描类型, 只能指定一个, 且不能与-sT、-sU同时使用
+func parseScanType(c *cli.Context) (scanType port.ScanType, err error) {
+	var flags []string
+	for _, t := range synScanTypes {
+		if c.Bool(t.flag) {
+			flags = append(flags, "-"+t.flag)
+			scanType = t.scanType
+		}
+	}
+	switch {
+	case len(flags) > 1:
+		err = fmt.Errorf("%s can not be used together, choose one scan type", strings.Join(flags, " "))
+	case len(flags) == 1 && c.Bool("sT"):
+		err = fmt.Errorf("%s is a SYN-mode scan type, can not be used with -sT", flags[0])
+	case len(flags) == 1 && c.Bool("sU"):
+		err = fmt.Errorf("%s is a SYN-mode scan type, can not be used with -sU, use the T: port prefix to mix TCP ports into a UDP scan", flags[0])
+	}
+	return
+}
+
+// parseTarget 解析一行目标, 域名保留到扫描结果中, 默认使用第一个解析结果, --allRecords时使用所有A和AAAA记录
+func parseTarget(line string) (scan.IpRange, error) {
+	line = strings.Trim(line, "[]") // [ipv6]
+	it, _, err := iprange.NewIter(line)
+	if err == nil {
+		return it, nil
+	}
+	iprecords, _ := net.LookupIP(line)
+	if len(iprecords) == 0 {
+		return nil, fmt.Errorf("%s is not ip/hostname", line)
+	}
+	if !allRecords {
+		iprecords = iprecords[:1]
+	}
+	hostIps := &scan.HostIps{Host: strings.ToLower(strings.TrimSuffix(line, "."))}
+	for _, ip := range iprecords {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		hostIps.Ips = append(hostIps.Ips, ip)
+	}
+	return hostIps, nil
 }
 
 func run(c *cli.Context) error {
 	if c.NumFlags() == 0 {
 		cli.ShowAppHelpAndExit(c, 0)
 	}
-	parseFlag(c)
+	// 恢复扫描
+	resumeFile := c.String("resume")
+	var checkpoint *scan.Checkpoint
+	if resumeFile != "" {
+		var err error
+		if checkpoint, err = scan.LoadCheckpoint(resumeFile); err == nil {
+			if err = applyCheckpoint(c, checkpoint); err != nil {
+				fmt.Fprintf(os.Stderr, "[error] --resume: %s\n", err)
+				os.Exit(-1)
+			}
+		} else if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "[error] --resume: %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	if err := parseFlag(c); err != nil {
+		fmt.Fprintf(os.Stderr, "[error] %s\n", err)
+		os.Exit(-1)
+	}
+	shard = scan.NoShard
+	if c.String("shard") != "" {
+		var err error
+		if shard, err = scan.ParseShard(c.String("shard")); err != nil {
+			fmt.Fprintf(os.Stderr, "[error] --shard: %s\n", err)
+			os.Exit(-1)
+		}
+		if shard.IsSharded() && seed == 0 {
+			fmt.Fprintln(os.Stderr, "[error] --shard need --seed, all shards must use the same seed")
+			os.Exit(-1)
+		}
+	}
 	if c.Bool("nohup") {
 		signal.Ignore(syscall.SIGHUP)
 		signal.Ignore(syscall.SIGTERM)
 	}
-	myLog := util.NewLogger(oFile, true)
+	// 没有格式前缀的-o同时输出日志和结果
+	var logFile string
+	var outputs [][2]string // format, path
+	for _, spec := range oFiles {
+		format, path := output.ParseSpec(spec)
+		if format == "" {
+			if logFile != "" {
+				fmt.Fprintln(os.Stderr, "[error] -o: only one output without format, eg: -o text:out.txt -o csv:out.csv")
+				os.Exit(-1)
+			}
+			logFile = path
+			continue
+		}
+		outputs = append(outputs, [2]string{format, path})
+	}
+	if oCsv != "" {
+		outputs = append(outputs, [2]string{output.FormatCsv, oCsv})
+	}
+	if oXml != "" {
+		outputs = append(outputs, [2]string{output.FormatXml, oXml})
+	}
+	myLog := util.NewLogger(logFile, true)
 	if devices {
 		if r, err := syn.GetAllDevs(); err != nil {
 			myLog.Fatal(err.Error())
@@ -88,46 +239,92 @@ func run(c *cli.Context) error {
 		}
 		os.Exit(0)
 	}
-	if ipStr == "" && iL == "" {
+	urlMode := len(urls) > 0 || uL != ""
+	if ipStr == "" && iL == "" && inputFile == "" && !urlMode {
 		cli.ShowAppHelpAndExit(c, 0)
 	}
+	if inputFile != "" && (ipStr != "" || iL != "" || urlMode || resumeFile != "" || shard.IsSharded() || netLive) {
+		myLog.Fatalln("[error] --input can not be used with --ip, --iL, -u, --uL, --resume, --shard or --netLive")
+	}
+	if urlMode && (ipStr != "" || iL != "" || resumeFile != "" || shard.IsSharded() || netLive) {
+		myLog.Fatalln("[error] -u and --uL can not be used with --ip, --iL, --resume, --shard or --netLive")
+	}
 	if portStr == "-" {
 		portStr = "1-65535"
 	}
-	ipRangeGroup := make([]*iprange.Iter, 0)
-	// ip parse
-	var firstIp net.IP
-	var ips []string
-	if ipStr != "" {
-		ips = strings.Split(ipStr, ",")
+	// 排除的ip, 扫描时跳过
+	var excludeSpecs []string
+	if exclude != "" {
+		excludeSpecs = strings.Split(exclude, ",")
 	}
-	if iL != "" {
-		var err error
-		ips, err = util.GetLines(iL)
+	if excludeFile != "" {
+		lines, err := util.GetLines(excludeFile)
 		if err != nil {
 			myLog.Fatalf("open file failed: %s", err.Error())
 		}
+		excludeSpecs = append(excludeSpecs, lines...)
+	}
+	if excludeRsv {
+		excludeSpecs = append(excludeSpecs, scan.ReservedRanges...)
+	}
+	excludeIps, err := scan.ParseExclude(excludeSpecs)
+	if err != nil {
+		myLog.Fatalf("[error] exclude: %s\n", err)
 	}
-	for _, _ip := range ips {
-		it, startIp, err := iprange.NewIter(_ip)
+	if debug {
+		myLog.Printf("[d] exclude: %d ranges\n", excludeIps.Len())
+	}
+
+	// 授权范围, 范围外的目标拒绝扫描并记录
+	var scope *scan.Scope
+	if scopeFile != "" {
+		if scope, err = scan.LoadScope(scopeFile); err != nil {
+			myLog.Fatalf("[error] scope: %s\n", err)
+		}
+	}
+	var guard *scan.Guard
+	guard = scan.NewGuard(nil, scope, maxTargets, func(ip net.IP, dst uint16) {
+		// 只记录前100个, 结束时输出总数
+		if guard.Refused() > 100 {
+			return
+		}
+		if dst == 0 {
+			myLog.Printf("[!] %s out of scope, refused\n", ip)
+		} else {
+			myLog.Printf("[!] %s out of scope, refused\n", net.JoinHostPort(ip.String(), strconv.Itoa(int(dst))))
+		}
+	})
+
+	// 目标, 逐行读取并按批并发解析域名, 不一次性读入所有目标
+	var targetReader io.Reader
+	var targetSpecs []string // -ip的目标, 保存到进度文件
+	if iL != "" {
+		targetFile, err := os.Open(iL)
 		if err != nil {
-			var iprecords []net.IP
-			iprecords, _ = net.LookupIP(_ip)
-			if len(iprecords) > 0 {
-				_ip = iprecords[0].String()
+			myLog.Fatalf("open file failed: %s", err.Error())
+		}
+		defer targetFile.Close()
+		targetReader = targetFile
+	} else {
+		targetSpecs = strings.Split(ipStr, ",")
+		targetReader = strings.NewReader(strings.Join(targetSpecs, "\n"))
+	}
+	stream := &scan.TargetStream{
+		BatchSize: targetBatchSize,
+		Workers:   rateDns,
+		Parse:     parseTarget,
+		OnError: func(line string, err error) {
+			if line == "" {
+				myLog.Printf("[error] read %s: %s\n", iL, err)
 			} else {
-				myLog.Fatalf("[error] %s is not ip/hostname!\n", _ip)
+				myLog.Printf("[error] %s\n", err)
 			}
-			it, startIp, err = iprange.NewIter(_ip)
-			if err != nil {
-				myLog.Fatalf("[error] %s is not ip!\n", _ip)
-			}
-		}
-		if firstIp == nil {
-			firstIp = startIp
-		}
-		ipRangeGroup = append(ipRangeGroup, it)
+		},
+	}
+	if checkpoint != nil {
+		stream.Skip = checkpoint.Batch
 	}
+	batches := stream.Run(targetReader)
 
 	// netLive
 	var wgIpsLive sync.WaitGroup
@@ -145,30 +342,59 @@ func run(c *cli.Context) error {
 	defer poolIpsLive.Release()
 
 	if netLive {
-		// 按c段探测
-		for _, ir := range ipRangeGroup { // ip group
-			for i := uint64(0); i < ir.TotalNum(); i = i + 256 { // ip index
-				ip := make(net.IP, len(ir.GetIpByIndex(0)))
-				copy(ip, ir.GetIpByIndex(i)) // Note: dup copy []byte when concurrent (GetIpByIndex not to do dup copy)
-				ipLastByte := []byte{1, 2, 254, 253, byte(100 + rand.Intn(20)), byte(200 + rand.Intn(20))}
-				ips2 := make([]net.IP, 6)
-				for j := 0; j < 6; j++ {
-					ips2[j] = make(net.IP, len(ip))
-					ip[3] = ipLastByte[j]
-					copy(ips2[j], ip)
+		// 按c段探测, ipv6按/120
+		for batch := range batches {
+			for _, ir := range batch.Ranges { // ip group
+				for i := uint64(0); i < ir.TotalNum(); i = i + 256 { // ip index
+					ip := make(net.IP, len(ir.GetIpByIndex(0)))
+					copy(ip, ir.GetIpByIndex(i)) // Note: dup copy []byte when concurrent (GetIpByIndex not to do dup copy)
+					ipLastByte := []byte{1, 2, 254, 253, byte(100 + rand.Intn(20)), byte(200 + rand.Intn(20))}
+					ips2 := make([]net.IP, 0, 6)
+					for j := 0; j < 6; j++ {
+						ip[len(ip)-1] = ipLastByte[j]
+						if excludeIps.Contains(ip) || !guard.AllowIp(ip) {
+							continue
+						}
+						ip2 := make(net.IP, len(ip))
+						copy(ip2, ip)
+						ips2 = append(ips2, ip2)
+					}
+					if len(ips2) == 0 {
+						continue
+					}
+					wgIpsLive.Add(1)
+					poolIpsLive.Invoke(ips2)
 				}
-				wgIpsLive.Add(1)
-				poolIpsLive.Invoke(ips2)
 			}
 		}
 		wgIpsLive.Wait()
 		return nil
 	}
 
-	// port parse
-	ports, err := port.ShuffleParseAndMergeTopPorts(portStr)
+	// port parse, 没有协议前缀的端口: UDP-mode为UDP, SCTP INIT扫描为SCTP, 其它为TCP
+	defaultProtocol := port.ProtocolTcp
+	if sU {
+		defaultProtocol = port.ProtocolUdp
+	} else if scanType == port.ScanTypeSctpInit && !sT {
+		defaultProtocol = port.ProtocolSctp
+	}
+	if !c.IsSet("port") {
+		portStr = port.DefaultTopPorts(defaultProtocol) // UDP和SCTP的排序表不足1000个端口
+	}
+	ports, err := port.ParsePortList(portStr, defaultProtocol)
 	if err != nil {
-		myLog.Fatalf("[error] %s is not port!\n", err)
+		myLog.Fatalf("[error] port: %s\n", err)
+	}
+	// 有多个协议的端口时混合扫描, 第一个协议的扫描器为主扫描器
+	protocols := ports.Protocols()
+	if len(ports.Sctp) > 0 {
+		if len(protocols) > 1 {
+			myLog.Fatalln("[error] port: SCTP ports can not be mixed with TCP or UDP ports")
+		}
+		if sT {
+			myLog.Fatalln("[error] port: SCTP ports need SYN-mode")
+		}
+		scanType = port.ScanTypeSctpInit
 	}
 
 	// recv
@@ -176,28 +402,63 @@ func run(c *cli.Context) error {
 	retChan := make(chan port.OpenIpPort, 5000)
 
 	// ip port num status
-	ipPortNumMap := make(map[string]int) // 记录该IP端口开放数量
+	ipPortNumMap := make(map[string]int) // 记录当前窗口内IP的端口开放数量, 窗口结束后删除
 	var ipPortNumRW sync.RWMutex
 
-	// csv output
-	var csvFile *os.File
-	var csvWrite *csv.Writer
-	if oCsv != "" {
-		csvFile, err = os.Create(oCsv)
+	// 结果输出, 恢复扫描时追加到原结果
+	var sinks output.Multi
+	var sinksMu sync.Mutex // 再次Ctrl+C退出时关闭输出, 写入nmap xml等缓存的结果
+	info := output.ScanInfo{Args: strings.Join(os.Args, " "), TcpType: scanType.String(), Ports: ports}
+	if sT || inputFile != "" || urlMode {
+		info.TcpType = "connect"
+	}
+	if inputFile != "" || urlMode {
+		info.Ports = port.PortList{} // 没有扫描端口
+	}
+	// 主机汇总的发现方式
+	var liveMethods sync.Map // ip -> 存活探测方式
+	info.Discovery = func(ip net.IP) string {
+		switch {
+		case inputFile != "":
+			return "input"
+		case urlMode:
+			return "url"
+		}
+		if method, ok := liveMethods.Load(ip.String()); ok {
+			return method.(string)
+		}
+		return ""
+	}
+	// 扫描的IP数和存活的IP数, 用于nmap xml的runstats
+	var ipTotal, ipLive uint64 // atomic
+	if inputFile == "" && !urlMode {
+		info.HostCount = func() (total, live int) {
+			if pn {
+				return int(atomic.LoadUint64(&ipTotal)), -1
+			}
+			return int(atomic.LoadUint64(&ipTotal)), int(atomic.LoadUint64(&ipLive))
+		}
+	}
+	for _, o := range outputs {
+		sink, err := output.New(o[0], o[1], output.Option{Append: checkpoint != nil, Shard: shard.IsSharded(), Info: info})
 		if err != nil {
 			myLog.Fatalln("[-]", err)
 		}
-		defer csvFile.Close()
-		csvWrite = csv.NewWriter(csvFile)
-		csvWrite.Write([]string{"IP", "PORT", "SERVICE", "BANNER", "HTTP_TITLE", "HTTP_STATUS", "HTTP_SERVER", "HTTP_TLS", "HTTP_URL", "HTTP_FINGERS"})
+		sinks = append(sinks, sink)
+	}
+	if err = sinks.Open(); err != nil {
+		myLog.Fatalln("[-]", err)
 	}
 
 	go func() {
 		for ret := range retChan {
-			if maxOpenPort > 0 {
+			if shard.IsSharded() {
+				ret.Shard = shard.String()
+			}
+			if maxOpenPort > 0 && ret.IsOpen() {
 				ipPortNumRW.Lock()
-				if _, ok := ipPortNumMap[ret.Ip.String()]; ok {
-					ipPortNumMap[ret.Ip.String()] += 1
+				if num, ok := ipPortNumMap[ret.Ip.String()]; ok { // 已结束窗口的迟到响应不再记录
+					ipPortNumMap[ret.Ip.String()] = num + 1
 				}
 				ipPortNumRW.Unlock()
 			}
@@ -206,25 +467,70 @@ func run(c *cli.Context) error {
 			} else {
 				myLog.Println(ret.String())
 			}
-			if csvWrite != nil {
-				line := []string{ret.Ip.String(), strconv.Itoa(int(ret.Port)), ret.Service, "", "", "", "", "", "", ""}
-				line[3] = strings.NewReplacer("\\r", "\r", "\\n", "\n").Replace(strings.Trim(strconv.Quote(string(ret.Banner)), "\""))
-				if ret.HttpInfo != nil {
-					line[4] = ret.HttpInfo.Title
-					line[5] = strconv.Itoa(ret.HttpInfo.StatusCode)
-					line[6] = ret.HttpInfo.Server
-					line[7] = ret.HttpInfo.TlsCN
-					line[8] = ret.HttpInfo.Url
-					line[9] = strings.Join(ret.HttpInfo.Fingers, ",")
-				}
-				csvWrite.Write(line)
-				csvWrite.Flush()
-				csvFile.Sync()
+			sinksMu.Lock()
+			if err := sinks.Write(ret); err != nil {
+				myLog.Printf("[error] output: %s\n", err)
 			}
+			sinksMu.Unlock()
 		}
+		sinksMu.Lock()
+		if err := sinks.Close(); err != nil {
+			myLog.Printf("[error] output: %s\n", err)
+		}
+		sinksMu.Unlock()
 		single <- struct{}{}
 	}()
 
+	// 指纹识别模式, 只对已知的开放端口进行服务识别和Http探测
+	if inputFile != "" {
+		startTime := time.Now()
+		if err = identifyInput(inputFile, retChan, excludeIps, guard, myLog); err != nil {
+			myLog.Printf("[error] --input: %s\n", err)
+		}
+		<-single // 接收器-收
+		if guard.Refused() > 0 {
+			myLog.Printf("[!] %d targets out of scope were refused\n", guard.Refused())
+		}
+		myLog.Printf("[*] elapsed time: %s\n", time.Since(startTime))
+		return nil
+	}
+
+	// url模式, 只对url进行Http探测
+	if urlMode {
+		startTime := time.Now()
+		var urlReader io.Reader = strings.NewReader(strings.Join(urls, "\n"))
+		if uL != "" {
+			urlFile, err := os.Open(uL)
+			if err != nil {
+				myLog.Fatalf("open file failed: %s", err.Error())
+			}
+			defer urlFile.Close()
+			urlReader = io.MultiReader(urlReader, strings.NewReader("\n"), urlFile)
+		}
+		if err = probeUrls(urlReader, retChan, excludeIps, guard, myLog); err != nil {
+			myLog.Printf("[error] read %s: %s\n", uL, err)
+		}
+		<-single // 接收器-收
+		if guard.Refused() > 0 {
+			myLog.Printf("[!] %d targets out of scope were refused\n", guard.Refused())
+		}
+		myLog.Printf("[*] elapsed time: %s\n", time.Since(startTime))
+		return nil
+	}
+
+	// 第一批目标, 用于选择SYN-mode的路由
+	var firstBatch *scan.TargetBatch
+	for batch := range batches {
+		if len(batch.Ranges) > 0 {
+			firstBatch = batch
+			break
+		}
+	}
+	if firstBatch == nil {
+		myLog.Fatalln("[error] no valid target")
+	}
+	firstIp := firstBatch.Ranges[0].GetIpByIndex(0)
+
 	// Initialize the Scanner
 	var s port.Scanner
 	option := port.ScannerOption{
@@ -232,22 +538,37 @@ func run(c *cli.Context) error {
 		MiniRate: miniRate,
 		Timeout:  timeout,
 		NextHop:  nexthop,
+		Backend:  backend,
+		Retries:  retries,
+		AllState: allState,
+		ScanType: scanType,
 		Debug:    debug,
 	}
 	ipOption := port.IpOption{
 		FingerPrint: sV,
 		Httpx:       httpx,
 	}
-	if sT {
-		// tcp
-		if option.Rate == -1 {
-			option.Rate = tcp.DefaultTcpOption.Rate
-		}
-		if option.Timeout == -1 {
-			option.Timeout = tcp.DefaultTcpOption.Timeout
+	// 新建协议对应的扫描器, option中未设置的速率和超时使用该扫描器的默认值
+	newScanner := func(protocol string, option *port.ScannerOption, retChan chan port.OpenIpPort) (port.Scanner, error) {
+		if protocol == port.ProtocolUdp {
+			// udp
+			if option.Rate == -1 {
+				option.Rate = udp.DefaultUdpOption.Rate
+			}
+			if option.Timeout == -1 {
+				option.Timeout = udp.DefaultUdpOption.Timeout
+			}
+			return udp.NewUdpScanner(retChan, *option)
+		} else if sT {
+			// tcp
+			if option.Rate == -1 {
+				option.Rate = tcp.DefaultTcpOption.Rate
+			}
+			if option.Timeout == -1 {
+				option.Timeout = tcp.DefaultTcpOption.Timeout
+			}
+			return tcp.NewTcpScanner(retChan, *option)
 		}
-		s, err = tcp.NewTcpScanner(retChan, option)
-	} else {
 		// syn
 		if option.Rate == -1 {
 			option.Rate = syn.DefaultSynOption.Rate
@@ -255,87 +576,340 @@ func run(c *cli.Context) error {
 		if option.Timeout == -1 {
 			option.Timeout = syn.DefaultSynOption.Timeout
 		}
-		s, err = syn.NewSynScanner(firstIp, retChan, option)
+		return syn.NewSynScanner(firstIp, retChan, *option)
+	}
+	secondaryOption := option
+	s, err = newScanner(protocols[0], &option, retChan)
+	if err == nil && len(protocols) > 1 {
+		// TCP和UDP混合扫描
+		mux := scan.NewMux(protocols[0], s)
+		for _, protocol := range protocols[1:] {
+			var s2 port.Scanner
+			_option := secondaryOption
+			ret := make(chan port.OpenIpPort, 5000)
+			if s2, err = newScanner(protocol, &_option, ret); err != nil {
+				break
+			}
+			mux.Add(protocol, s2, ret, retChan)
+		}
+		s = mux
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[error] Initialize Scanner: %s\n", err)
 		os.Exit(-1)
 	}
+	guard.Scanner = s
+	s = guard
+
+	startTime := time.Now()
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if debug {
+		myLog.Printf("[d] seed: %d, shard: %s\n", seed, shard)
+	}
+
+	// 定期及中断时保存进度
+	var r *resumer
+	var interrupted int32
+	if resumeFile != "" {
+		cp := &scan.Checkpoint{
+			Targets: targetSpecs,
+			Ports:   portStr,
+			Seed:    seed,
+			Flags:   checkpointFlags(c),
+		}
+		if shard.IsSharded() {
+			cp.Shard = shard.String()
+		}
+		r = &resumer{file: resumeFile, scanner: s, cp: cp}
+		if checkpoint != nil {
+			myLog.Printf("[*] resume from %s, saved at %s\n", resumeFile, checkpoint.Time.Format(time.RFC3339))
+			// 开始扫描前保留原进度
+			cp.Batch, cp.Window, cp.Scanning, cp.LiveIps, cp.Index, cp.Pending = checkpoint.Batch, checkpoint.Window, checkpoint.Scanning, checkpoint.LiveIps, checkpoint.Index, checkpoint.Pending
+			r.pos = scanPos{batch: checkpoint.Batch, window: checkpoint.Window, scanning: checkpoint.Scanning, liveIps: checkpoint.LiveIps, index: checkpoint.Index}
+			r.index, r.last, r.resent = checkpoint.Index, r.pos, checkpoint.Pending
+		}
+		if err = cp.Save(resumeFile); err != nil {
+			myLog.Fatalf("[error] --resume: %s\n", err)
+		}
+		r.start()
+		sigChan := make(chan os.Signal, 2)
+		signal.Notify(sigChan, os.Interrupt)
+		if !c.Bool("nohup") {
+			signal.Notify(sigChan, syscall.SIGTERM)
+		}
+		go func() {
+			<-sigChan
+			atomic.StoreInt32(&interrupted, 1)
+			myLog.Println("[*] interrupted, waiting for in-flight probes, press Ctrl+C again to exit now")
+			<-sigChan
+			r.close()
+			if err := r.saveLast(); err != nil {
+				myLog.Printf("[error] save %s: %s\n", resumeFile, err)
+			}
+			myLog.Printf("[*] progress saved, continue with --resume %s\n", resumeFile)
+			sinksMu.Lock()
+			sinks.Close()
+			os.Exit(1)
+		}()
+	}
 
-	start := time.Now()
-	var wgPing sync.WaitGroup
+	// ping一组ip, 返回存活的ip, 保持原顺序
+	pingIps := func(ips scan.IpList) (liveIps scan.IpList) {
+		live := make([]bool, len(ips))
+		var wgPing sync.WaitGroup
+		poolPing, _ := ants.NewPoolWithFunc(rateP, func(i interface{}) {
+			defer wgPing.Done()
+			ip := ips[i.(int)]
+			if method := host.LiveMethod(ip.String(), pt, time.Duration(option.Timeout)*time.Millisecond); method != "" {
+				liveMethods.Store(ip.String(), method)
+				live[i.(int)] = true
+			}
+		})
+		defer poolPing.Release()
+		for i := range ips {
+			if atomic.LoadInt32(&interrupted) == 1 {
+				break
+			}
+			wgPing.Add(1)
+			_ = poolPing.Invoke(i)
+		}
+		wgPing.Wait() // PING组
+		for i, ip := range ips {
+			if live[i] {
+				liveIps = append(liveIps, ip)
+			}
+		}
+		return
+	}
+
+	// 扫描一批目标, 返回当前窗口的下一个置换序号
+	// 按置换顺序将ip分为--hostGroup个一组的窗口, ping下一个窗口的同时按(ip, port)置换顺序扫描当前窗口的存活ip
+	var ipNum uint64 // 已扫描批次的ip数
+	scanBatch := func(batch *scan.TargetBatch) (index uint64) {
+		// 解析到相同ip的域名合并扫描, 开放端口按各域名探测(Http Host头和TLS SNI)
+		ranges, hosts := scan.MergeHosts(batch.Ranges)
+		targetOption := func(ip net.IP) port.IpOption {
+			_ipOption := ipOption
+			_ipOption.Hosts = hosts.Get(ip)
+			return _ipOption
+		}
+		allIps, err := scan.NewIpRanges(ranges...)
+		if err != nil {
+			myLog.Printf("[error] %s\n", err)
+			atomic.StoreInt32(&interrupted, 1)
+			return
+		}
+		ipNum += allIps.TotalNum()
+		if err = guard.CheckTotal(ipNum, uint64(ports.Len())); err != nil {
+			myLog.Printf("[error] %s, check the targets or use --maxTargets to raise the limit\n", err)
+			atomic.StoreInt32(&interrupted, 1)
+			return
+		}
+		// 各批使用不同的置换, 扫描顺序只在批内(窗口内)随机, 批次和窗口按顺序扫描
+		batchSeed := seed + int64(batch.Index)
+		resumeBatch := checkpoint != nil && checkpoint.Batch == batch.Index
+		var firstWindow uint64
+		if resumeBatch {
+			firstWindow = checkpoint.Window
+		}
+		if r != nil {
+			r.startBatch(batch.Index, firstWindow)
+		}
+
+		// 分片时按ip分片ping, 本分片的存活ip扫描所有端口; --Pn时按(ip, port)置换序号分片
+		ipShard, scanShard := shard, scan.NoShard
+		if pn {
+			ipShard, scanShard = scan.NoShard, shard
+		}
+		windows := scan.NewIpWindows(allIps, batchSeed, ipShard, uint64(hostGroup))
+		skipIp := func(ip net.IP) bool {
+			return excludeIps.Contains(ip) || !guard.AllowIp(ip)
+		}
 
-	// port scan func
-	portScan := func(ip net.IP) {
-		var ipPortNum int
-		var ipPortNumOk bool
-		if maxOpenPort > 0 {
-			ipPortNumRW.Lock()
-			ipPortNumMap[ip.String()] = 0
-			ipPortNumRW.Unlock()
+		// ping各窗口, 当前窗口扫描时ping下一个窗口
+		type ipWindow struct {
+			index   uint64
+			ips     scan.IpList
+			resumed bool // 恢复扫描中断时的窗口
 		}
-		for _, _port := range ports { // port
-			s.WaitLimiter() // limit rate
+		windowChan := make(chan ipWindow)
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			defer close(windowChan)
+			for k := firstWindow; k < windows.Count(); k++ {
+				if atomic.LoadInt32(&interrupted) == 1 {
+					return
+				}
+				w := ipWindow{index: k, resumed: k == firstWindow && resumeBatch && checkpoint.Scanning}
+				if w.resumed && !pn {
+					// 使用保存的存活ip, 不再ping
+					w.ips = scan.IpList(parseTargets(checkpoint.LiveIps))
+					atomic.AddUint64(&ipTotal, w.ips.TotalNum())
+					atomic.AddUint64(&ipLive, w.ips.TotalNum())
+				} else {
+					w.ips = windows.Get(k, skipIp)
+					atomic.AddUint64(&ipTotal, w.ips.TotalNum())
+					if !pn {
+						w.ips = pingIps(w.ips)
+						atomic.AddUint64(&ipLive, w.ips.TotalNum())
+					}
+				}
+				if atomic.LoadInt32(&interrupted) == 1 {
+					return // 中断时窗口未ping完成, 恢复时重新ping
+				}
+				select {
+				case windowChan <- w:
+				case <-stop:
+					return
+				}
+			}
+		}()
 
+		// 重新扫描中断时未完成的探测
+		rescanned := make(map[scan.Target]bool) // 已重新扫描的未完成探测, 扫描时跳过
+		var resent []scan.Target
+		if resumeBatch {
+			resent = checkpoint.Pending
+			// 同一ip端口的各域名合并扫描
+			var pending []scan.Target
+			pendingHosts := make(map[scan.Target][]string)
+			for _, t := range checkpoint.Pending {
+				key := scan.Target{Ip: t.Ip, Port: t.Port, Protocol: t.Protocol}
+				if key.Protocol == "" {
+					key.Protocol = port.ProtocolTcp
+				}
+				if _, ok := pendingHosts[key]; !ok {
+					pending = append(pending, key)
+				}
+				pendingHosts[key] = append(pendingHosts[key], t.Host)
+			}
+			for _, t := range pending {
+				if ip := parseTargets([]string{t.Ip}); len(ip) == 1 && !excludeIps.Contains(ip[0]) {
+					_ipOption := ipOption
+					_ipOption.Protocol = t.Protocol
+					for _, host := range pendingHosts[t] {
+						if host != "" {
+							_ipOption.Hosts = append(_ipOption.Hosts, host)
+						}
+					}
+					s.WaitLimiter()
+					s.Scan(ip[0], t.Port, _ipOption)
+					rescanned[scan.Target{Ip: ip[0].String(), Port: t.Port, Protocol: t.Protocol}] = true
+				}
+			}
+		}
+
+		// 按(ip, port)置换顺序扫描各窗口
+		for w := range windowChan {
+			start := scanShard.Start()
+			if w.resumed {
+				start = checkpoint.Index
+			}
+			index = start
+			if r != nil {
+				var liveIps []string
+				if !pn {
+					for _, ip := range w.ips {
+						liveIps = append(liveIps, ip.String())
+					}
+				}
+				r.scanning(w.index, liveIps, start, resent)
+				resent = nil
+			}
+			if len(w.ips) == 0 {
+				continue
+			}
+			targets, err := scan.NewTargets(w.ips, ports, scan.WindowSeed(seed, batch.Index, w.index))
+			if err != nil {
+				myLog.Printf("[error] %s\n", err)
+				atomic.StoreInt32(&interrupted, 1)
+				return
+			}
 			if maxOpenPort > 0 {
-				ipPortNumRW.RLock()
-				ipPortNum, ipPortNumOk = ipPortNumMap[ip.String()]
-				ipPortNumRW.RUnlock()
-				if ipPortNumOk && ipPortNum >= maxOpenPort {
+				ipPortNumRW.Lock()
+				for _, ip := range w.ips {
+					ipPortNumMap[ip.String()] = 0
+				}
+				ipPortNumRW.Unlock()
+			}
+			for index = start; index < targets.Total(); index += scanShard.Count {
+				if atomic.LoadInt32(&interrupted) == 1 {
+					break
+				}
+				if r != nil {
+					r.setIndex(index)
+				}
+				ip, _port, protocol := targets.Get(index)
+				if excludeIps.Contains(ip) {
+					continue
+				}
+				if len(rescanned) > 0 && rescanned[scan.Target{Ip: ip.String(), Port: _port, Protocol: protocol}] {
+					continue
+				}
+				if maxOpenPort > 0 {
+					ipPortNumRW.RLock()
+					ipPortNum := ipPortNumMap[ip.String()]
+					ipPortNumRW.RUnlock()
+					if ipPortNum >= maxOpenPort {
+						continue
+					}
+				}
+				_ipOption := targetOption(ip)
+				_ipOption.Protocol = protocol
+				s.WaitLimiter() // limit rate
+				if err = s.Scan(ip, _port, _ipOption); err == scan.ErrMaxTargets {
+					myLog.Printf("[error] %s %d, check the targets or use --maxTargets to raise the limit\n", err, maxTargets)
+					atomic.StoreInt32(&interrupted, 1)
 					break
 				}
 			}
-			time.Sleep(time.Millisecond)
-			s.Scan(ip, _port, ipOption)
-		}
-		if maxOpenPort > 0 {
-			ipPortNumRW.Lock()
-			delete(ipPortNumMap, ip.String())
-			ipPortNumRW.Unlock()
+			if maxOpenPort > 0 {
+				ipPortNumRW.Lock()
+				for _, ip := range w.ips {
+					delete(ipPortNumMap, ip.String())
+				}
+				ipPortNumRW.Unlock()
+			}
+			if atomic.LoadInt32(&interrupted) == 1 {
+				break
+			}
 		}
+		return
 	}
 
-	// host group scan func
-	var wgHostScan sync.WaitGroup
-	hostScan, _ := ants.NewPoolWithFunc(hostGroup, func(ip interface{}) {
-		_ip := ip.(net.IP)
-		portScan(_ip)
-		wgHostScan.Done()
-	})
-	defer hostScan.Release()
-
-	// Pool - ping and port scan
-	poolPing, _ := ants.NewPoolWithFunc(rateP, func(ip interface{}) {
-		_ip := ip.(net.IP)
-		if host.IsLive(_ip.String(), pt, time.Duration(option.Timeout)*time.Millisecond) {
-			wgHostScan.Add(1)
-			hostScan.Invoke(_ip)
+	var index uint64 // 当前窗口的下一个置换序号
+	for batch := firstBatch; batch != nil; batch = <-batches {
+		index = scanBatch(batch)
+		if atomic.LoadInt32(&interrupted) == 1 {
+			break
 		}
-		wgPing.Done()
-	})
-	defer poolPing.Release()
-
-	// start scan
-	for _, ir := range ipRangeGroup { // ip group
-		shuffle := util.NewShuffle(ir.TotalNum())    // shuffle
-		for i := uint64(0); i < ir.TotalNum(); i++ { // ip index
-			ip := make(net.IP, len(ir.GetIpByIndex(0)))
-			copy(ip, ir.GetIpByIndex(shuffle.Get(i))) // Note: dup copy []byte when concurrent (GetIpByIndex not to do dup copy)
-			if !pn {                                  // ping
-				wgPing.Add(1)
-				_ = poolPing.Invoke(ip)
-			} else {
-				wgHostScan.Add(1)
-				hostScan.Invoke(ip)
+		// 等待本批的响应, 进度文件中的批次前进后不会丢失结果
+		s.Wait()
+	}
+	// 中断时未扫描完成
+	paused := atomic.LoadInt32(&interrupted) == 1
+	s.Wait() // 扫描器-等
+	if r != nil {
+		r.close()
+		if paused {
+			if err = r.saveDone(index); err != nil {
+				myLog.Printf("[error] save %s: %s\n", resumeFile, err)
 			}
+			myLog.Printf("[*] progress saved, continue with --resume %s\n", resumeFile)
+		} else {
+			os.Remove(resumeFile) // 扫描完成
 		}
 	}
-	wgPing.Wait()     // PING组
-	wgHostScan.Wait() // HostGroupS
-	s.Wait()          // 扫描器-等
-	s.Close()         // 扫描器-收
-	<-single          // 接收器-收
-	myLog.Printf("[*] elapsed time: %s\n", time.Since(start))
+	s.Close() // 扫描器-收
+	<-single  // 接收器-收
+	if guard.Refused() > 0 {
+		myLog.Printf("[!] %d targets out of scope were refused\n", guard.Refused())
+	}
+	myLog.Printf("[*] elapsed time: %s\n", time.Since(startTime))
 	return nil
 }
 
@@ -344,6 +918,7 @@ func main() {
 		Name:        "PortScan",
 		Description: "High-performance port scanner",
 		Action:      run,
+		Commands:    []*cli.Command{diffCommand},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "ip",
@@ -357,10 +932,25 @@ func main() {
 				Required: false,
 				Value:    "",
 			},
+			&cli.StringSliceFlag{
+				Name:    "url",
+				Aliases: []string{"u"},
+				Usage:   "url mode, http probe the urls like httpx, no host discovery and port scan, eg: -u https://a.com/admin -u b.com:8080",
+			},
+			&cli.StringFlag{
+				Name:  "uL",
+				Usage: "url file for url mode, one url per line",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: "open ports file for fingerprint-only mode, no host discovery and port scan: ip:port list, nmap xml, masscan -oL/-oJ or go-portScan result. - is stdin",
+				Value: "",
+			},
 			&cli.StringFlag{
 				Name:    "port",
 				Aliases: []string{"p"},
-				Usage:   "eg: \"top1000,5612,65120,-\"",
+				Usage:   "eg: \"top1000,5612,65120,-\", \"web,db,ssh,!8000-8100\", \"T:top100,U:53,161\". see README",
 				Value:   "top1000",
 			},
 			&cli.BoolFlag{
@@ -374,11 +964,62 @@ func main() {
 				Usage:   "concurrent num when ping probe each ip",
 				Value:   300,
 			},
+			&cli.BoolFlag{
+				Name:  "allRecords",
+				Usage: "scan all resolved A and AAAA records of hostname targets, default only the first",
+				Value: false,
+			},
+			&cli.IntFlag{
+				Name:    "rateDns",
+				Aliases: []string{"rd"},
+				Usage:   "concurrent num when resolving hostnames of targets",
+				Value:   50,
+			},
 			&cli.IntFlag{
 				Name:    "hostGroup",
 				Aliases: []string{"hp"},
-				Usage:   "host concurrent num",
-				Value:   200,
+				Usage:   "ips per scan window, the live ips of a window are scanned in a random ip*port order while the next window is pinged",
+				Value:   1024,
+			},
+			&cli.StringFlag{
+				Name:  "shard",
+				Usage: "scan shard i of N, eg: 1/3. shards with the same seed cover all ip*port exactly once",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "resume",
+				Usage: "checkpoint file, saved periodically and on Ctrl+C. if it exists, resume the scan from it",
+				Value: "",
+			},
+			&cli.Int64Flag{
+				Name:  "seed",
+				Usage: "random seed of the ip*port scan order, random within each scan window of a target batch, same seed same order. default is random",
+				Value: 0,
+			},
+			&cli.StringFlag{
+				Name:  "exclude",
+				Usage: "exclude ip, same format as --ip, eg: \"10.0.0.0/24,10.0.1.1-10.0.1.9,fd00::1\"",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "excludeFile",
+				Usage: "exclude ip file, one per line, lines starting with # are ignored",
+				Value: "",
+			},
+			&cli.BoolFlag{
+				Name:  "excludeReserved",
+				Usage: "exclude reserved, loopback, link-local, multicast and broadcast ranges",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "scope",
+				Usage: "authorized scope file, each line is \"ip [ports]\", eg: \"10.0.0.0/8 22,80,443\". targets out of scope are refused",
+				Value: "",
+			},
+			&cli.Uint64Flag{
+				Name:  "maxTargets",
+				Usage: "max number of ip*port targets, 0 means no limit",
+				Value: scan.DefaultMaxTargets,
 			},
 			&cli.BoolFlag{
 				Name:  "PT",
@@ -390,27 +1031,72 @@ func main() {
 				Usage: "TCP-mode",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "sU",
+				Usage: "UDP-mode, use UDP top ports when port is not set",
+				Value: false,
+			},
 			&cli.IntFlag{
 				Name:    "timeout",
 				Aliases: []string{"to"},
-				Usage:   "TCP-mode SYN-mode timeout. unit is ms.",
-				Value:   800,
+				Usage:   fmt.Sprintf("TCP-mode SYN-mode UDP-mode timeout. unit is ms. If set -1, TCP-mode is %d, UDP-mode is %d, SYN-mode is %d", tcp.DefaultTcpOption.Timeout, udp.DefaultUdpOption.Timeout, syn.DefaultSynOption.Timeout),
+				Value:   -1,
 			},
 			&cli.BoolFlag{
 				Name:  "sS",
 				Usage: "Use SYN-mode",
 				Value: true,
 			},
+			&cli.BoolFlag{
+				Name:  "sA",
+				Usage: "SYN-mode use ACK scan, output unfiltered port",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sF",
+				Usage: "SYN-mode use FIN scan, output open|filtered port",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sN",
+				Usage: "SYN-mode use NULL scan, output open|filtered port",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sX",
+				Usage: "SYN-mode use Xmas scan, output open|filtered port",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sW",
+				Usage: "SYN-mode use Window scan, output open port by RST window",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "sY",
+				Usage: "SYN-mode use SCTP INIT scan, use SCTP top ports when port is not set",
+				Value: false,
+			},
+			&cli.IntFlag{
+				Name:  "retries",
+				Usage: "SYN-mode retransmission times of unanswered probes",
+				Value: 0,
+			},
 			&cli.StringFlag{
 				Name:    "nexthop",
 				Aliases: []string{"nh"},
 				Usage:   "specified nexthop gw add to pcap dev",
 				Value:   "",
 			},
+			&cli.StringFlag{
+				Name:  "backend",
+				Usage: fmt.Sprintf("SYN-mode packet backend: %s, %s(linux, no libpcap), %s(linux, TPACKET_V3 ring for high rate). default is pcap if compiled in", syn.BackendPcap, syn.BackendAfPacket, syn.BackendTPacket),
+				Value: "",
+			},
 			&cli.IntFlag{
 				Name:    "rate",
 				Aliases: []string{"r"},
-				Usage:   fmt.Sprintf("number of packets sent per second. If set -1, TCP-mode is %d, SYN-mode is %d(SYN-mode is restricted by the network adapter, 2000=1M)", tcp.DefaultTcpOption.Rate, syn.DefaultSynOption.Rate),
+				Usage:   fmt.Sprintf("number of packets sent per second. If set -1, TCP-mode is %d, UDP-mode is %d, SYN-mode is %d(SYN-mode is restricted by the network adapter, 2000=1M)", tcp.DefaultTcpOption.Rate, udp.DefaultUdpOption.Rate, syn.DefaultSynOption.Rate),
 				Value:   -1,
 			},
 			&cli.IntFlag{
@@ -446,23 +1132,33 @@ func main() {
 				Usage:   "Stop the ip scan, when the number of open-port is maxOpenPort",
 				Value:   0,
 			},
+			&cli.BoolFlag{
+				Name:    "allState",
+				Aliases: []string{"as"},
+				Usage:   "output closed/filtered port state, not just open",
+				Value:   false,
+			},
 			&cli.StringFlag{
 				Name:    "oCsv",
 				Aliases: []string{"oC"},
 				Usage:   "output csv file",
 				Value:   "",
 			},
+			&cli.StringFlag{
+				Name:  "oX",
+				Usage: "output nmap xml file, same as -o xml:file",
+				Value: "",
+			},
 			&cli.BoolFlag{
 				Name:    "json",
 				Aliases: []string{"j"},
 				Usage:   "output json format",
 				Value:   false,
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:    "oFile",
 				Aliases: []string{"o"},
-				Usage:   "output to file",
-				Value:   "",
+				Usage:   "output to file, can be repeated, eg: -o text:out.txt -o jsonl:out.json -o csv:out.csv -o table:-, formats: text, jsonl, csv, xml, hosts, table. without format, output the log and results to the file",
 			},
 			&cli.BoolFlag{
 				Name:  "nohup",
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/urfave/cli/v2"
+	"testing"
+)
+
+func TestParseScanType(t *testing.T) {
+	flags := []cli.Flag{&cli.BoolFlag{Name: "sT"}, &cli.BoolFlag{Name: "sU"}}
+	for _, st := range synScanTypes {
+		flags = append(flags, &cli.BoolFlag{Name: st.flag})
+	}
+	cases := []struct {
+		args     []string
+		scanType port.ScanType
+		err      bool
+	}{
+		{nil, port.ScanTypeSyn, false},
+		{[]string{"--sF"}, port.ScanTypeFin, false},
+		{[]string{"--sY"}, port.ScanTypeSctpInit, false},
+		{[]string{"--sT"}, port.ScanTypeSyn, false},
+		{[]string{"--sA", "--sF"}, 0, true},
+		{[]string{"--sX", "--sT"}, 0, true},
+		{[]string{"--sW", "--sU"}, 0, true},
+	}
+	for _, c := range cases {
+		var scanType port.ScanType
+		var err error
+		app := &cli.App{Flags: flags, Action: func(ctx *cli.Context) error {
+			scanType, err = parseScanType(ctx)
+			return nil
+		}}
+		if err2 := app.Run(append([]string{"ps"}, c.args...)); err2 != nil {
+			t.Fatal(err2)
+		}
+		if (err != nil) != c.err || (!c.err && scanType != c.scanType) {
+			t.Errorf("%v: got %s, %v", c.args, scanType, err)
+		}
+	}
+}
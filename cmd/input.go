@@ -0,0 +1,147 @@
+package main
+
+import (
+	"github.com/XinRoom/go-portScan/core/input"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/XinRoom/go-portScan/core/port/tcp"
+	"github.com/XinRoom/go-portScan/core/port/udp"
+	"github.com/XinRoom/go-portScan/core/scan"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// identifyInput 指纹识别模式, 读取已知的开放端口(ip:port列表、nmap xml、masscan -oL/-oJ、go-portScan的结果),
+// 不进行存活探测和端口扫描, TCP端口进行服务识别和Http探测, UDP端口使用UDP扫描器探测服务
+// 完成后关闭扫描器, 即关闭retChan
+func identifyInput(file string, retChan chan port.OpenIpPort, excludeIps *scan.Exclude, guard *scan.Guard, myLog *log.Logger) (err error) {
+	// TCP为主扫描器, UDP端口使用UDP扫描器
+	option := port.ScannerOption{
+		Rate:     rate,
+		Timeout:  timeout,
+		AllState: allState,
+		Debug:    debug,
+	}
+	tcpOption, udpOption := option, option
+	if tcpOption.Rate == -1 {
+		tcpOption.Rate = tcp.DefaultTcpOption.Rate
+	}
+	if tcpOption.Timeout == -1 {
+		tcpOption.Timeout = tcp.DefaultTcpOption.Timeout
+	}
+	if udpOption.Rate == -1 {
+		udpOption.Rate = udp.DefaultUdpOption.Rate
+	}
+	if udpOption.Timeout == -1 {
+		udpOption.Timeout = udp.DefaultUdpOption.Timeout
+	}
+	ts, err := tcp.NewTcpScanner(retChan, tcpOption)
+	if err != nil {
+		close(retChan)
+		return
+	}
+	udpRet := make(chan port.OpenIpPort, 5000)
+	us, err := udp.NewUdpScanner(udpRet, udpOption)
+	if err != nil {
+		close(retChan)
+		return
+	}
+	mux := scan.NewMux(port.ProtocolTcp, ts)
+	mux.Add(port.ProtocolUdp, us, udpRet, retChan)
+	guard.Scanner = mux
+	defer func() {
+		guard.Wait()
+		guard.Close()
+	}()
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// 未指定时进行服务识别和Http探测
+	ipOption := port.IpOption{
+		FingerPrint: sV,
+		Httpx:       httpx,
+	}
+	if !sV && !httpx {
+		ipOption.FingerPrint, ipOption.Httpx = true, true
+	}
+
+	type target struct {
+		ips  scan.IpRange
+		host string
+	}
+	resolved := make(map[string]target) // 域名的解析结果
+	seen := make(map[string]bool)       // 去重
+	var total, skipped int
+	p := &input.Parser{OnError: func(line string, err error) {
+		myLog.Printf("[error] %s: %s\n", line, err)
+	}}
+	err = p.Parse(r, func(op port.OpenIpPort) {
+		if op.Protocol == port.ProtocolSctp {
+			skipped++
+			return
+		}
+		var ips scan.IpRange = scan.IpList{op.Ip}
+		if op.Ip == nil {
+			target, ok := resolved[op.Host]
+			if !ok {
+				target.ips = scan.IpList{}
+				if it, err := parseTarget(op.Host); err != nil {
+					myLog.Printf("[error] %s\n", err)
+				} else {
+					target.ips, target.host = inputTarget(it)
+				}
+				resolved[op.Host] = target
+			}
+			ips, op.Host = target.ips, target.host
+		}
+		// IP范围逐个取IP, 不一次展开
+		for i := uint64(0); i < ips.TotalNum(); i++ {
+			ip := ips.GetIpByIndex(i)
+			key := strings.Join([]string{ip.String(), strconv.Itoa(int(op.Port)), op.Protocol, op.Host}, " ")
+			if seen[key] || excludeIps.Contains(ip) {
+				continue
+			}
+			seen[key] = true
+			total++
+			_ip := make(net.IP, len(ip))
+			copy(_ip, ip) // Note: dup copy []byte (GetIpByIndex not to do dup copy)
+			_ipOption := ipOption
+			_ipOption.Protocol = op.Protocol
+			if _ipOption.Protocol == "" {
+				_ipOption.Protocol = port.ProtocolTcp
+			}
+			if op.Host != "" {
+				_ipOption.Hosts = []string{op.Host}
+			}
+			guard.WaitLimiter() // limit rate
+			if err := guard.Scan(_ip, op.Port, _ipOption); err == scan.ErrMaxTargets {
+				myLog.Printf("[error] %s %d, use --maxTargets to raise the limit\n", err, maxTargets)
+				p.Stop() // 不再读取之后的端口
+				return
+			}
+		}
+	})
+	if debug {
+		myLog.Printf("[d] input: %d ports, %d sctp ports skipped\n", total, skipped)
+	}
+	return
+}
+
+// inputTarget 输入中主机的IP, 域名时返回解析结果和域名, IP范围(eg: 1.1.1.1-2, 1.1.1.0/24)时原样返回, 域名为空
+func inputTarget(it scan.IpRange) (ips scan.IpRange, host string) {
+	if hostIps, ok := it.(*scan.HostIps); ok {
+		return hostIps.Ips, hostIps.Host
+	}
+	return it, ""
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestInputTarget(t *testing.T) {
+	it, err := parseTarget("10.0.0.1-10.255.255.255")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IP范围不展开
+	ips, host := inputTarget(it)
+	if ips.TotalNum() != 1<<24-1 || !ips.GetIpByIndex(1).Equal(net.ParseIP("10.0.0.2")) || host != "" {
+		t.Errorf("range: got %d ips, %q", ips.TotalNum(), host)
+	}
+
+	it, err = parseTarget("localhost")
+	if err != nil {
+		t.Skip(err)
+	}
+	if ips, host = inputTarget(it); ips.TotalNum() == 0 || host != "localhost" {
+		t.Errorf("hostname: got %d ips, %q", ips.TotalNum(), host)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/XinRoom/go-portScan/core/scan"
+	"github.com/urfave/cli/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 定期保存进度的间隔, 需大于SYN-mode等待响应的时间
+const resumeInterval = 10 * time.Second
+
+// 单独保存的参数, 不写入进度文件的Flags
+var resumeSkipFlags = map[string]bool{"ip": true, "port": true, "seed": true, "shard": true, "resume": true}
+
+// applyCheckpoint 使用进度文件中的参数, 命令行中指定的参数优先
+func applyCheckpoint(c *cli.Context, cp *scan.Checkpoint) error {
+	for name, value := range cp.Flags {
+		if c.IsSet(name) {
+			continue
+		}
+		if !isSliceFlag(c, name) {
+			if err := c.Set(name, value); err != nil {
+				return err
+			}
+			continue
+		}
+		// 可重复的参数保存为json数组, 逐个设置
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err != nil {
+			return fmt.Errorf("invalid value of %s in checkpoint: %s", name, err)
+		}
+		for _, v := range values {
+			if err := c.Set(name, v); err != nil {
+				return err
+			}
+		}
+	}
+	if len(cp.Targets) > 0 {
+		if err := c.Set("ip", strings.Join(cp.Targets, ",")); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]string{
+		"port":  cp.Ports,
+		"seed":  strconv.FormatInt(cp.Seed, 10),
+		"shard": cp.Shard,
+	} {
+		if err := c.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpointFlags 命令行中指定的其它参数
+func checkpointFlags(c *cli.Context) map[string]string {
+	flags := make(map[string]string)
+	for _, f := range c.App.Flags {
+		name := f.Names()[0]
+		if !c.IsSet(name) || resumeSkipFlags[name] {
+			continue
+		}
+		if isSliceFlag(c, name) {
+			b, _ := json.Marshal(c.StringSlice(name))
+			flags[name] = string(b)
+		} else {
+			flags[name] = fmt.Sprint(c.Value(name))
+		}
+	}
+	return flags
+}
+
+// isSliceFlag 是否为可重复的参数, eg: -o
+func isSliceFlag(c *cli.Context, name string) bool {
+	for _, f := range c.App.Flags {
+		if f.Names()[0] == name {
+			_, ok := f.(*cli.StringSliceFlag)
+			return ok
+		}
+	}
+	return false
+}
+
+// resumer 定期及中断时保存扫描进度
+type resumer struct {
+	file    string
+	scanner port.Scanner
+	index   uint64 // 当前置换序号, atomic
+
+	lock        sync.Mutex
+	cp          *scan.Checkpoint
+	pos         scanPos       // 当前扫描位置
+	last        scanPos       // 上次定期保存时的扫描位置, 其之前的探测已收到响应
+	resent      []scan.Target // 恢复时重新扫描的探测, 收到响应前仍需保存
+	resentTicks int
+	stop        chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// scanPos 扫描位置: 批次、窗口及窗口内的置换序号
+type scanPos struct {
+	batch    uint64
+	window   uint64
+	scanning bool     // 窗口已开始端口扫描
+	liveIps  []string // 窗口的存活ip
+	index    uint64
+}
+
+// start 开始定期保存进度
+func (r *resumer) start() {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(resumeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				// 保存上一周期的位置, 最近发送的探测可能还未收到响应
+				r.lock.Lock()
+				last := r.last
+				r.last = r.pos
+				r.last.index = atomic.LoadUint64(&r.index)
+				if r.resentTicks++; r.resentTicks >= 2 {
+					r.resent = nil
+				}
+				r.lock.Unlock()
+				r.save(last)
+			}
+		}
+	}()
+}
+
+// close 停止定期保存
+func (r *resumer) close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// setIndex 更新当前置换序号
+func (r *resumer) setIndex(index uint64) {
+	atomic.StoreUint64(&r.index, index)
+}
+
+// startBatch 开始扫描一批目标, 从第window个窗口开始, 之前批次的响应均已收到
+func (r *resumer) startBatch(batch, window uint64) {
+	r.lock.Lock()
+	r.pos = scanPos{batch: batch, window: window}
+	r.last = r.pos
+	r.lock.Unlock()
+	atomic.StoreUint64(&r.index, 0)
+}
+
+// scanning 开始窗口的端口扫描, liveIps为ping得到的存活ip, resent为重新扫描的未完成探测
+func (r *resumer) scanning(window uint64, liveIps []string, index uint64, resent []scan.Target) {
+	r.lock.Lock()
+	r.pos = scanPos{batch: r.pos.batch, window: window, scanning: true, liveIps: liveIps, index: index}
+	if resent != nil {
+		r.resent = resent
+		r.resentTicks = 0
+	}
+	r.lock.Unlock()
+	atomic.StoreUint64(&r.index, index)
+}
+
+// save 保存进度, pos之前的目标已扫描完成, 未完成的探测一并保存
+func (r *resumer) save(pos scanPos) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cp.Batch, r.cp.Window, r.cp.Scanning, r.cp.LiveIps, r.cp.Index = pos.batch, pos.window, pos.scanning, pos.liveIps, pos.index
+	r.cp.Pending = r.cp.Pending[:0]
+	seen := make(map[scan.Target]bool)
+	add := func(t scan.Target) {
+		if !seen[t] {
+			seen[t] = true
+			r.cp.Pending = append(r.cp.Pending, t)
+		}
+	}
+	for _, t := range r.resent {
+		add(t)
+	}
+	if ps, ok := r.scanner.(port.PendingScanner); ok {
+		for _, op := range ps.Pending() {
+			add(scan.Target{Ip: op.Ip.String(), Port: op.Port, Protocol: op.Protocol, Host: op.Host})
+		}
+	}
+	return r.cp.Save(r.file)
+}
+
+// saveLast 强制退出时保存, 使用上次定期保存时的位置
+func (r *resumer) saveLast() error {
+	r.lock.Lock()
+	last := r.last
+	r.lock.Unlock()
+	return r.save(last)
+}
+
+// saveDone 探测均已完成时保存, index为当前窗口的下一个置换序号
+func (r *resumer) saveDone(index uint64) error {
+	r.lock.Lock()
+	r.resent = nil
+	pos := r.pos
+	r.lock.Unlock()
+	pos.index = index
+	return r.save(pos)
+}
+
+// parseTargets 解析进度文件中的ip
+func parseTargets(ips []string) (ret []net.IP) {
+	for _, ip := range ips {
+		if _ip := net.ParseIP(ip); _ip != nil {
+			if _ip4 := _ip.To4(); _ip4 != nil {
+				_ip = _ip4
+			}
+			ret = append(ret, _ip)
+		}
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/XinRoom/go-portScan/core/scan"
+	"github.com/urfave/cli/v2"
+	"reflect"
+	"testing"
+)
+
+func resumeTestApp(action cli.ActionFunc) *cli.App {
+	return &cli.App{
+		Action: action,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "ip"},
+			&cli.StringFlag{Name: "port", Aliases: []string{"p"}},
+			&cli.Int64Flag{Name: "seed"},
+			&cli.StringFlag{Name: "shard"},
+			&cli.IntFlag{Name: "rate", Value: -1},
+			&cli.StringSliceFlag{Name: "oFile", Aliases: []string{"o"}},
+		},
+	}
+}
+
+func TestCheckpointFlags(t *testing.T) {
+	var cp scan.Checkpoint
+	app := resumeTestApp(func(c *cli.Context) error {
+		cp.Flags = checkpointFlags(c)
+		return nil
+	})
+	if err := app.Run([]string{"ps", "--ip", "10.0.0.1", "--rate", "100", "-o", "jsonl:a.json", "-o", "csv:b.csv"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cp.Flags["ip"]; ok {
+		t.Errorf("flags = %v, ip saved", cp.Flags)
+	}
+	cp.Targets, cp.Ports, cp.Seed = []string{"10.0.0.1"}, "80", 1
+
+	var oFiles []string
+	var rate int
+	app = resumeTestApp(func(c *cli.Context) error {
+		if err := applyCheckpoint(c, &cp); err != nil {
+			return err
+		}
+		oFiles, rate = c.StringSlice("oFile"), c.Int("rate")
+		return nil
+	})
+	if err := app.Run([]string{"ps"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"jsonl:a.json", "csv:b.csv"}; !reflect.DeepEqual(oFiles, want) || rate != 100 {
+		t.Errorf("resumed -o = %q, rate = %d, want %q, 100", oFiles, rate, want)
+	}
+}
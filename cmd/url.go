@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/XinRoom/go-portScan/core/port/fingerprint"
+	"github.com/XinRoom/go-portScan/core/port/tcp"
+	"github.com/XinRoom/go-portScan/core/scan"
+	"github.com/panjf2000/ants/v2"
+	limiter "golang.org/x/time/rate"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeUrls url模式, 对每行的url进行Http探测(标题、TLS、favicon和web指纹), 结果的Url为输入的url
+// url没有协议时依次尝试https和http, 使用--rate和--timeout, 最多--rate个并发探测, 完成后关闭retChan
+func probeUrls(r io.Reader, retChan chan port.OpenIpPort, excludeIps *scan.Exclude, guard *scan.Guard, myLog *log.Logger) error {
+	defer close(retChan)
+	_rate, _timeout := rate, timeout
+	if _rate == -1 {
+		_rate = tcp.DefaultTcpOption.Rate
+	}
+	if _timeout == -1 {
+		_timeout = tcp.DefaultTcpOption.Timeout
+	}
+	if _rate < 10 {
+		_rate = 10
+	}
+	lim := limiter.NewLimiter(limiter.Every(time.Second/time.Duration(_rate)), _rate/10)
+	dialTimeout := time.Duration(_timeout) * time.Millisecond
+
+	type probe struct {
+		op    port.OpenIpPort
+		ports []uint16
+	}
+	var wg sync.WaitGroup
+	pool, err := ants.NewPoolWithFunc(_rate, func(i interface{}) {
+		defer wg.Done()
+		p := i.(probe)
+		op := p.op
+		var isDailErr bool
+		op.HttpInfo, op.Banner, isDailErr = fingerprint.ProbeUrlHttpInfo(op.Ip, op.Url, dialTimeout)
+		if isDailErr || op.HttpInfo == nil {
+			if debug {
+				myLog.Printf("[d] %s: no http response\n", op.Url)
+			}
+			return
+		}
+		op.Service = "http"
+		if strings.HasPrefix(op.HttpInfo.Url, "https") {
+			op.Service = "https"
+		}
+		if len(p.ports) > 1 && op.Service == "https" {
+			op.Port = p.ports[1] // 没有协议和端口的url
+		}
+		retChan <- op
+	})
+	if err != nil {
+		return err
+	}
+	defer pool.Release()
+	defer wg.Wait()
+
+	resolved := make(map[string][]net.IP) // 域名的解析结果
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rawUrl := strings.TrimSpace(scanner.Text())
+		if rawUrl == "" || rawUrl[0] == '#' {
+			continue
+		}
+		u, ports, err := parseUrl(rawUrl)
+		if err != nil {
+			myLog.Printf("[error] %s: %s\n", rawUrl, err)
+			continue
+		}
+		hostname := u.Hostname()
+		ips, ok := resolved[hostname]
+		if !ok {
+			if it, err := parseTarget(hostname); err != nil {
+				myLog.Printf("[error] %s\n", err)
+			} else {
+				for i := uint64(0); i < it.TotalNum(); i++ {
+					ip := it.GetIpByIndex(i)
+					_ip := make(net.IP, len(ip))
+					copy(_ip, ip) // Note: dup copy []byte (GetIpByIndex not to do dup copy)
+					ips = append(ips, _ip)
+				}
+			}
+			resolved[hostname] = ips
+		}
+		for _, ip := range ips {
+			if excludeIps.Contains(ip) {
+				continue
+			}
+			// url的每个端口为一个目标
+			for _, _port := range ports {
+				if err = guard.Take(ip, _port, port.ProtocolTcp); err != nil {
+					break
+				}
+			}
+			if err == scan.ErrMaxTargets {
+				myLog.Printf("[error] %s %d, use --maxTargets to raise the limit\n", err, maxTargets)
+				return nil
+			}
+			if err != nil {
+				continue
+			}
+			op := port.OpenIpPort{Ip: ip, Port: ports[0], State: port.StateOpen, Url: rawUrl}
+			if net.ParseIP(hostname) == nil {
+				op.Host = strings.ToLower(hostname)
+			}
+			lim.Wait(context.Background()) // limit rate
+			wg.Add(1)
+			if err = pool.Invoke(probe{op: op, ports: ports}); err != nil {
+				wg.Done()
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseUrl 解析url, 返回url的端口; 没有协议和端口时为80和443
+func parseUrl(rawUrl string) (u *url.URL, ports []uint16, err error) {
+	noScheme := !strings.Contains(rawUrl, "://")
+	if noScheme {
+		rawUrl = "http://" + rawUrl
+	}
+	if u, err = url.Parse(rawUrl); err != nil {
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, nil, errors.New("missing host")
+	}
+	switch {
+	case u.Port() != "":
+		_port, err := strconv.ParseUint(u.Port(), 10, 16)
+		if err != nil || _port == 0 {
+			return nil, nil, fmt.Errorf("invalid port %q", u.Port())
+		}
+		ports = []uint16{uint16(_port)}
+	case noScheme:
+		ports = []uint16{80, 443}
+	case u.Scheme == "https":
+		ports = []uint16{443}
+	default:
+		ports = []uint16{80}
+	}
+	return
+}
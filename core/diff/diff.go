@@ -0,0 +1,227 @@
+package diff
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result 两次扫描结果的差异, 只比较open状态的端口
+type Result struct {
+	HostsAppeared    []string          `json:"hosts_appeared"`    // 新出现的IP
+	HostsDisappeared []string          `json:"hosts_disappeared"` // 不再有开放端口的IP
+	Opened           []port.OpenIpPort `json:"opened"`            // 新开放的端口, 包括新出现的IP的端口
+	Closed           []port.OpenIpPort `json:"closed"`            // 不再开放的端口, 包括消失的IP的端口
+	Changed          []Change          `json:"changed"`           // 服务发生变化的端口
+}
+
+// Change 服务发生变化的端口
+type Change struct {
+	Old    port.OpenIpPort `json:"old"`
+	New    port.OpenIpPort `json:"new"`
+	Fields []Field         `json:"fields"`
+}
+
+// Field 变化的字段: service, banner, http_title, tls_cn, fingers
+type Field struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Empty 没有差异
+func (r *Result) Empty() bool {
+	return len(r.HostsAppeared) == 0 && len(r.HostsDisappeared) == 0 && len(r.Opened) == 0 && len(r.Closed) == 0 && len(r.Changed) == 0
+}
+
+// Compare 比较两次扫描的结果, 端口按ip、端口、协议、域名和url区分, 同一端口有多条结果时使用最后一条
+func Compare(oldOps, newOps []port.OpenIpPort) *Result {
+	oldPorts, oldHosts := index(oldOps)
+	newPorts, newHosts := index(newOps)
+	r := &Result{
+		HostsAppeared:    []string{},
+		HostsDisappeared: []string{},
+		Opened:           []port.OpenIpPort{},
+		Closed:           []port.OpenIpPort{},
+		Changed:          []Change{},
+	}
+	for ip := range newHosts {
+		if !oldHosts[ip] {
+			r.HostsAppeared = append(r.HostsAppeared, ip)
+		}
+	}
+	for ip := range oldHosts {
+		if !newHosts[ip] {
+			r.HostsDisappeared = append(r.HostsDisappeared, ip)
+		}
+	}
+	for k, op := range newPorts {
+		old, ok := oldPorts[k]
+		if !ok {
+			r.Opened = append(r.Opened, op)
+			continue
+		}
+		if fields := compareService(old, op); len(fields) > 0 {
+			r.Changed = append(r.Changed, Change{Old: old, New: op, Fields: fields})
+		}
+	}
+	for k, op := range oldPorts {
+		if _, ok := newPorts[k]; !ok {
+			r.Closed = append(r.Closed, op)
+		}
+	}
+	sortIps(r.HostsAppeared)
+	sortIps(r.HostsDisappeared)
+	sortOps(r.Opened)
+	sortOps(r.Closed)
+	sort.Slice(r.Changed, func(i, j int) bool { return less(r.Changed[i].New, r.Changed[j].New) })
+	return r
+}
+
+type key struct {
+	ip       string
+	port     uint16
+	protocol string
+	host     string
+	url      string
+}
+
+// index open状态的端口和有开放端口的IP
+func index(ops []port.OpenIpPort) (ports map[key]port.OpenIpPort, hosts map[string]bool) {
+	ports = make(map[key]port.OpenIpPort)
+	hosts = make(map[string]bool)
+	for _, op := range ops {
+		if !op.IsOpen() || op.Ip == nil {
+			continue
+		}
+		if ip4 := op.Ip.To4(); ip4 != nil {
+			op.Ip = ip4
+		}
+		if op.Protocol == port.ProtocolTcp {
+			op.Protocol = ""
+		}
+		op.State = ""
+		ports[key{op.Ip.String(), op.Port, op.Protocol, op.Host, op.Url}] = op
+		hosts[op.Ip.String()] = true
+	}
+	return
+}
+
+// compareService 比较服务, Http服务的banner为响应头(含Date等), 有HttpInfo时不比较banner
+func compareService(old, new port.OpenIpPort) (fields []Field) {
+	add := func(name, o, n string) {
+		if o != n {
+			fields = append(fields, Field{Name: name, Old: o, New: n})
+		}
+	}
+	add("service", old.Service, new.Service)
+	if old.HttpInfo == nil && new.HttpInfo == nil {
+		add("banner", banner(old.Banner), banner(new.Banner))
+	}
+	var oldHi, newHi port.HttpInfo
+	if old.HttpInfo != nil {
+		oldHi = *old.HttpInfo
+	}
+	if new.HttpInfo != nil {
+		newHi = *new.HttpInfo
+	}
+	add("http_title", oldHi.Title, newHi.Title)
+	add("tls_cn", oldHi.TlsCN, newHi.TlsCN)
+	add("fingers", fingers(oldHi.Fingers), fingers(newHi.Fingers))
+	return
+}
+
+// banner 去除首尾空白, 换行统一为\n(csv读取时\r\n变为\n)
+func banner(b []byte) string {
+	return strings.TrimSpace(strings.ReplaceAll(string(b), "\r\n", "\n"))
+}
+
+// fingers 排序后的指纹, 与识别顺序无关
+func fingers(f []string) string {
+	f = append([]string{}, f...)
+	sort.Strings(f)
+	return strings.Join(f, ",")
+}
+
+func sortIps(ips []string) {
+	sort.Slice(ips, func(i, j int) bool {
+		return compareIp(net.ParseIP(ips[i]), net.ParseIP(ips[j])) < 0
+	})
+}
+
+func sortOps(ops []port.OpenIpPort) {
+	sort.Slice(ops, func(i, j int) bool { return less(ops[i], ops[j]) })
+}
+
+func less(a, b port.OpenIpPort) bool {
+	if c := compareIp(a.Ip, b.Ip); c != 0 {
+		return c < 0
+	}
+	if a.Port != b.Port {
+		return a.Port < b.Port
+	}
+	if a.Protocol != b.Protocol {
+		return a.Protocol < b.Protocol
+	}
+	if a.Host != b.Host {
+		return a.Host < b.Host
+	}
+	return a.Url < b.Url
+}
+
+// compareIp IPv4在IPv6之前
+func compareIp(a, b net.IP) int {
+	a4, b4 := a.To4(), b.To4()
+	switch {
+	case a4 != nil && b4 != nil:
+		return strings.Compare(string(a4), string(b4))
+	case a4 != nil:
+		return -1
+	case b4 != nil:
+		return 1
+	}
+	return strings.Compare(string(a.To16()), string(b.To16()))
+}
+
+// WriteText 输出文本, 每行一个差异: [+]/[-] host, [+] 新开放的端口, [-] 关闭的端口, [*] 服务变化
+func (r *Result) WriteText(w io.Writer) error {
+	var buf strings.Builder
+	for _, ip := range r.HostsAppeared {
+		buf.WriteString("[+] host " + ip + "\n")
+	}
+	for _, ip := range r.HostsDisappeared {
+		buf.WriteString("[-] host " + ip + "\n")
+	}
+	for _, op := range r.Opened {
+		buf.WriteString("[+] " + portString(op) + "\n")
+	}
+	for _, op := range r.Closed {
+		buf.WriteString("[-] " + portString(op) + "\n")
+	}
+	for _, c := range r.Changed {
+		fields := make([]string, len(c.Fields))
+		for i, f := range c.Fields {
+			fields[i] = f.Name + ": " + strconv.Quote(f.Old) + " -> " + strconv.Quote(f.New)
+		}
+		buf.WriteString("[*] " + portString(c.New) + " " + strings.Join(fields, ", ") + "\n")
+	}
+	buf.WriteString(fmt.Sprintf("[*] %d hosts appeared, %d hosts disappeared, %d ports opened, %d ports closed, %d services changed\n",
+		len(r.HostsAppeared), len(r.HostsDisappeared), len(r.Opened), len(r.Closed), len(r.Changed)))
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// portString 端口的一行文本, Http服务附带标题
+func portString(op port.OpenIpPort) string {
+	hi := op.HttpInfo
+	op.HttpInfo = nil
+	s := op.String()
+	if hi != nil && hi.Title != "" {
+		s += " [" + hi.Title + "]"
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package diff
+
+import (
+	"bytes"
+	"github.com/XinRoom/go-portScan/core/output"
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"strings"
+	"testing"
+)
+
+var oldResults = []port.OpenIpPort{
+	{Ip: net.ParseIP("10.0.0.1"), Port: 22, Service: "ssh", Banner: []byte("SSH-2.0-OpenSSH_8.9\r\n")},
+	{Ip: net.ParseIP("10.0.0.1"), Port: 80, Service: "http", Banner: []byte("HTTP/1.1 200 OK\r\nDate: 1\r\n"), Host: "a.test",
+		HttpInfo: &port.HttpInfo{StatusCode: 200, Title: "old", Fingers: []string{"nginx", "php"}}},
+	{Ip: net.ParseIP("10.0.0.1"), Port: 8080, Service: "http"},
+	{Ip: net.ParseIP("10.0.0.2"), Port: 443, Service: "https", HttpInfo: &port.HttpInfo{StatusCode: 200, TlsCN: "b.test"}},
+	{Ip: net.ParseIP("10.0.0.3"), Port: 21, State: port.StateClosed},
+}
+
+var newResults = []port.OpenIpPort{
+	{Ip: net.ParseIP("10.0.0.1"), Port: 22, Service: "ssh", Banner: []byte("SSH-2.0-OpenSSH_9.6\r\n")},
+	{Ip: net.ParseIP("10.0.0.1"), Port: 80, Service: "http", Banner: []byte("HTTP/1.1 200 OK\r\nDate: 2\r\n"), Host: "a.test",
+		HttpInfo: &port.HttpInfo{StatusCode: 200, Title: "new", Fingers: []string{"php", "nginx"}}},
+	{Ip: net.ParseIP("10.0.0.1"), Port: 3306, Service: "mysql"},
+	{Ip: net.ParseIP("10.0.0.3"), Port: 21, Service: "ftp"},
+}
+
+func write(t *testing.T, sink output.Sink, ops []port.OpenIpPort) []port.OpenIpPort {
+	var buf bytes.Buffer
+	switch sink.(type) {
+	case *output.Csv:
+		sink = output.NewCsv(&buf, false)
+	case *output.Jsonl:
+		sink = output.NewJsonl(&buf)
+	case *output.Hosts:
+		sink = output.NewHosts(&buf, false, output.ScanInfo{})
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		sink.Write(op)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ret, err := ReadResults(&buf)
+	if err != nil {
+		t.Fatalf("%T: %s\n%s", sink, err, buf.String())
+	}
+	return ret
+}
+
+func TestCompare(t *testing.T) {
+	for _, sink := range []output.Sink{&output.Csv{}, &output.Jsonl{}, &output.Hosts{}} {
+		oldOps, newOps := write(t, sink, oldResults), write(t, sink, newResults)
+		if len(oldOps) != len(oldResults) || banner(oldOps[0].Banner) != banner(oldResults[0].Banner) {
+			t.Errorf("%T: read %+v", sink, oldOps)
+		}
+		r := Compare(oldOps, newOps)
+		var text bytes.Buffer
+		if err := r.WriteText(&text); err != nil {
+			t.Fatal(err)
+		}
+		want := `[+] host 10.0.0.3
+[-] host 10.0.0.2
+[+] 10.0.0.1:3306 mysql
+[+] 10.0.0.3:21 ftp
+[-] 10.0.0.1:8080 http
+[-] 10.0.0.2:443 https
+[*] 10.0.0.1:22 ssh banner: "SSH-2.0-OpenSSH_8.9" -> "SSH-2.0-OpenSSH_9.6"
+[*] 10.0.0.1:80 (a.test) http [new] http_title: "old" -> "new"
+[*] 1 hosts appeared, 1 hosts disappeared, 2 ports opened, 2 ports closed, 2 services changed
+`
+		if text.String() != want {
+			t.Errorf("%T: got\n%s\nwant\n%s", sink, text.String(), want)
+		}
+	}
+
+	// csv中区分同一端口的TCP和UDP结果
+	mixed := write(t, &output.Csv{}, []port.OpenIpPort{
+		{Ip: net.ParseIP("10.0.0.1"), Port: 53, Service: "domain"},
+		{Ip: net.ParseIP("10.0.0.1"), Port: 53, Protocol: port.ProtocolUdp, Service: "dns"},
+	})
+	if r := Compare(nil, mixed); len(mixed) != 2 || mixed[1].Protocol != port.ProtocolUdp || len(r.Opened) != 2 {
+		t.Errorf("mixed protocols: read %+v, opened %+v", mixed, r.Opened)
+	}
+
+	if r := Compare(oldResults, oldResults); !r.Empty() {
+		t.Errorf("same results, got %+v", r)
+	}
+	if _, err := ReadResults(strings.NewReader("10.0.0.1:80\n")); err == nil {
+		t.Error("text result, want error")
+	}
+}
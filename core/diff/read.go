@@ -0,0 +1,158 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/output"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ReadResults 读取go-portScan的结果文件, 自动识别格式: jsonl、csv、hosts(按主机汇总的json)
+func ReadResults(r io.Reader) (ops []port.OpenIpPort, err error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte{0xef, 0xbb, 0xbf}) {
+		br.Discard(3) // UTF-8 BOM
+	}
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if b[0] == '{' {
+			return readJson(br)
+		}
+		return readCsv(br)
+	}
+}
+
+// readJson 每行为OpenIpPort或HostRecord的json
+func readJson(r io.Reader) (ops []port.OpenIpPort, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(line, &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if _, ok := fields["ports"]; !ok {
+			var op port.OpenIpPort
+			if err = json.Unmarshal(line, &op); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			ops = append(ops, op)
+			continue
+		}
+		var h output.HostRecord
+		if err = json.Unmarshal(line, &h); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		for _, p := range h.Ports {
+			ops = append(ops, port.OpenIpPort{
+				Ip:       h.Ip,
+				Port:     p.Port,
+				Protocol: p.Protocol,
+				State:    p.State,
+				Service:  p.Service,
+				Banner:   p.Banner,
+				HttpInfo: p.HttpInfo,
+				Host:     h.Host,
+				Url:      p.Url,
+			})
+		}
+	}
+	return ops, scanner.Err()
+}
+
+// readCsv 按表头读取csv, 兼容没有HOST、URL、PROTOCOL列的旧结果(都为tcp)和分片的SHARD列
+func readCsv(r io.Reader) (ops []port.OpenIpPort, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["IP"]; !ok {
+		return nil, errors.New("unknown result format, want jsonl, csv or hosts")
+	}
+	if _, ok := col["PORT"]; !ok {
+		return nil, errors.New("csv: missing PORT column")
+	}
+	for {
+		line, err := cr.Read()
+		if err == io.EOF {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(line) {
+				return line[i]
+			}
+			return ""
+		}
+		_port, err := strconv.ParseUint(get("PORT"), 10, 16)
+		ip := net.ParseIP(get("IP"))
+		if err != nil || ip == nil {
+			return nil, fmt.Errorf("csv: invalid line %q", line)
+		}
+		op := port.OpenIpPort{
+			Ip:       ip,
+			Port:     uint16(_port),
+			Service:  get("SERVICE"),
+			Banner:   csvBanner(get("BANNER")),
+			State:    get("STATE"),
+			Host:     get("HOST"),
+			Url:      get("URL"),
+			Protocol: strings.ToLower(get("PROTOCOL")),
+		}
+		if status := get("HTTP_STATUS"); status != "" {
+			op.HttpInfo = &port.HttpInfo{
+				Title:  get("HTTP_TITLE"),
+				Server: get("HTTP_SERVER"),
+				TlsCN:  get("HTTP_TLS"),
+				Url:    get("HTTP_URL"),
+			}
+			op.HttpInfo.StatusCode, _ = strconv.Atoi(status)
+			if fingers := get("HTTP_FINGERS"); fingers != "" {
+				op.HttpInfo.Fingers = strings.Split(fingers, ",")
+			}
+		}
+		ops = append(ops, op)
+	}
+}
+
+// csvBanner csv中的banner为转义后的字符串(保留\r\n), 还原为原始的banner
+func csvBanner(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	s = strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+	if b, err := strconv.Unquote(`"` + s + `"`); err == nil {
+		return []byte(b)
+	}
+	return []byte(s)
+}
@@ -26,19 +26,29 @@ func init() {
 
 // IsLive 判断ip是否存活
 func IsLive(ip string, tcpPing bool, tcpTimeout time.Duration) (ok bool) {
+	return LiveMethod(ip, tcpPing, tcpTimeout) != ""
+}
+
+// LiveMethod 判断ip是否存活, 返回发现存活的方式: icmp, ping, tcp-ping, 不存活时为空
+func LiveMethod(ip string, tcpPing bool, tcpTimeout time.Duration) string {
 	if CanIcmp {
-		ok = IcmpOK(ip)
-	} else {
-		ok = PingOk(ip)
+		if IcmpOK(ip) {
+			return "icmp"
+		}
+	} else if PingOk(ip) {
+		return "ping"
 	}
-	if !ok && tcpPing {
-		ok = TcpPing(ip, TcpPingPorts, tcpTimeout)
+	if tcpPing && TcpPing(ip, TcpPingPorts, tcpTimeout) {
+		return "tcp-ping"
 	}
-	return
+	return ""
 }
 
 // PingOk Ping命令模式
 func PingOk(host string) bool {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return ping6Ok(host)
+	}
 	switch runtime.GOOS {
 	case "linux":
 		cmd := exec.Command("ping", "-c", "1", "-W", "1", host)
@@ -68,6 +78,26 @@ func PingOk(host string) bool {
 	return false
 }
 
+// ping6Ok IPv6 Ping命令模式, windows的IPv6响应中没有TTL, darwin使用ping6且响应中为hlim
+func ping6Ok(host string) bool {
+	var cmd *exec.Cmd
+	var flag string
+	switch runtime.GOOS {
+	case "linux":
+		cmd, flag = exec.Command("ping", "-6", "-c", "1", "-W", "1", host), "ttl="
+	case "windows":
+		cmd, flag = exec.Command("ping", "-6", "-n", "1", "-w", "500", host), "ms"
+	case "darwin":
+		cmd, flag = exec.Command("ping6", "-c", "1", host), "hlim="
+	default:
+		return false
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Run()
+	return strings.Contains(out.String(), flag)
+}
+
 // IcmpOK 直接发ICMP包
 func IcmpOK(host string) bool {
 	pinger, err := ping.NewPinger(host)
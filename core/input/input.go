@@ -0,0 +1,245 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Parser 读取已知的开放端口, 用于只进行服务识别和Http探测
+// 自动识别格式: ip:port列表(可带域名和协议, 即go-portScan的文本结果)、nmap xml、masscan -oL/-oJ、go-portScan的json结果
+type Parser struct {
+	OnError func(line string, err error) // 无法解析的行, 为空时忽略
+	stopped bool
+}
+
+// Stop 在fn中调用, 停止读取之后的行和主机
+func (p *Parser) Stop() {
+	p.stopped = true
+}
+
+// Parse 读取开放端口, 对每个open状态的端口调用fn, 端口的Protocol为空时为tcp
+// 目标为域名时Ip为空, Host为域名
+func (p *Parser) Parse(r io.Reader, fn func(op port.OpenIpPort)) error {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte{0xef, 0xbb, 0xbf}) {
+		br.Discard(3) // UTF-8 BOM
+	}
+	// 第一个非空白字符为<时为nmap xml
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if b[0] == '<' {
+			return p.parseNmapXml(br, fn)
+		}
+		break
+	}
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for !p.stopped && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if err := parseLine(line, fn); err != nil && p.OnError != nil {
+			p.OnError(line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseLine 解析一行: masscan -oJ和go-portScan的json、masscan -oL、ip:port
+func parseLine(line string, fn func(op port.OpenIpPort)) error {
+	line = strings.Trim(line, ", \t") // masscan -oJ的行尾逗号
+	if line == "" || line == "[" || line == "]" || line[0] == '#' {
+		return nil
+	}
+	if line[0] == '{' {
+		return parseJson(line, fn)
+	}
+	fields := strings.Fields(line)
+	if len(fields) >= 4 && isProtocol(fields[1]) {
+		// masscan -oL: open tcp 80 10.0.0.1 1700000000
+		if fields[0] != port.StateOpen {
+			return nil // closed和banner
+		}
+		_port, err := strconv.ParseUint(fields[2], 10, 16)
+		ip := net.ParseIP(fields[3])
+		if err != nil || ip == nil {
+			return fmt.Errorf("invalid masscan line")
+		}
+		fn(newOpenIpPort(ip, "", uint16(_port), fields[1]))
+		return nil
+	}
+	return parseHostPort(line, fields, fn)
+}
+
+// parseHostPort 解析ip:port或host:port, 可带协议和域名, eg: 10.0.0.1:80, [fd00::1]:53/udp, 10.0.0.1:443 (a.test) https
+func parseHostPort(line string, fields []string, fn func(op port.OpenIpPort)) error {
+	hostPort, protocol, _ := strings.Cut(fields[0], "/")
+	h, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		if line[0] == '[' {
+			return nil // go-portScan的日志和[HttpInfo]行
+		}
+		return err
+	}
+	_port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || _port == 0 {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	var host string
+	if len(fields) > 1 && strings.HasPrefix(fields[1], "(") {
+		// go-portScan的文本结果: ip:port (host)/udp state service
+		host, protocol, _ = strings.Cut(strings.TrimPrefix(fields[1], "("), ")")
+		protocol = strings.TrimPrefix(protocol, "/")
+		fields = fields[1:]
+	}
+	if len(fields) > 1 && fields[1] != port.StateOpen && isState(fields[1]) {
+		return nil
+	}
+	if protocol != "" && !isProtocol(protocol) {
+		return fmt.Errorf("invalid protocol %q", protocol)
+	}
+	ip := net.ParseIP(h)
+	if ip == nil {
+		host = h
+	}
+	fn(newOpenIpPort(ip, host, uint16(_port), protocol))
+	return nil
+}
+
+// jsonLine go-portScan的json结果或masscan -oJ的一行
+type jsonLine struct {
+	Ip       string `json:"ip"`
+	Port     uint16 `json:"port"`
+	Protocol string `json:"protocol"`
+	State    string `json:"state"`
+	Host     string `json:"host"`
+	Ports    []struct {
+		Port   uint16 `json:"port"`
+		Proto  string `json:"proto"`
+		Status string `json:"status"`
+	} `json:"ports"` // masscan
+}
+
+func parseJson(line string, fn func(op port.OpenIpPort)) error {
+	var j jsonLine
+	if err := json.Unmarshal([]byte(line), &j); err != nil {
+		return err
+	}
+	ip := net.ParseIP(j.Ip)
+	if ip == nil {
+		return fmt.Errorf("invalid ip %q", j.Ip)
+	}
+	for _, p := range j.Ports {
+		if p.Status == port.StateOpen {
+			fn(newOpenIpPort(ip, "", p.Port, p.Proto))
+		}
+	}
+	if j.Port > 0 && (j.State == "" || j.State == port.StateOpen) {
+		fn(newOpenIpPort(ip, j.Host, j.Port, j.Protocol))
+	}
+	return nil
+}
+
+// nmapHost nmap xml的host, 只解析需要的部分
+type nmapHost struct {
+	Address []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Hostnames []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"hostnames>hostname"`
+	Ports []struct {
+		Protocol string `xml:"protocol,attr"`
+		PortId   uint16 `xml:"portid,attr"`
+		State    struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+	} `xml:"ports>port"`
+}
+
+// parseNmapXml 逐个解析nmap xml的host, 不一次性读入整个文件
+func (p *Parser) parseNmapXml(r io.Reader, fn func(op port.OpenIpPort)) error {
+	d := xml.NewDecoder(r)
+	d.Strict = false // nmap中断时xml不完整
+	for !p.stopped {
+		t, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != "host" {
+			continue
+		}
+		var h nmapHost
+		if err = d.DecodeElement(&h, &se); err != nil {
+			return err
+		}
+		var ip net.IP
+		for _, addr := range h.Address {
+			if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+				ip = net.ParseIP(addr.Addr)
+			}
+		}
+		if ip == nil {
+			continue
+		}
+		// 扫描目标为域名时, 使用域名作为Http Host头和TLS SNI
+		var host string
+		for _, name := range h.Hostnames {
+			if name.Type == "user" {
+				host = name.Name
+			}
+		}
+		for _, hp := range h.Ports {
+			if hp.State.State == port.StateOpen {
+				fn(newOpenIpPort(ip, host, hp.PortId, hp.Protocol))
+			}
+		}
+	}
+	return nil
+}
+
+func newOpenIpPort(ip net.IP, host string, _port uint16, protocol string) port.OpenIpPort {
+	protocol = strings.ToLower(protocol)
+	if protocol == port.ProtocolTcp {
+		protocol = ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return port.OpenIpPort{Ip: ip, Port: _port, Protocol: protocol, Host: strings.TrimSuffix(strings.ToLower(host), "."), State: port.StateOpen}
+}
+
+func isProtocol(s string) bool {
+	s = strings.ToLower(s)
+	return s == port.ProtocolTcp || s == port.ProtocolUdp || s == port.ProtocolSctp
+}
+
+func isState(s string) bool {
+	switch s {
+	case port.StateOpen, port.StateClosed, port.StateFiltered, port.StateUnfiltered, port.StateOpenFiltered:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package input
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"strings"
+	"testing"
+)
+
+func parseAll(t *testing.T, s string) (ret []string, errLines []string) {
+	p := &Parser{OnError: func(line string, err error) {
+		errLines = append(errLines, line)
+	}}
+	err := p.Parse(strings.NewReader(s), func(op port.OpenIpPort) {
+		ret = append(ret, op.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"plain", "10.0.0.1:80\n\n# comment\n[fd00::1]:53/udp\nA.test.:443\n", []string{"10.0.0.1:80", "[fd00::1]:53/udp", "<nil>:443 (a.test)"}},
+		{"go-portScan text", "10.0.0.1:80 http\n[HttpInfo]http://10.0.0.1 StatusCode:200\n10.0.0.1:443 (a.test) https\n10.0.0.1:53/udp dns\n10.0.0.1:22 closed\n[*] elapsed time: 1s\n",
+			[]string{"10.0.0.1:80", "10.0.0.1:443 (a.test)", "10.0.0.1:53/udp"}},
+		{"go-portScan json", `{"ip":"10.0.0.1","port":80,"state":"open","service":"http"}` + "\n" + `{"ip":"10.0.0.1","port":53,"protocol":"udp","host":"a.test"}` + "\n" + `{"ip":"10.0.0.1","port":22,"state":"filtered"}`,
+			[]string{"10.0.0.1:80", "10.0.0.1:53 (a.test)/udp"}},
+		{"masscan -oL", "#masscan\nopen tcp 80 10.0.0.1 1700000000\nopen udp 53 10.0.0.2 1700000000\nbanner tcp 80 10.0.0.1 1700000000 http Server: x\n# end\n",
+			[]string{"10.0.0.1:80", "10.0.0.2:53/udp"}},
+		{"masscan -oJ", `[
+{   "ip": "10.0.0.1",   "timestamp": "1700000000", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.0.0.1",   "timestamp": "1700000000", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "http", "banner": "x"} } ] },
+{   "ip": "fd00::1",   "timestamp": "1700000000", "ports": [ {"port": 22, "proto": "tcp", "status": "open"} ] }
+]`, []string{"10.0.0.1:80", "[fd00::1]:22"}},
+		{"nmap xml", `
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap" args="nmap -sV a.test 10.0.0.2">
+<host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/><address addr="00:11:22:33:44:55" addrtype="mac"/>
+<hostnames><hostname name="a.test" type="user"/><hostname name="x.a.test" type="PTR"/></hostnames>
+<ports><extraports state="closed" count="997"/>
+<port protocol="tcp" portid="80"><state state="open" reason="syn-ack"/><service name="http"/></port>
+<port protocol="tcp" portid="81"><state state="filtered" reason="no-response"/></port>
+<port protocol="udp" portid="161"><state state="open" reason="udp-response"/></port>
+</ports></host>
+<host><address addr="10.0.0.2" addrtype="ipv4"/><ports><port protocol="tcp" portid="22"><state state="open"/></port></ports></host>
+<runstats><finished time="1"/></runstats>
+</nmaprun>`, []string{"10.0.0.1:80 (a.test)", "10.0.0.1:161 (a.test)/udp", "10.0.0.2:22"}},
+	}
+	for _, tt := range tests {
+		got, errLines := parseAll(t, tt.in)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(errLines) > 0 {
+			t.Errorf("%s: got %q, want %q, error lines %q", tt.name, got, tt.want, errLines)
+		}
+	}
+
+	_, errLines := parseAll(t, "10.0.0.1\n10.0.0.1:0\n10.0.0.1:80/icmp\n{bad json\n10.0.0.1:80\n")
+	if len(errLines) != 4 {
+		t.Errorf("error lines = %q, want 4", errLines)
+	}
+}
+
+func TestParserStop(t *testing.T) {
+	for _, in := range []string{
+		"10.0.0.1:80\n10.0.0.2:80\n10.0.0.3:80\n",
+		`<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open"/></port></ports></host>
+<host><address addr="10.0.0.2" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open"/></port></ports></host></nmaprun>`,
+	} {
+		var n int
+		p := &Parser{}
+		err := p.Parse(strings.NewReader(in), func(op port.OpenIpPort) {
+			n++
+			p.Stop()
+		})
+		if err != nil || n != 1 {
+			t.Errorf("stop: %d ports, err %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package output
+
+import (
+	"encoding/csv"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CsvHeader csv的列, 分片扫描时最后增加SHARD列
+var CsvHeader = []string{"IP", "PORT", "SERVICE", "BANNER", "HTTP_TITLE", "HTTP_STATUS", "HTTP_SERVER", "HTTP_TLS", "HTTP_URL", "HTTP_FINGERS", "STATE", "HOST", "URL", "PROTOCOL"}
+
+// Csv csv输出, 空文件时写入表头, 每条结果写入后即Flush
+type Csv struct {
+	dest
+	shard bool
+	cw    *csv.Writer
+}
+
+// NewCsv 输出到w的csv输出, shard为是否增加SHARD列
+func NewCsv(w io.Writer, shard bool) *Csv {
+	return &Csv{dest: dest{w: w}, shard: shard}
+}
+
+func (c *Csv) Open() error {
+	empty, err := c.open()
+	if err != nil {
+		return err
+	}
+	c.cw = csv.NewWriter(c.w)
+	if empty {
+		header := CsvHeader
+		if c.shard {
+			header = append(header[:len(header):len(header)], "SHARD")
+		}
+		c.cw.Write(header)
+	}
+	return nil
+}
+
+func (c *Csv) Write(op port.OpenIpPort) error {
+	protocol := op.Protocol
+	if protocol == "" {
+		protocol = port.ProtocolTcp
+	}
+	line := []string{op.Ip.String(), strconv.Itoa(int(op.Port)), op.Service, "", "", "", "", "", "", "", op.State, op.Host, op.Url, protocol}
+	line[3] = strings.NewReplacer("\\r", "\r", "\\n", "\n").Replace(strings.Trim(strconv.Quote(string(op.Banner)), "\""))
+	if op.HttpInfo != nil {
+		line[4] = op.HttpInfo.Title
+		line[5] = strconv.Itoa(op.HttpInfo.StatusCode)
+		line[6] = op.HttpInfo.Server
+		line[7] = op.HttpInfo.TlsCN
+		line[8] = op.HttpInfo.Url
+		line[9] = strings.Join(op.HttpInfo.Fingers, ",")
+	}
+	if c.shard {
+		line = append(line, op.Shard)
+	}
+	c.cw.Write(line)
+	return c.Flush()
+}
+
+func (c *Csv) Flush() error {
+	if c.cw == nil {
+		return nil
+	}
+	c.cw.Flush()
+	if err := c.cw.Error(); err != nil {
+		return err
+	}
+	return c.sync()
+}
+
+func (c *Csv) Close() error {
+	if err := c.Flush(); err != nil {
+		c.close()
+		return err
+	}
+	return c.close()
+}
@@ -0,0 +1,317 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// HostRecord 按主机汇总的结果
+type HostRecord struct {
+	Ip        net.IP     `json:"ip"`
+	Host      string     `json:"host,omitempty"`      // 目标域名
+	Discovery string     `json:"discovery,omitempty"` // 发现方式: icmp, ping, tcp-ping, 未进行存活探测时为扫描类型
+	FirstSeen time.Time  `json:"first_seen"`          // 第一个端口结果的时间
+	LastSeen  time.Time  `json:"last_seen"`           // 最后一个端口结果的时间
+	Ports     []HostPort `json:"ports"`
+}
+
+// HostPort 主机的一个端口
+type HostPort struct {
+	Port     uint16         `json:"port"`
+	Protocol string         `json:"protocol"`
+	State    string         `json:"state"`
+	Service  string         `json:"service"`
+	Banner   []byte         `json:"banner,omitempty"`
+	HttpInfo *port.HttpInfo `json:"http_info,omitempty"`
+	Url      string         `json:"url,omitempty"`
+	info     string         // 从表格中读取的INFO列
+}
+
+// Hosts 按主机汇总输出, 每个主机一条记录
+// 同一IP的端口按置换顺序分散在窗口的扫描中, 服务识别也可能晚于其它IP的结果, 所以结果先缓存, Close时输出;
+// 恢复扫描时读取原文件中的主机, 与新的结果合并后覆盖原文件
+type Hosts struct {
+	dest
+	table bool // 文本表格, 否则为json lines
+	info  ScanInfo
+	hosts map[string]*HostRecord // ip+域名
+	order []string               // 主机出现的顺序
+}
+
+// NewHosts 输出到w的主机汇总输出, table为true时输出文本表格
+func NewHosts(w io.Writer, table bool, info ScanInfo) *Hosts {
+	return &Hosts{dest: dest{w: w}, table: table, info: info}
+}
+
+func (h *Hosts) Open() error {
+	h.hosts = make(map[string]*HostRecord)
+	if h.append && h.path != "" && h.path != "-" {
+		// 恢复扫描, 读取原结果
+		b, err := os.ReadFile(h.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var records []*HostRecord
+		if h.table {
+			records, err = readTable(b)
+		} else {
+			records, err = readHostRecords(b)
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %s", h.path, err)
+		}
+		for _, r := range records {
+			key := r.Ip.String() + " " + r.Host
+			if _, ok := h.hosts[key]; !ok {
+				h.order = append(h.order, key)
+			}
+			h.hosts[key] = r
+		}
+	}
+	h.append = true // 不清空原文件, Close时覆盖
+	_, err := h.open()
+	return err
+}
+
+func (h *Hosts) Write(op port.OpenIpPort) error {
+	protocol, state := op.Protocol, op.State
+	if protocol == "" {
+		protocol = port.ProtocolTcp
+	}
+	if state == "" {
+		state = port.StateOpen
+	}
+	now := time.Now()
+	key := op.Ip.String() + " " + op.Host
+	r, ok := h.hosts[key]
+	if !ok {
+		r = &HostRecord{Ip: op.Ip, Host: op.Host, Discovery: h.discovery(op.Ip, protocol), FirstSeen: now}
+		h.hosts[key] = r
+		h.order = append(h.order, key)
+	}
+	r.LastSeen = now
+	p := HostPort{
+		Port:     op.Port,
+		Protocol: protocol,
+		State:    state,
+		Service:  op.Service,
+		Banner:   op.Banner,
+		HttpInfo: op.HttpInfo,
+		Url:      op.Url,
+	}
+	for i := range r.Ports {
+		// 恢复扫描时重新识别的端口替换原结果
+		if r.Ports[i].Port == p.Port && r.Ports[i].Protocol == p.Protocol && r.Ports[i].Url == p.Url {
+			r.Ports[i] = p
+			return nil
+		}
+	}
+	r.Ports = append(r.Ports, p)
+	return nil
+}
+
+// discovery 主机的发现方式, 没有存活探测的结果时为扫描类型
+func (h *Hosts) discovery(ip net.IP, protocol string) string {
+	if h.info.Discovery != nil {
+		if d := h.info.Discovery(ip); d != "" {
+			return d
+		}
+	}
+	if protocol != port.ProtocolTcp {
+		return protocol
+	}
+	if h.info.TcpType == "" {
+		return "syn"
+	}
+	return h.info.TcpType
+}
+
+func (h *Hosts) writeRecord(r *HostRecord) error {
+	if !h.table {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = h.w.Write(append(b, '\n'))
+		return err
+	}
+	name := r.Ip.String()
+	if r.Host != "" {
+		name += " (" + r.Host + ")"
+	}
+	fmt.Fprintf(h.w, "%s  discovery: %s  first: %s  last: %s  ports: %d\n", name, r.Discovery,
+		r.FirstSeen.Format(tableTime), r.LastSeen.Format(tableTime), len(r.Ports))
+	tw := tabwriter.NewWriter(h.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PORT\tSTATE\tSERVICE\tINFO")
+	for _, p := range r.Ports {
+		fmt.Fprintf(tw, "  %d/%s\t%s\t%s\t%s\n", p.Port, p.Protocol, p.State, p.Service, portInfo(p))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(h.w, "\n")
+	return err
+}
+
+// portInfo 表格的INFO列: Http的状态码、标题、Server和指纹, 或Banner的第一行
+func portInfo(p HostPort) string {
+	if p.info != "" {
+		return p.info
+	}
+	var info []string
+	if p.Url != "" {
+		info = append(info, p.Url)
+	}
+	if hi := p.HttpInfo; hi != nil {
+		info = append(info, "["+strconv.Itoa(hi.StatusCode)+"]")
+		if hi.Title != "" {
+			info = append(info, hi.Title)
+		}
+		if hi.Server != "" {
+			info = append(info, "Server:"+hi.Server)
+		}
+		if hi.TlsCN != "" {
+			info = append(info, "CN:"+hi.TlsCN)
+		}
+		if len(hi.Fingers) > 0 {
+			info = append(info, "Fingers:"+strings.Join(hi.Fingers, ","))
+		}
+	} else if len(p.Banner) > 0 {
+		banner, _, _ := strings.Cut(string(p.Banner), "\n")
+		banner = strings.Trim(strconv.Quote(strings.TrimSpace(banner)), "\"")
+		if len(banner) > 60 {
+			banner = banner[:60] + "..."
+		}
+		info = append(info, banner)
+	}
+	return strings.Join(info, " ")
+}
+
+// tableTime 表格中的时间格式
+const tableTime = "2006-01-02 15:04:05"
+
+// readHostRecords 读取每行一个主机的json
+func readHostRecords(b []byte) (records []*HostRecord, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		r := new(HostRecord)
+		if err = json.Unmarshal(line, r); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// readTable 读取writeRecord输出的文本表格, INFO列原样保留
+func readTable(b []byte) (records []*HostRecord, err error) {
+	var r *HostRecord
+	var cols []int // STATE、SERVICE、INFO列的位置
+	lines := strings.Split(string(b), "\n")
+	for n, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			r, cols = nil, nil
+		case r == nil:
+			if r, err = readTableHost(line); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n+1, err)
+			}
+			records = append(records, r)
+		case cols == nil:
+			for _, name := range []string{"STATE", "SERVICE", "INFO"} {
+				i := strings.Index(line, name)
+				if i < 0 || (len(cols) > 0 && i < cols[len(cols)-1]) {
+					return nil, fmt.Errorf("line %d: invalid table header", n+1)
+				}
+				cols = append(cols, i)
+			}
+		default:
+			cell := func(i int) string {
+				start, end := 0, len(line)
+				if i > 0 {
+					start = cols[i-1]
+				}
+				if i < len(cols) && cols[i] < end {
+					end = cols[i]
+				}
+				if start >= end {
+					return ""
+				}
+				return strings.TrimSpace(line[start:end])
+			}
+			portStr, protocol, _ := strings.Cut(cell(0), "/")
+			_port, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil || protocol == "" {
+				return nil, fmt.Errorf("line %d: invalid port %q", n+1, cell(0))
+			}
+			r.Ports = append(r.Ports, HostPort{Port: uint16(_port), Protocol: protocol, State: cell(1), Service: cell(2), info: cell(3)})
+		}
+	}
+	return
+}
+
+// readTableHost 读取表格的主机行, eg: 10.0.0.1 (a.test)  discovery: icmp  first: ...  last: ...  ports: 2
+func readTableHost(line string) (r *HostRecord, err error) {
+	name, rest, ok := strings.Cut(line, "  discovery: ")
+	discovery, rest, ok2 := strings.Cut(rest, "  first: ")
+	first, rest, ok3 := strings.Cut(rest, "  last: ")
+	last, _, ok4 := strings.Cut(rest, "  ports: ")
+	if !ok || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("invalid host line")
+	}
+	r = &HostRecord{Discovery: discovery}
+	ip, host, _ := strings.Cut(name, " (")
+	if r.Ip = net.ParseIP(ip); r.Ip == nil {
+		return nil, fmt.Errorf("invalid ip %q", ip)
+	}
+	r.Host = strings.TrimSuffix(host, ")")
+	if r.FirstSeen, err = time.ParseInLocation(tableTime, first, time.Local); err != nil {
+		return nil, err
+	}
+	if r.LastSeen, err = time.ParseInLocation(tableTime, last, time.Local); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (h *Hosts) Flush() error {
+	return h.sync()
+}
+
+// Close 按主机出现的顺序输出所有主机
+func (h *Hosts) Close() error {
+	if h.hosts == nil {
+		return nil
+	}
+	var err error
+	if h.file != nil {
+		err = h.file.Truncate(0)
+	}
+	for _, key := range h.order {
+		if err2 := h.writeRecord(h.hosts[key]); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	h.order, h.hosts = nil, nil
+	if err2 := h.close(); err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"encoding/json"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+)
+
+// Jsonl json lines输出, 每行为一条结果的json
+type Jsonl struct {
+	dest
+}
+
+// NewJsonl 输出到w的json lines输出
+func NewJsonl(w io.Writer) *Jsonl {
+	return &Jsonl{dest: dest{w: w}}
+}
+
+func (j *Jsonl) Open() error {
+	_, err := j.open()
+	return err
+}
+
+func (j *Jsonl) Write(op port.OpenIpPort) error {
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+func (j *Jsonl) Flush() error {
+	return j.sync()
+}
+
+func (j *Jsonl) Close() error {
+	return j.close()
+}
@@ -0,0 +1,422 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanInfo 扫描信息, 用于nmap xml的nmaprun、scaninfo和runstats, 以及主机汇总的发现方式
+type ScanInfo struct {
+	Args      string                   // 命令行参数
+	Start     time.Time                // 开始时间, 为空时为Open的时间
+	TcpType   string                   // TCP的扫描类型: syn, connect, ack, fin, null, xmas, window, 为空时为syn
+	Ports     port.PortList            // 扫描的端口
+	Discovery func(ip net.IP) string   // IP的存活探测方式, 为空时使用扫描类型
+	HostCount func() (total, live int) // 扫描的IP数和存活的IP数, live<0为未进行存活探测, 为空时按结果中的主机计算
+}
+
+// NmapXml nmap xml输出, 可用于Metasploit db_import等工具
+// 同一IP的结果不连续, 所以结果先缓存, Close时写入; 追加时合并原文件中的主机
+type NmapXml struct {
+	dest
+	info  ScanInfo
+	run   nmapRun
+	hosts map[string]*nmapHost // ip+域名
+}
+
+// NewNmapXml 输出到w的nmap xml输出
+func NewNmapXml(w io.Writer, info ScanInfo) *NmapXml {
+	return &NmapXml{dest: dest{w: w}, info: info}
+}
+
+type nmapRun struct {
+	XMLName          xml.Name       `xml:"nmaprun"`
+	Scanner          string         `xml:"scanner,attr"`
+	Args             string         `xml:"args,attr"`
+	Start            int64          `xml:"start,attr"`
+	StartStr         string         `xml:"startstr,attr"`
+	Version          string         `xml:"version,attr"`
+	XmlOutputVersion string         `xml:"xmloutputversion,attr"`
+	ScanInfo         []nmapScanInfo `xml:"scaninfo"`
+	Verbose          nmapLevel      `xml:"verbose"`
+	Debugging        nmapLevel      `xml:"debugging"`
+	Hosts            []*nmapHost    `xml:"host"`
+	RunStats         nmapRunStats   `xml:"runstats"`
+}
+
+type nmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type nmapLevel struct {
+	Level int `xml:"level,attr"`
+}
+
+type nmapHost struct {
+	StartTime int64        `xml:"starttime,attr"`
+	EndTime   int64        `xml:"endtime,attr"`
+	Status    nmapStatus   `xml:"status"`
+	Address   nmapAddress  `xml:"address"`
+	Hostnames nmapHostname `xml:"hostnames"`
+	Ports     []*nmapPort  `xml:"ports>port"`
+}
+
+type nmapStatus struct {
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr"`
+	ReasonTTL int    `xml:"reason_ttl,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type nmapHostname struct {
+	Hostname []nmapName `xml:"hostname"`
+}
+
+type nmapName struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortId   uint16       `xml:"portid,attr"`
+	State    nmapStatus   `xml:"state"`
+	Service  *nmapService `xml:"service"`
+	Scripts  []nmapScript `xml:"script"`
+}
+
+type nmapService struct {
+	Name      string `xml:"name,attr"`
+	Product   string `xml:"product,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+	Tunnel    string `xml:"tunnel,attr,omitempty"`
+	Method    string `xml:"method,attr"`
+	Conf      int    `xml:"conf,attr"`
+}
+
+type nmapScript struct {
+	Id     string `xml:"id,attr"`
+	Output string `xml:"output,attr"`
+}
+
+type nmapRunStats struct {
+	Finished nmapFinished `xml:"finished"`
+	Hosts    nmapHosts    `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr"`
+	Elapsed string `xml:"elapsed,attr"`
+	Summary string `xml:"summary,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+type nmapHosts struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+func (n *NmapXml) Open() (err error) {
+	n.hosts = make(map[string]*nmapHost)
+	if n.info.Start.IsZero() {
+		n.info.Start = time.Now()
+	}
+	if n.append && n.path != "" && n.path != "-" {
+		// 恢复扫描, 读取原结果
+		b, err := os.ReadFile(n.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(b) > 0 {
+			var run nmapRun
+			if err = xml.Unmarshal(b, &run); err != nil {
+				return fmt.Errorf("read %s: %s", n.path, err)
+			}
+			if run.Start > 0 {
+				n.info.Start = time.Unix(run.Start, 0)
+			}
+			for _, h := range run.Hosts {
+				n.hosts[hostKey(h)] = h
+				n.run.Hosts = append(n.run.Hosts, h)
+			}
+		}
+	}
+	n.append = true // 不清空原文件, Close时覆盖
+	_, err = n.open()
+	return
+}
+
+func hostKey(h *nmapHost) string {
+	key := h.Address.Addr
+	for _, name := range h.Hostnames.Hostname {
+		key += " " + name.Name
+	}
+	return key
+}
+
+func (n *NmapXml) Write(op port.OpenIpPort) error {
+	now := time.Now().Unix()
+	h := &nmapHost{
+		StartTime: now,
+		Address:   nmapAddress{Addr: op.Ip.String(), AddrType: "ipv4"},
+	}
+	if op.Ip.To4() == nil {
+		h.Address.AddrType = "ipv6"
+	}
+	if op.Host != "" {
+		h.Hostnames.Hostname = []nmapName{{Name: op.Host, Type: "user"}}
+	}
+	if h2, ok := n.hosts[hostKey(h)]; ok {
+		h = h2
+	} else {
+		n.hosts[hostKey(h)] = h
+		n.run.Hosts = append(n.run.Hosts, h)
+	}
+	h.EndTime = now
+
+	p := n.port(op)
+	for i, p2 := range h.Ports {
+		if p2.Protocol == p.Protocol && p2.PortId == p.PortId {
+			h.Ports[i] = p
+			return nil
+		}
+	}
+	h.Ports = append(h.Ports, p)
+	return nil
+}
+
+// port 结果转为nmap的port
+func (n *NmapXml) port(op port.OpenIpPort) *nmapPort {
+	protocol := op.Protocol
+	if protocol == "" {
+		protocol = port.ProtocolTcp
+	}
+	state := op.State
+	if state == "" {
+		state = port.StateOpen
+	}
+	p := &nmapPort{
+		Protocol: protocol,
+		PortId:   op.Port,
+		State:    nmapStatus{State: state, Reason: stateReason(protocol, state)},
+	}
+	if op.Service != "" {
+		p.Service = &nmapService{Name: op.Service, Method: "probed", Conf: 10}
+		if op.Service == "https" {
+			p.Service.Name = "http"
+			p.Service.Tunnel = "ssl"
+		}
+		p.Service.Product, p.Service.Version, p.Service.ExtraInfo = productVersion(op)
+	}
+	if hi := op.HttpInfo; hi != nil {
+		if hi.Title != "" {
+			p.Scripts = append(p.Scripts, nmapScript{Id: "http-title", Output: hi.Title})
+		}
+		if hi.Server != "" {
+			p.Scripts = append(p.Scripts, nmapScript{Id: "http-server-header", Output: hi.Server})
+		}
+		if hi.TlsCN != "" || len(hi.TlsDNS) > 0 {
+			output := "Subject: commonName=" + hi.TlsCN
+			if len(hi.TlsDNS) > 0 {
+				output += "\nSubject Alternative Name: DNS:" + strings.Join(hi.TlsDNS, ", DNS:")
+			}
+			p.Scripts = append(p.Scripts, nmapScript{Id: "ssl-cert", Output: output})
+		}
+		if len(hi.Fingers) > 0 {
+			p.Scripts = append(p.Scripts, nmapScript{Id: "http-fingers", Output: strings.Join(hi.Fingers, ", ")})
+		}
+	} else if len(op.Banner) > 0 {
+		banner := strings.Trim(strconv.Quote(string(op.Banner)), "\"")
+		p.Scripts = append(p.Scripts, nmapScript{Id: "banner", Output: banner})
+	}
+	return p
+}
+
+// hostStatus 主机状态: 存活探测发现的主机或有端口响应(open, closed)时为up, 否则为unknown
+func (n *NmapXml) hostStatus(h *nmapHost) nmapStatus {
+	if n.info.Discovery != nil {
+		switch n.info.Discovery(net.ParseIP(h.Address.Addr)) {
+		case "":
+		case "icmp", "ping":
+			return nmapStatus{State: "up", Reason: "echo-reply"}
+		case "tcp-ping":
+			return nmapStatus{State: "up", Reason: "tcp-response"}
+		default:
+			return nmapStatus{State: "up", Reason: "user-set"} // 指纹识别模式和url模式的输入
+		}
+	}
+	for _, p := range h.Ports {
+		if p.State.Reason != "no-response" {
+			return nmapStatus{State: "up", Reason: p.State.Reason}
+		}
+	}
+	return nmapStatus{State: "unknown", Reason: "no-response"}
+}
+
+// stateReason 端口状态的原因, 与nmap相同
+func stateReason(protocol, state string) string {
+	switch state {
+	case port.StateOpen:
+		switch protocol {
+		case port.ProtocolUdp:
+			return "udp-response"
+		case port.ProtocolSctp:
+			return "init-ack"
+		}
+		return "syn-ack"
+	case port.StateClosed, port.StateUnfiltered:
+		if protocol == port.ProtocolSctp {
+			return "abort"
+		}
+		return "reset"
+	}
+	return "no-response"
+}
+
+// productVersion 从Http Server头或SSH banner中提取产品和版本, eg: nginx/1.18.0 (Ubuntu), SSH-2.0-OpenSSH_8.2p1 Ubuntu-4
+func productVersion(op port.OpenIpPort) (product, version, extraInfo string) {
+	var s, sep string
+	if op.HttpInfo != nil && op.HttpInfo.Server != "" {
+		s, sep = op.HttpInfo.Server, "/"
+	} else if strings.HasPrefix(string(op.Banner), "SSH-") {
+		s = strings.TrimSpace(strings.SplitN(string(op.Banner), "\n", 2)[0])
+		if i := strings.Index(s[4:], "-"); i >= 0 {
+			s = s[4+i+1:]
+		}
+		sep = "_"
+	} else {
+		return
+	}
+	s, extraInfo, _ = strings.Cut(s, " ")
+	extraInfo = strings.Trim(extraInfo, "() ")
+	product, version, _ = strings.Cut(s, sep)
+	return
+}
+
+func (n *NmapXml) Flush() error {
+	return nil
+}
+
+func (n *NmapXml) Close() error {
+	if n.w == nil {
+		return nil
+	}
+	end := time.Now()
+	n.run.Scanner = "nmap" // 兼容nmap的解析工具
+	n.run.Version = "7.94"
+	n.run.XmlOutputVersion = "1.05"
+	n.run.Args = n.info.Args
+	n.run.Start = n.info.Start.Unix()
+	n.run.StartStr = n.info.Start.Format(time.ANSIC)
+	tcpType := n.info.TcpType
+	if tcpType == "" {
+		tcpType = "syn"
+	}
+	for protocol, scanType := range map[string]string{port.ProtocolTcp: tcpType, port.ProtocolUdp: "udp", port.ProtocolSctp: "sctpinit"} {
+		if ports := n.info.Ports.Ports(protocol); len(ports) > 0 {
+			n.run.ScanInfo = append(n.run.ScanInfo, nmapScanInfo{Type: scanType, Protocol: protocol, NumServices: len(ports), Services: portRanges(ports)})
+		}
+	}
+	sort.Slice(n.run.ScanInfo, func(i, j int) bool { return n.run.ScanInfo[i].Protocol < n.run.ScanInfo[j].Protocol })
+	for _, h := range n.run.Hosts {
+		sort.Slice(h.Ports, func(i, j int) bool {
+			if h.Ports[i].Protocol != h.Ports[j].Protocol {
+				return h.Ports[i].Protocol < h.Ports[j].Protocol
+			}
+			return h.Ports[i].PortId < h.Ports[j].PortId
+		})
+	}
+	up := 0
+	for _, h := range n.run.Hosts {
+		if h.Status.State == "" {
+			h.Status = n.hostStatus(h)
+		}
+		if h.Status.State == "up" {
+			up++
+		}
+	}
+	total := len(n.run.Hosts)
+	if n.info.HostCount != nil {
+		_total, live := n.info.HostCount()
+		if live >= 0 {
+			up = live // 存活但没有结果的IP也为up
+		}
+		if _total > total {
+			total = _total
+		}
+	}
+	if up > total {
+		total = up
+	}
+	elapsed := end.Sub(n.info.Start).Seconds()
+	n.run.RunStats = nmapRunStats{
+		Finished: nmapFinished{
+			Time:    end.Unix(),
+			TimeStr: end.Format(time.ANSIC),
+			Elapsed: fmt.Sprintf("%.2f", elapsed),
+			Summary: fmt.Sprintf("Nmap done at %s; %d IP addresses (%d hosts up) scanned in %.2f seconds", end.Format(time.ANSIC), total, up, elapsed),
+			Exit:    "success",
+		},
+		Hosts: nmapHosts{Up: up, Down: total - up, Total: total},
+	}
+
+	b, err := xml.MarshalIndent(n.run, "", "  ")
+	if err == nil && n.file != nil {
+		err = n.file.Truncate(0)
+	}
+	if err == nil {
+		_, err = io.WriteString(n.w, xml.Header+"<!DOCTYPE nmaprun>\n<!-- go-portScan -->\n"+string(b)+"\n")
+	}
+	if err == nil {
+		err = n.sync()
+	}
+	if err2 := n.close(); err == nil {
+		err = err2
+	}
+	n.w = nil
+	return err
+}
+
+// portRanges 端口转为有序的范围, eg: 21-23,80
+func portRanges(ports []uint16) string {
+	sorted := make([]int, len(ports))
+	for i, p := range ports {
+		sorted[i] = int(p)
+	}
+	sort.Ints(sorted)
+	var buf strings.Builder
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if buf.Len() > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(strconv.Itoa(sorted[i]))
+		if sorted[j] != sorted[i] {
+			buf.WriteString("-")
+			buf.WriteString(strconv.Itoa(sorted[j]))
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
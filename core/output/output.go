@@ -0,0 +1,167 @@
+package output
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sink 扫描结果输出
+type Sink interface {
+	Open() error                    // 打开输出, 如创建文件、写入表头
+	Write(op port.OpenIpPort) error // 写入一条结果
+	Flush() error                   // 将已写入的结果落盘
+	Close() error                   // Flush并关闭输出
+}
+
+// Option 输出参数
+type Option struct {
+	Append bool     // 追加到已有文件, 用于恢复扫描
+	Shard  bool     // 分片扫描, csv增加SHARD列
+	Info   ScanInfo // 扫描信息, 用于nmap xml
+}
+
+// 输出格式
+const (
+	FormatText  = "text"
+	FormatJsonl = "jsonl"
+	FormatCsv   = "csv"
+	FormatXml   = "xml"   // nmap xml
+	FormatHosts = "hosts" // 按主机汇总的json lines
+	FormatTable = "table" // 按主机汇总的文本表格
+)
+
+// Formats 支持的输出格式
+var Formats = []string{FormatText, FormatJsonl, FormatCsv, FormatXml, FormatHosts, FormatTable}
+
+// ParseSpec 解析输出参数, eg: "csv:out.csv", 没有格式前缀时format为空
+// 前缀为单个字母时为Windows盘符, eg: "C:\out.txt"
+func ParseSpec(spec string) (format, path string) {
+	if f, p, ok := strings.Cut(spec, ":"); ok && len(f) > 1 && isLetters(f) {
+		format = strings.ToLower(f)
+		if format == "json" {
+			format = FormatJsonl
+		}
+		return format, p
+	}
+	return "", spec
+}
+
+func isLetters(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// New 按格式新建输出, path为空或"-"时输出到标准输出
+func New(format, path string, option Option) (Sink, error) {
+	d := dest{path: path, append: option.Append}
+	switch format {
+	case FormatText:
+		return &Text{dest: d}, nil
+	case FormatJsonl:
+		return &Jsonl{dest: d}, nil
+	case FormatCsv:
+		return &Csv{dest: d, shard: option.Shard}, nil
+	case FormatXml:
+		return &NmapXml{dest: d, info: option.Info}, nil
+	case FormatHosts, FormatTable:
+		return &Hosts{dest: d, table: format == FormatTable, info: option.Info}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, want %s", format, strings.Join(Formats, ", "))
+}
+
+// dest 输出目标, 文件或io.Writer
+type dest struct {
+	path   string
+	append bool
+	w      io.Writer
+	file   *os.File
+}
+
+// open 打开文件, 返回文件是否为空
+func (d *dest) open() (empty bool, err error) {
+	if d.w != nil {
+		return true, nil
+	}
+	if d.path == "" || d.path == "-" {
+		d.w = os.Stdout
+		return true, nil
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if d.append {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	d.file, err = os.OpenFile(d.path, flag, 0644)
+	if err != nil {
+		return
+	}
+	d.w = d.file
+	fi, err := d.file.Stat()
+	if err != nil {
+		d.file.Close()
+		return
+	}
+	return fi.Size() == 0, nil
+}
+
+func (d *dest) sync() error {
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Sync()
+}
+
+func (d *dest) close() error {
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
+// Multi 同时写入多个输出, 返回第一个错误
+type Multi []Sink
+
+func (m Multi) Open() error {
+	for i, s := range m {
+		if err := s.Open(); err != nil {
+			for _, opened := range m[:i] {
+				opened.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m Multi) Write(op port.OpenIpPort) (err error) {
+	for _, s := range m {
+		if err2 := s.Write(op); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return
+}
+
+func (m Multi) Flush() (err error) {
+	for _, s := range m {
+		if err2 := s.Flush(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return
+}
+
+func (m Multi) Close() (err error) {
+	for _, s := range m {
+		if err2 := s.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return
+}
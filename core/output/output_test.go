@@ -0,0 +1,341 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testResults = []port.OpenIpPort{
+	{Ip: net.ParseIP("10.0.0.1"), Port: 80, Service: "http", Banner: []byte("HTTP/1.1 200 OK\r\n"), Host: "a.test",
+		HttpInfo: &port.HttpInfo{StatusCode: 200, Title: "t", Url: "http://a.test", Fingers: []string{"nginx", "php"}}},
+	{Ip: net.ParseIP("10.0.0.2"), Port: 22, State: port.StateClosed, Shard: "1/2"},
+}
+
+func TestParseSpec(t *testing.T) {
+	for spec, want := range map[string][2]string{
+		"csv:out.csv":     {FormatCsv, "out.csv"},
+		"JSON:out.json":   {FormatJsonl, "out.json"},
+		"jsonl:a:b.json":  {FormatJsonl, "a:b.json"},
+		"text:-":          {FormatText, "-"},
+		"out.txt":         {"", "out.txt"},
+		"XML:out.xml":     {FormatXml, "out.xml"},
+		"pdf:out.pdf":     {"pdf", "out.pdf"},
+		`C:\scan\out.txt`: {"", `C:\scan\out.txt`},
+	} {
+		format, path := ParseSpec(spec)
+		if format != want[0] || path != want[1] {
+			t.Errorf("ParseSpec(%q) = %q, %q, want %q, %q", spec, format, path, want[0], want[1])
+		}
+	}
+	if _, err := New("pdf", "", Option{}); err == nil {
+		t.Error("New unknown format, want error")
+	}
+}
+
+func TestSinks(t *testing.T) {
+	var text, jsonl, csvBuf bytes.Buffer
+	sinks := Multi{NewText(&text), NewJsonl(&jsonl), NewCsv(&csvBuf, true)}
+	if err := sinks.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range testResults {
+		if err := sinks.Write(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sinks.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Count(text.String(), "\n"); got != 3 { // HttpInfo另起一行
+		t.Errorf("text lines = %d, want 3:\n%s", got, text.String())
+	}
+	if !strings.HasPrefix(text.String(), testResults[0].String()+"\n") {
+		t.Errorf("text = %q", text.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("jsonl lines = %d, want 2", len(lines))
+	}
+	var op port.OpenIpPort
+	if err := json.Unmarshal([]byte(lines[1]), &op); err != nil || op.Port != 22 || op.State != port.StateClosed {
+		t.Errorf("jsonl line = %s, err %v", lines[1], err)
+	}
+
+	want := "IP,PORT,SERVICE,BANNER,HTTP_TITLE,HTTP_STATUS,HTTP_SERVER,HTTP_TLS,HTTP_URL,HTTP_FINGERS,STATE,HOST,URL,PROTOCOL,SHARD\n" +
+		"10.0.0.1,80,http,\"HTTP/1.1 200 OK\r\n\",t,200,,,http://a.test,\"nginx,php\",,a.test,,tcp,\n" +
+		"10.0.0.2,22,,,,,,,,,closed,,,tcp,1/2\n"
+	if csvBuf.String() != want {
+		t.Errorf("csv =\n%q\nwant\n%q", csvBuf.String(), want)
+	}
+}
+
+func TestCsvAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	for i := 0; i < 2; i++ {
+		sink, err := New(FormatCsv, path, Option{Append: i > 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.Open(); err != nil {
+			t.Fatal(err)
+		}
+		sink.Write(testResults[1])
+		sink.Close()
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 追加时不重复写入表头
+	if got := strings.Count(string(b), "\n"); got != 3 || strings.Count(string(b), "IP,PORT") != 1 {
+		t.Errorf("csv =\n%s", b)
+	}
+}
+
+func TestNmapXml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xml")
+	ports, _ := port.ParsePortList("22,80,U:53", port.ProtocolTcp)
+	info := ScanInfo{Args: "go-portScan -ip 10.0.0.1", TcpType: "connect", Ports: ports}
+	results := [][]port.OpenIpPort{
+		{
+			testResults[0],
+			{Ip: net.ParseIP("10.0.0.1"), Port: 22, Service: "ssh", Banner: []byte("SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5\r\n")},
+			{Ip: net.ParseIP("10.0.0.1"), Port: 53, Protocol: port.ProtocolUdp, Service: "dns"},
+		},
+		{ // 恢复扫描
+			{Ip: net.ParseIP("10.0.0.1"), Port: 443, Service: "https", Host: "a.test", HttpInfo: &port.HttpInfo{Server: "nginx/1.18.0 (Ubuntu)", TlsCN: "a.test"}},
+			{Ip: net.ParseIP("fd00::1"), Port: 22, State: port.StateClosed},
+		},
+	}
+	for i, ops := range results {
+		sink, err := New(FormatXml, path, Option{Append: i > 0, Info: info})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.Open(); err != nil {
+			t.Fatal(err)
+		}
+		for _, op := range ops {
+			sink.Write(op)
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var run nmapRun
+	if err = xml.Unmarshal(b, &run); err != nil {
+		t.Fatalf("%s\n%s", err, b)
+	}
+	if run.Scanner != "nmap" || len(run.ScanInfo) != 2 || run.ScanInfo[0].Type != "connect" || run.ScanInfo[0].Services != "22,80" {
+		t.Errorf("nmaprun = %+v", run)
+	}
+	// 10.0.0.1 (a.test), 10.0.0.1, fd00::1
+	if len(run.Hosts) != 3 || run.RunStats.Hosts.Up != 3 {
+		t.Fatalf("hosts = %d, up %d\n%s", len(run.Hosts), run.RunStats.Hosts.Up, b)
+	}
+	h := run.Hosts[0]
+	if h.Hostnames.Hostname[0].Name != "a.test" || len(h.Ports) != 2 || h.Ports[0].PortId != 80 || h.Ports[1].PortId != 443 {
+		t.Errorf("host a.test = %+v", h)
+	}
+	if s := h.Ports[1].Service; s.Name != "http" || s.Tunnel != "ssl" || s.Product != "nginx" || s.Version != "1.18.0" || s.ExtraInfo != "Ubuntu" {
+		t.Errorf("https service = %+v", s)
+	}
+	if h.Ports[0].Scripts[0].Id != "http-title" || h.Ports[0].Scripts[0].Output != "t" {
+		t.Errorf("http scripts = %+v", h.Ports[0].Scripts)
+	}
+	h = run.Hosts[1]
+	if len(h.Ports) != 2 || h.Ports[0].Protocol != "tcp" || h.Ports[1].Protocol != "udp" || h.Ports[1].State.Reason != "udp-response" {
+		t.Errorf("host 10.0.0.1 = %+v", h)
+	}
+	if s := h.Ports[0].Service; s.Product != "OpenSSH" || s.Version != "8.2p1" || s.ExtraInfo != "Ubuntu-4ubuntu0.5" {
+		t.Errorf("ssh service = %+v", s)
+	}
+	h = run.Hosts[2]
+	if h.Address.AddrType != "ipv6" || h.Ports[0].State.State != "closed" || h.Ports[0].State.Reason != "reset" || h.Ports[0].Service != nil {
+		t.Errorf("host fd00::1 = %+v", h)
+	}
+}
+
+func TestNmapXmlHostStatus(t *testing.T) {
+	var buf bytes.Buffer
+	info := ScanInfo{
+		Discovery: func(ip net.IP) string {
+			if ip.Equal(net.ParseIP("10.0.0.3")) {
+				return "icmp"
+			}
+			return ""
+		},
+		HostCount: func() (total, live int) { return 256, -1 },
+	}
+	sink := NewNmapXml(&buf, info)
+	if err := sink.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []port.OpenIpPort{
+		{Ip: net.ParseIP("10.0.0.1"), Port: 80, State: port.StateFiltered}, // 只有filtered, 没有响应
+		{Ip: net.ParseIP("10.0.0.2"), Port: 80, State: port.StateFiltered},
+		{Ip: net.ParseIP("10.0.0.2"), Port: 22, State: port.StateClosed},
+		{Ip: net.ParseIP("10.0.0.3"), Port: 80, State: port.StateFiltered},
+	} {
+		sink.Write(op)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var run nmapRun
+	if err := xml.Unmarshal(buf.Bytes(), &run); err != nil {
+		t.Fatal(err)
+	}
+	var status []string
+	for _, h := range run.Hosts {
+		status = append(status, h.Status.State+" "+h.Status.Reason)
+	}
+	if want := "unknown no-response|up reset|up echo-reply"; strings.Join(status, "|") != want {
+		t.Errorf("host status = %q, want %q", status, want)
+	}
+	if hs := run.RunStats.Hosts; hs.Up != 2 || hs.Down != 254 || hs.Total != 256 {
+		t.Errorf("runstats hosts = %+v", hs)
+	}
+
+	// 存活探测的结果
+	buf.Reset()
+	info.HostCount = func() (total, live int) { return 256, 10 }
+	sink = NewNmapXml(&buf, info)
+	sink.Open()
+	sink.Write(port.OpenIpPort{Ip: net.ParseIP("10.0.0.3"), Port: 80})
+	sink.Close()
+	run = nmapRun{}
+	if err := xml.Unmarshal(buf.Bytes(), &run); err != nil {
+		t.Fatal(err)
+	}
+	if hs := run.RunStats.Hosts; hs.Up != 10 || hs.Down != 246 || hs.Total != 256 {
+		t.Errorf("runstats hosts = %+v", hs)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	var text, hosts, table bytes.Buffer
+	info := ScanInfo{Discovery: func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("10.0.0.1")) {
+			return "icmp"
+		}
+		return ""
+	}}
+	sinks := Multi{NewText(&text), NewHosts(&hosts, false, info), NewHosts(&table, true, info)}
+	if err := sinks.Open(); err != nil {
+		t.Fatal(err)
+	}
+	// 按全局置换顺序扫描时, 同一IP的结果与其它IP的结果交错到达
+	results := append(testResults,
+		port.OpenIpPort{Ip: net.ParseIP("10.0.0.1"), Port: 53, Protocol: port.ProtocolUdp, Service: "dns"},
+		port.OpenIpPort{Ip: net.ParseIP("10.0.0.2"), Port: 23, State: port.StateClosed},
+		port.OpenIpPort{Ip: net.ParseIP("10.0.0.1"), Port: 443, Service: "https", Host: "a.test"},
+	)
+	for _, op := range results {
+		if err := sinks.Write(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hosts.Len() > 0 || table.Len() > 0 {
+		t.Fatalf("hosts written before close:\n%s%s", hosts.String(), table.String())
+	}
+	if err := sinks.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(hosts.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("hosts lines = %d, want 3:\n%s", len(lines), hosts.String())
+	}
+	var records []HostRecord
+	for _, line := range lines {
+		var r HostRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if r := records[0]; r.Host != "a.test" || r.Discovery != "icmp" || len(r.Ports) != 2 || r.Ports[1].Port != 443 || r.FirstSeen.IsZero() || r.LastSeen.Before(r.FirstSeen) {
+		t.Errorf("host record = %+v", r)
+	}
+	if r := records[2]; r.Host != "" || len(r.Ports) != 1 || r.Ports[0].Protocol != port.ProtocolUdp || r.Ports[0].State != port.StateOpen {
+		t.Errorf("host record = %+v", r)
+	}
+	if r := records[1]; !r.Ip.Equal(net.ParseIP("10.0.0.2")) || r.Discovery != "syn" || len(r.Ports) != 2 || r.Ports[1].Port != 23 {
+		t.Errorf("host record = %+v", r)
+	}
+
+	for _, want := range []string{"10.0.0.1 (a.test)  discovery: icmp", "80/tcp   open   http     [200] t Fingers:nginx,php", "53/udp", "22/tcp  closed"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table missing %q:\n%s", want, table.String())
+		}
+	}
+}
+
+func TestHostsAppend(t *testing.T) {
+	dir := t.TempDir()
+	results := [][]port.OpenIpPort{
+		testResults,
+		{ // 恢复扫描
+			{Ip: net.ParseIP("10.0.0.1"), Port: 443, Service: "https", Host: "a.test"},
+			{Ip: net.ParseIP("10.0.0.3"), Port: 53, Protocol: port.ProtocolUdp, Service: "dns"},
+		},
+	}
+	for _, format := range []string{FormatHosts, FormatTable} {
+		path := filepath.Join(dir, format)
+		for i, ops := range results {
+			sink, err := New(format, path, Option{Append: i > 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = sink.Open(); err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range ops {
+				if err = sink.Write(op); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b, _ := os.ReadFile(path)
+		var records []*HostRecord
+		var err error
+		if format == FormatTable {
+			records, err = readTable(b)
+		} else {
+			records, err = readHostRecords(b)
+		}
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		// 每个主机只有一条记录, 原结果的端口和INFO保留
+		if len(records) != 3 {
+			t.Fatalf("%s: %d hosts, want 3:\n%s", format, len(records), b)
+		}
+		if r := records[0]; r.Host != "a.test" || len(r.Ports) != 2 || r.Ports[1].Port != 443 || r.FirstSeen.IsZero() {
+			t.Errorf("%s: host record = %+v", format, r)
+		}
+		if r := records[2]; !r.Ip.Equal(net.ParseIP("10.0.0.3")) || r.Ports[0].Protocol != port.ProtocolUdp {
+			t.Errorf("%s: host record = %+v", format, r)
+		}
+		if format == FormatTable && !strings.Contains(string(b), "[200] t Fingers:nginx,php") {
+			t.Errorf("table lost the info column:\n%s", b)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package output
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+)
+
+// Text 文本输出, 每条结果为OpenIpPort.String()
+type Text struct {
+	dest
+}
+
+// NewText 输出到w的文本输出
+func NewText(w io.Writer) *Text {
+	return &Text{dest: dest{w: w}}
+}
+
+func (t *Text) Open() error {
+	_, err := t.open()
+	return err
+}
+
+func (t *Text) Write(op port.OpenIpPort) error {
+	_, err := io.WriteString(t.w, op.String()+"\n")
+	return err
+}
+
+func (t *Text) Flush() error {
+	return t.sync()
+}
+
+func (t *Text) Close() error {
+	return t.close()
+}
@@ -46,6 +46,17 @@ var readBufPool = &sync.Pool{
 
 // PortIdentify 端口识别
 func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Duration) (serviceName string, banner []byte, isDailErr bool) {
+	return PortIdentifyHost(network, ip, "", _port, dailTimeout)
+}
+
+// PortIdentifyHost 端口识别, host为目标域名, 用于探测数据中的{HOST}和TLS SNI, 为空时使用ip
+func PortIdentifyHost(network string, ip net.IP, host string, _port uint16, dailTimeout time.Duration) (serviceName string, banner []byte, isDailErr bool) {
+	serviceName, banner, dailErr := PortIdentifyHostErr(network, ip, host, _port, dailTimeout)
+	return serviceName, banner, dailErr != nil
+}
+
+// PortIdentifyHostErr 同PortIdentifyHost, 连接失败时返回连接的错误, 用于区分端口拒绝连接和超时
+func PortIdentifyHostErr(network string, ip net.IP, host string, _port uint16, dailTimeout time.Duration) (serviceName string, banner []byte, dailErr error) {
 
 	matchedRule := make(map[string]struct{})
 	// 记录对应服务已经进行过匹配
@@ -63,11 +74,11 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 
 	defer func() {
 		if sn == "http" && bytes.HasPrefix(banner, []byte("HTTP/1.1 400")) {
-			sn2, banner2, isDailErr2 := matchRule(network, ip, _port, "https", dailTimeout)
-			if !isDailErr && sn2 != "" {
+			sn2, banner2, dailErr2 := matchRule(network, ip, host, _port, "https", dailTimeout)
+			if dailErr == nil && sn2 != "" {
 				sn = sn2
 				banner = banner2
-				isDailErr = isDailErr2
+				dailErr = dailErr2
 			}
 		}
 	}()
@@ -76,11 +87,11 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 	if serviceNames, ok := portServiceOrder[_port]; ok {
 		for _, service := range serviceNames {
 			recordMatched(service)
-			sn, banner, isDailErr = matchRule(network, ip, _port, service, dailTimeout)
+			sn, banner, dailErr = matchRule(network, ip, host, _port, service, dailTimeout)
 			if sn != "" {
-				return sn, banner, false
-			} else if isDailErr {
-				return unknown, banner, isDailErr
+				return sn, banner, nil
+			} else if dailErr != nil {
+				return unknown, banner, dailErr
 			}
 		}
 	}
@@ -97,9 +108,9 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 		}()
 		address := net.JoinHostPort(ip.String(), strconv.Itoa(int(_port)))
 		now := time.Now()
-		conn, _ = net.DialTimeout(network, address, dailTimeout)
+		conn, dailErr = net.DialTimeout(network, address, dailTimeout)
 		if conn == nil {
-			return unknown, banner, true
+			return unknown, banner, dailErr
 		}
 		lastDailTime = time.Since(now) * 2
 		if lastDailTime < dailTimeout {
@@ -119,8 +130,8 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 					continue
 				}
 				for _, rule := range serviceRules[service].DataGroup {
-					if matchRuleWhithBuf(buf[:n], ip, _port, rule) {
-						return service, banner, false
+					if matchRuleWhithBuf(buf[:n], ip, host, _port, rule) {
+						return service, banner, nil
 					}
 				}
 
@@ -138,11 +149,11 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 			continue
 		}
 		recordMatched(service)
-		sn, banner, isDailErr = matchRule(network, ip, _port, service, dailTimeout)
+		sn, banner, dailErr = matchRule(network, ip, host, _port, service, dailTimeout)
 		if sn != "" {
-			return sn, banner, false
-		} else if isDailErr {
-			return unknown, banner, true
+			return sn, banner, nil
+		} else if dailErr != nil {
+			return unknown, banner, dailErr
 		}
 	}
 
@@ -152,25 +163,34 @@ func PortIdentify(network string, ip net.IP, _port uint16, dailTimeout time.Dura
 		if ok {
 			continue
 		}
-		sn, banner, isDailErr = matchRule(network, ip, _port, service, dailTimeout)
+		sn, banner, dailErr = matchRule(network, ip, host, _port, service, dailTimeout)
 		if sn != "" {
-			return sn, banner, false
-		} else if isDailErr {
-			return unknown, banner, true
+			return sn, banner, nil
+		} else if dailErr != nil {
+			return unknown, banner, dailErr
 		}
 	}
 
-	return unknown, banner, false
+	return unknown, banner, nil
+}
+
+// fillRuleData 替换探测数据中的变量, 没有域名时{HOST}为ip
+func fillRuleData(data []byte, ip net.IP, host string, _port uint16) []byte {
+	if host == "" {
+		host = ip.String()
+	}
+	data = bytes.Replace(data, []byte("{IP}"), []byte(ip.String()), -1)
+	data = bytes.Replace(data, []byte("{HOST}"), []byte(host), -1)
+	return bytes.Replace(data, []byte("{PORT}"), []byte(strconv.Itoa(int(_port))), -1)
 }
 
 // 指纹匹配函数
-func matchRuleWhithBuf(buf, ip net.IP, _port uint16, rule ruleData) bool {
+func matchRuleWhithBuf(buf, ip net.IP, host string, _port uint16, rule ruleData) bool {
 	data := []byte("")
 	// 逐个判断
 	//for _, rule := range serviceRule.DataGroup {
 	if rule.Data != nil {
-		data = bytes.Replace(rule.Data, []byte("{IP}"), []byte(ip.String()), -1)
-		data = bytes.Replace(data, []byte("{PORT}"), []byte(strconv.Itoa(int(_port))), -1)
+		data = fillRuleData(rule.Data, ip, host, _port)
 	}
 	// 包含数据就正确
 	if rule.Regexps != nil {
@@ -186,8 +206,8 @@ func matchRuleWhithBuf(buf, ip net.IP, _port uint16, rule ruleData) bool {
 	return false
 }
 
-// 指纹匹配函数
-func matchRule(network string, ip net.IP, _port uint16, serviceName string, dailTimeout time.Duration) (serviceNameRet string, banner []byte, isDailErr bool) {
+// 指纹匹配函数, 连接失败时返回dailErr
+func matchRule(network string, ip net.IP, host string, _port uint16, serviceName string, dailTimeout time.Duration) (serviceNameRet string, banner []byte, dailErr error) {
 	var err error
 	var isTls bool
 	var conn net.Conn
@@ -204,10 +224,11 @@ func matchRule(network string, ip net.IP, _port uint16, serviceName string, dail
 		connTls, err = tls.DialWithDialer(&net.Dialer{Timeout: dailTimeout}, network, address, &tls.Config{
 			InsecureSkipVerify: true,
 			MinVersion:         tls.VersionTLS10,
+			ServerName:         host,
 		})
 		if err != nil {
 			if strings.HasSuffix(err.Error(), ioTimeoutStr) || strings.Contains(err.Error(), refusedStr) {
-				isDailErr = true
+				dailErr = err
 				return
 			}
 			var oe *net.OpError
@@ -221,7 +242,7 @@ func matchRule(network string, ip net.IP, _port uint16, serviceName string, dail
 	} else {
 		conn, err = net.DialTimeout(network, address, dailTimeout)
 		if conn == nil {
-			isDailErr = true
+			dailErr = err
 			return
 		}
 		defer conn.Close()
@@ -236,8 +257,7 @@ func matchRule(network string, ip net.IP, _port uint16, serviceName string, dail
 	// 逐个判断
 	for _, rule := range serviceRule2.DataGroup {
 		if rule.Data != nil {
-			data = bytes.Replace(rule.Data, []byte("{IP}"), []byte(ip.String()), -1)
-			data = bytes.Replace(data, []byte("{PORT}"), []byte(strconv.Itoa(int(_port))), -1)
+			data = fillRuleData(rule.Data, ip, host, _port)
 		}
 
 		if rule.Action == ActionSend {
@@ -266,7 +286,7 @@ func matchRule(network string, ip net.IP, _port uint16, serviceName string, dail
 			banner = make([]byte, n)
 			copy(banner, buf[:n])
 			// 包含数据就正确
-			if matchRuleWhithBuf(buf[:n], ip, _port, rule) {
+			if matchRuleWhithBuf(buf[:n], ip, host, _port, rule) {
 				serviceNameRet = serviceName
 				return
 			}
@@ -276,7 +296,7 @@ func matchRule(network string, ip net.IP, _port uint16, serviceName string, dail
 					if rule2.Action == ActionSend {
 						continue
 					}
-					if matchRuleWhithBuf(buf[:n], ip, _port, rule2) {
+					if matchRuleWhithBuf(buf[:n], ip, host, _port, rule2) {
 						serviceNameRet = s
 						return
 					}
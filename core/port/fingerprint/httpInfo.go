@@ -2,6 +2,7 @@ package fingerprint
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"fmt"
 	"github.com/XinRoom/go-portScan/core/port"
@@ -12,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +24,28 @@ var httpsTopPort = []uint16{443, 4443, 1443, 8443}
 var httpClient *http.Client
 
 func ProbeHttpInfo(host string, _port uint16, topScheme string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, banner []byte, isDailErr bool) {
+	httpInfo, banner, dialErr := probeHttpInfo(context.Background(), host, _port, topScheme, dialTimeout)
+	return httpInfo, banner, dialErr != nil
+}
+
+// ProbeHostHttpInfo 连接ip探测域名host的HttpInfo, Host头和TLS SNI为host, 用于虚拟主机; host为空时探测ip
+func ProbeHostHttpInfo(ip net.IP, host string, _port uint16, topScheme string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, banner []byte, isDailErr bool) {
+	httpInfo, banner, dialErr := ProbeHostHttpInfoErr(ip, host, _port, topScheme, dialTimeout)
+	return httpInfo, banner, dialErr != nil
+}
+
+// ProbeHostHttpInfoErr 同ProbeHostHttpInfo, 连接失败时返回连接的错误, 用于区分端口拒绝连接和超时
+func ProbeHostHttpInfoErr(ip net.IP, host string, _port uint16, topScheme string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, banner []byte, dialErr error) {
+	ctx := context.Background()
+	if host == "" {
+		host = ip.String()
+	} else {
+		ctx = httputil.WithDialIp(ctx, host, ip)
+	}
+	return probeHttpInfo(ctx, host, _port, topScheme, dialTimeout)
+}
+
+func probeHttpInfo(ctx context.Context, host string, _port uint16, topScheme string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, banner []byte, dialErr error) {
 	var schemes []string
 
 	if util.IsUint16InList(_port, httpsTopPort) || topScheme == "https" {
@@ -37,8 +61,8 @@ func ProbeHttpInfo(host string, _port uint16, topScheme string, dialTimeout time
 
 		var httpInfo2 *port.HttpInfo
 		var banner2 []byte
-		httpInfo2, banner2, isDailErr = WebHttpInfo(url2, dialTimeout, true)
-		if isDailErr {
+		httpInfo2, banner2, dialErr = webHttpInfo(ctx, url2, dialTimeout, true)
+		if dialErr != nil {
 			return
 		}
 
@@ -54,7 +78,60 @@ func ProbeHttpInfo(host string, _port uint16, topScheme string, dialTimeout time
 	return
 }
 
+// ProbeUrlHttpInfo 探测url的HttpInfo, url没有协议时按端口依次尝试https和http(没有端口时先尝试https)
+// ip不为空时直接连接ip, Host头和TLS SNI仍为url中的域名
+func ProbeUrlHttpInfo(ip net.IP, url2 string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, banner []byte, isDailErr bool) {
+	schemes := []string{""}
+	if !strings.Contains(url2, "://") {
+		url2 = "http://" + url2
+		schemes = []string{"https", "http"}
+	}
+	u, err := url.Parse(url2)
+	if err != nil {
+		return nil, nil, true
+	}
+	if schemes[0] != "" && u.Port() != "" {
+		_port, _ := strconv.Atoi(u.Port())
+		if !util.IsUint16InList(uint16(_port), httpsTopPort) {
+			schemes = []string{"http", "https"}
+		}
+	}
+	ctx := context.Background()
+	if ip != nil {
+		ctx = httputil.WithDialIp(ctx, u.Hostname(), ip)
+	}
+	for _, scheme := range schemes {
+		if scheme != "" {
+			u.Scheme = scheme
+		}
+		var httpInfo2 *port.HttpInfo
+		var banner2 []byte
+		var dialErr error
+		httpInfo2, banner2, dialErr = webHttpInfo(ctx, u.String(), dialTimeout, true)
+		if isDailErr = dialErr != nil; isDailErr {
+			continue // 没有端口时https和http的端口不同, 连接失败时尝试下一个协议
+		}
+		if httpInfo2 != nil {
+			httpInfo = httpInfo2
+			banner = banner2
+			if httpInfo2.StatusCode != 400 {
+				break
+			}
+		}
+	}
+	if httpInfo != nil {
+		isDailErr = false
+	}
+	return
+}
+
 func WebHttpInfo(url2 string, dialTimeout time.Duration, favicon bool) (httpInfo *port.HttpInfo, banner []byte, isDailErr bool) {
+	httpInfo, banner, dialErr := webHttpInfo(context.Background(), url2, dialTimeout, favicon)
+	return httpInfo, banner, dialErr != nil
+}
+
+// webHttpInfo 连接超时或被拒绝时返回dialErr
+func webHttpInfo(ctx context.Context, url2 string, dialTimeout time.Duration, favicon bool) (httpInfo *port.HttpInfo, banner []byte, dialErr error) {
 	if httpClient == nil {
 		httpClient = httputil.NewHttpClient(dialTimeout)
 	}
@@ -66,10 +143,10 @@ func WebHttpInfo(url2 string, dialTimeout time.Duration, favicon bool) (httpInfo
 	var b bytes.Buffer
 	defer b.Reset()
 
-	resps, body, err = getReq(url2, 1)
+	resps, body, err = getReq(ctx, url2, 1)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "timeout") || strings.Contains(err.Error(), refusedStr) {
-			return nil, banner, true
+			return nil, banner, err
 		}
 	}
 	if len(resps) > 0 {
@@ -116,7 +193,7 @@ func WebHttpInfo(url2 string, dialTimeout time.Duration, favicon bool) (httpInfo
 			if !strings.HasPrefix(fau, "http") {
 				fau = resp.Request.URL.String() + fau
 			}
-			resps2, body2, err2 := getReq(fau, 0)
+			resps2, body2, err2 := getReq(ctx, fau, 0)
 			if err2 == nil && len(body2) != 0 && len(resps2) > 0 && resps2[0].StatusCode == 200 && strings.Contains(resps2[0].Header.Get("Content-Type"), "image") {
 				httpInfo.Favicon = body2
 				httpInfo.FaviconHash = webfinger.WebFaviconHash(body2)
@@ -127,7 +204,7 @@ func WebHttpInfo(url2 string, dialTimeout time.Duration, favicon bool) (httpInfo
 	return
 }
 
-func getReq(url2 string, maxRewriteNum int) (resps []*http.Response, body []byte, err error) {
+func getReq(ctx context.Context, url2 string, maxRewriteNum int) (resps []*http.Response, body []byte, err error) {
 	var rewriteNum int
 	var req *http.Request
 	for {
@@ -138,7 +215,7 @@ func getReq(url2 string, maxRewriteNum int) (resps []*http.Response, body []byte
 				connectAddr = strings.Split(addr, ":")[0]
 			},
 		}
-		req, err = http.NewRequest(http.MethodGet, url2, http.NoBody)
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url2, http.NoBody)
 		if err != nil {
 			return
 		}
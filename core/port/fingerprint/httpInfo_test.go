@@ -1,6 +1,11 @@
 package fingerprint
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -8,3 +13,53 @@ import (
 func TestName(t *testing.T) {
 	t.Log(ProbeHttpInfo("www.baidu.com", 443, "https", 5*time.Second))
 }
+
+func TestFillRuleData(t *testing.T) {
+	data := []byte("Host: {HOST}\r\nX: {IP}:{PORT}")
+	if got := string(fillRuleData(data, net.IPv4(10, 0, 0, 1), "", 80)); got != "Host: 10.0.0.1\r\nX: 10.0.0.1:80" {
+		t.Error(got)
+	}
+	if got := string(fillRuleData(data, net.IPv4(10, 0, 0, 1), "example.com", 80)); got != "Host: example.com\r\nX: 10.0.0.1:80" {
+		t.Error(got)
+	}
+}
+
+func TestProbeUrlHttpInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<title>%s %s</title>", r.Host, r.URL.RequestURI())
+	}))
+	defer ts.Close()
+	_, _port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+
+	// 没有协议时尝试http, 连接指定的ip, Host头为url中的域名
+	httpInfo, _, isDailErr := ProbeUrlHttpInfo(net.ParseIP("127.0.0.1"), "vhost.test:"+_port+"/admin?x=1", time.Second)
+	if isDailErr || httpInfo == nil {
+		t.Fatal("no http response")
+	}
+	if want := "vhost.test:" + _port + " /admin?x=1"; httpInfo.Title != want || !strings.HasPrefix(httpInfo.Url, "http://vhost.test:") {
+		t.Errorf("title = %q, url = %q, want title %q", httpInfo.Title, httpInfo.Url, want)
+	}
+}
+
+func TestProbeUrlHttpInfo_noPort(t *testing.T) {
+	// 只有http:80, https:443连接被拒绝时尝试http
+	l, err := net.Listen("tcp", "127.0.0.2:80")
+	if err != nil {
+		t.Skip(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<title>%s</title>", r.Host)
+	}))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	httpInfo, _, isDailErr := ProbeUrlHttpInfo(net.ParseIP("127.0.0.2"), "vhost.test/", time.Second)
+	if isDailErr || httpInfo == nil {
+		t.Fatal("no http response")
+	}
+	if httpInfo.Title != "vhost.test" || !strings.HasPrefix(httpInfo.Url, "http://vhost.test/") {
+		t.Errorf("title = %q, url = %q", httpInfo.Title, httpInfo.Url)
+	}
+}
@@ -0,0 +1,47 @@
+package port
+
+import (
+	"net"
+	"sync"
+)
+
+// PendingScanner 可获取未完成探测的扫描器, 中断扫描时保存这些探测, 恢复时重新扫描
+type PendingScanner interface {
+	Pending() []OpenIpPort
+}
+
+// Pending 未完成的探测(连接、服务识别等), 零值可用
+type Pending struct {
+	lock sync.Mutex
+	id   uint64
+	m    map[uint64]OpenIpPort
+}
+
+// Add 添加探测, host为目标域名, 完成后使用返回的id调用Done
+func (p *Pending) Add(ip net.IP, dst uint16, protocol, host string) (id uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.m == nil {
+		p.m = make(map[uint64]OpenIpPort)
+	}
+	p.id++
+	p.m[p.id] = OpenIpPort{Ip: ip, Port: dst, Protocol: protocol, Host: host}
+	return p.id
+}
+
+// Done 探测完成
+func (p *Pending) Done(id uint64) {
+	p.lock.Lock()
+	delete(p.m, id)
+	p.lock.Unlock()
+}
+
+// List 未完成的探测
+func (p *Pending) List() (ret []OpenIpPort) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, op := range p.m {
+		ret = append(ret, op)
+	}
+	return
+}
@@ -2,9 +2,7 @@ package port
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/XinRoom/go-portScan/util"
 	"net"
 	"strconv"
 	"strings"
@@ -116,6 +114,27 @@ var TopTcpPorts = []uint16{
 	57797, 58080, 60020, 60443, 61532, 61900, 62078, 63331, 64623, 64680, 65000,
 	65129, 65389}
 
+// TopUdpPorts 常见UDP端口 ref https://nmap.org/book/nmap-services.html
+var TopUdpPorts = []uint16{
+	53, 123, 161, 137, 500, 1900, 5353, 69, 111, 2049, /* have payloads */
+	623, 1434, 5060, 389, 11211, 1194, 3478, 5351, 5683, 10001, 177, 1604, 7, 19,
+
+	9, 17, 49, 67, 68, 80, 88, 120, 135, 136, 138, 139, 158, 162, 427, 443, 445,
+	497, 514, 515, 518, 520, 593, 626, 631, 996, 997, 998, 999, 1022, 1023, 1025,
+	1026, 1027, 1028, 1029, 1030, 1433, 1645, 1646, 1701, 1718, 1719, 1812, 1813,
+	2000, 2048, 2222, 2223, 3283, 3456, 3702, 3703, 4444, 4500, 5000, 5632, 9200,
+	10000, 17185, 20031, 30718, 31337, 32768, 32769, 32771, 32815, 33281, 47808,
+	49152, 49153, 49154, 49156, 49181, 49182, 49185, 49186, 49188, 49190, 49191,
+	49192, 49193, 49194, 49200, 49201, 65024}
+
+// TopSctpPorts 常见SCTP端口, 主要为电信信令(SIGTRAN、Diameter、S1AP等)
+var TopSctpPorts = []uint16{
+	2905, 3868, 2904, 2944, 2945, 3565, 3863, 3864, 9900, 14001, 36412, 36422,
+	36443, 36444, 36462, 38412, 38422, 38462, 38472, 29118, 29168, 29169, 5060,
+	5061, 5090, 1167, 7, 9, 20, 21, 22, 80, 179, 443, 1021, 1022, 3097, 4195,
+	4333, 4502, 5672, 6704, 6705, 6706, 7626, 7701, 7728, 8282, 8471, 9082, 9084,
+	9902, 11997, 11998, 11999, 20049, 25471}
+
 type Scanner interface {
 	Close()
 	Wait()
@@ -123,19 +142,86 @@ type Scanner interface {
 	WaitLimiter() error
 }
 
+// 端口状态
+const (
+	StateOpen         = "open"
+	StateClosed       = "closed"
+	StateFiltered     = "filtered"
+	StateUnfiltered   = "unfiltered"
+	StateOpenFiltered = "open|filtered"
+)
+
+// ScanType SYN-mode原始包扫描类型
+type ScanType uint8
+
+const (
+	ScanTypeSyn      ScanType = iota // SYN扫描, 默认
+	ScanTypeAck                      // ACK扫描, 区分filtered和unfiltered
+	ScanTypeFin                      // FIN扫描
+	ScanTypeNull                     // NULL扫描, 不设置任何标志位
+	ScanTypeXmas                     // Xmas扫描, FIN|PSH|URG
+	ScanTypeWindow                   // Window扫描, 根据RST包的窗口大小判断open和closed
+	ScanTypeSctpInit                 // SCTP INIT扫描
+)
+
+func (st ScanType) String() string {
+	switch st {
+	case ScanTypeAck:
+		return "ack"
+	case ScanTypeFin:
+		return "fin"
+	case ScanTypeNull:
+		return "null"
+	case ScanTypeXmas:
+		return "xmas"
+	case ScanTypeWindow:
+		return "window"
+	case ScanTypeSctpInit:
+		return "sctpinit"
+	default:
+		return "syn"
+	}
+}
+
 // OpenIpPort retChan
 type OpenIpPort struct {
 	Ip       net.IP    `json:"ip"`
 	Port     uint16    `json:"port"`
+	Protocol string    `json:"protocol,omitempty"` // 为空时为tcp
+	State    string    `json:"state,omitempty"`    // 为空时为open
 	Service  string    `json:"service"`
 	Banner   []byte    `json:"banner,omitempty"`
 	HttpInfo *HttpInfo `json:"http_info,omitempty"`
+	Shard    string    `json:"shard,omitempty"` // 分布式扫描的分片, eg: 1/3
+	Host     string    `json:"host,omitempty"`  // 目标域名, 用于Http Host头和TLS SNI
+	Url      string    `json:"url,omitempty"`   // url模式下输入的url
 	IpOption           `json:"-"`
 }
 
 func (op OpenIpPort) String() string {
 	buf := strings.Builder{}
-	buf.WriteString(net.JoinHostPort(op.Ip.String(), strconv.Itoa(int(op.Port))))
+	if op.Url != "" {
+		// url模式以输入的url为准
+		buf.WriteString(op.Url)
+		buf.WriteString(" (")
+		buf.WriteString(net.JoinHostPort(op.Ip.String(), strconv.Itoa(int(op.Port))))
+		buf.WriteString(")")
+	} else {
+		buf.WriteString(net.JoinHostPort(op.Ip.String(), strconv.Itoa(int(op.Port))))
+	}
+	if op.Host != "" && op.Url == "" {
+		buf.WriteString(" (")
+		buf.WriteString(op.Host)
+		buf.WriteString(")")
+	}
+	if op.Protocol != "" && op.Protocol != "tcp" {
+		buf.WriteString("/")
+		buf.WriteString(op.Protocol)
+	}
+	if !op.IsOpen() {
+		buf.WriteString(" ")
+		buf.WriteString(op.State)
+	}
 	if op.Service != "" {
 		buf.WriteString(" ")
 		buf.WriteString(op.Service)
@@ -147,6 +233,25 @@ func (op OpenIpPort) String() string {
 	return buf.String()
 }
 
+// SplitHosts 按IpOption.Hosts中的域名拆分为多个结果, 各结果的Host为对应域名, 没有域名时返回自身
+func (op OpenIpPort) SplitHosts() []OpenIpPort {
+	if len(op.Hosts) == 0 {
+		return []OpenIpPort{op}
+	}
+	ops := make([]OpenIpPort, len(op.Hosts))
+	for i, host := range op.Hosts {
+		ops[i] = op
+		ops[i].Host = host
+		ops[i].Hosts = []string{host}
+	}
+	return ops
+}
+
+// IsOpen 端口是否为open状态
+func (op OpenIpPort) IsOpen() bool {
+	return op.State == "" || op.State == StateOpen
+}
+
 func (op OpenIpPort) Json() string {
 	o, _ := json.Marshal(op)
 	return string(o)
@@ -154,10 +259,14 @@ func (op OpenIpPort) Json() string {
 
 // ScannerOption 扫描器初始化参数
 type ScannerOption struct {
-	Rate     int    // 每秒速度限制, 单位: s, 会在1s内平均发送, 相当于每个包之间的延迟
-	MiniRate int    // 最小每秒速度，避免自动调速太低, 单位: s,  0为不设置
-	Timeout  int    // TCP连接响应延迟, 单位: ms
-	NextHop  string // pcap dev name
+	Rate     int      // 每秒速度限制, 单位: s, 会在1s内平均发送, 相当于每个包之间的延迟
+	MiniRate int      // 最小每秒速度，避免自动调速太低, 单位: s,  0为不设置
+	Timeout  int      // TCP连接响应延迟, 单位: ms
+	NextHop  string   // pcap dev name
+	Backend  string   // SYN-mode收发包方式: pcap, afpacket, 为空时优先使用pcap
+	Retries  int      // 无响应时的重发次数
+	AllState bool     // 输出closed、filtered等非open状态的端口
+	ScanType ScanType // SYN-mode下的扫描类型
 	Debug    bool
 }
 
@@ -165,6 +274,8 @@ type ScannerOption struct {
 type IpOption struct {
 	FingerPrint bool        // 探测服务
 	Httpx       bool        // 探测 HttpInfo
+	Hosts       []string    // ip对应的域名, 开放端口按各域名分别探测HttpInfo和服务并输出
+	Protocol    string      // 端口的协议, TCP和UDP混合扫描时选择扫描器, 为空时为扫描器的协议
 	Ext         interface{} // 扩展属性
 }
 
@@ -208,31 +319,31 @@ func (hi *HttpInfo) String() string {
 	return buf.String()
 }
 
-// ParsePortRangeStr 解析端口字符串
+// ParsePortRangeStr 解析端口字符串为端口范围, 格式同ParsePortList, 不区分协议
 func ParsePortRangeStr(portStr string) (out [][]uint16, err error) {
-	if portStr == "-" {
-		portStr = "1-65535"
+	sets, err := parsePortSets(portStr, ProtocolTcp)
+	if err != nil {
+		return
 	}
-	portsStrGroup := strings.Split(portStr, ",")
-	var portsStrGroup3 []string
-	var portStart, portEnd uint64
-	for _, portsStrGroup2 := range portsStrGroup {
-		if portsStrGroup2 == "top1000" {
-			continue
+	var all portSet
+	for _, set := range sets {
+		for i := range set {
+			all[i] |= set[i]
 		}
-		portsStrGroup3 = strings.Split(portsStrGroup2, "-")
-		portStart, err = strconv.ParseUint(portsStrGroup3[0], 10, 16)
-		if err != nil {
-			return
-		}
-		portEnd = portStart
-		if len(portsStrGroup3) == 2 {
-			portEnd, err = strconv.ParseUint(portsStrGroup3[1], 10, 16)
-		}
-		if err != nil {
-			return
-		}
-		out = append(out, []uint16{uint16(portStart), uint16(portEnd)})
+	}
+	return all.ranges(), nil
+}
+
+// ParseProtocolPortRanges 解析端口字符串为各协议的端口范围, 格式同ParsePortList,
+// 没有协议前缀的端口的key为空字符串, 表示所有协议
+func ParseProtocolPortRanges(portStr string) (out map[string][][]uint16, err error) {
+	sets, err := parsePortSets(portStr, "")
+	if err != nil {
+		return
+	}
+	out = make(map[string][][]uint16)
+	for protocol, set := range sets {
+		out[protocol] = set.ranges()
 	}
 	return
 }
@@ -249,56 +360,29 @@ func IsInPortRange(port uint16, portRanges [][]uint16) bool {
 
 // ShuffleParseAndMergeTopPorts shuffle parse portStr and merge TopTcpPorts
 func ShuffleParseAndMergeTopPorts(portStr string) (ports []uint16, err error) {
-	if portStr == "" {
-		ports = TopTcpPorts
-		return
+	return shuffleParseAndMergePorts(portStr, ProtocolTcp)
+}
+
+// ShuffleParseAndMergeTopUdpPorts shuffle parse portStr and merge TopUdpPorts, "top1000" means all TopUdpPorts
+func ShuffleParseAndMergeTopUdpPorts(portStr string) (ports []uint16, err error) {
+	return shuffleParseAndMergePorts(portStr, ProtocolUdp)
+}
+
+// ShuffleParseAndMergeTopSctpPorts shuffle parse portStr and merge TopSctpPorts, "top1000" means all TopSctpPorts
+func ShuffleParseAndMergeTopSctpPorts(portStr string) (ports []uint16, err error) {
+	return shuffleParseAndMergePorts(portStr, ProtocolSctp)
+}
+
+func shuffleParseAndMergePorts(portStr string, protocol string) (ports []uint16, err error) {
+	if portStr == "" || portStr == "top1000" {
+		portStr = DefaultTopPorts(protocol)
 	}
-	var portRanges [][]uint16
-	portRanges, err = ParsePortRangeStr(portStr)
+	pl, err := ParsePortList(portStr, protocol)
 	if err != nil {
 		return
 	}
-	// 优先发送top端口
-	selectTopPort := make(map[uint16]struct{}) // TopPort
-	hasTopStr := strings.Contains(portStr, "top1000")
-	for _, _port := range TopTcpPorts {
-		if hasTopStr || IsInPortRange(_port, portRanges) {
-			selectTopPort[_port] = struct{}{}
-			ports = append(ports, _port)
-		}
-	}
-	selectPort := make(map[uint16]struct{}) // OtherPort
-	for _, portRange := range portRanges {
-		var ok bool
-		for _port := portRange[0]; _port <= portRange[1]; _port++ {
-			if _port == 0 {
-				continue
-			}
-			if _, ok = selectTopPort[_port]; ok {
-				continue
-			} else if _, ok = selectPort[_port]; ok {
-				continue
-			}
-			selectPort[_port] = struct{}{}
-			ports = append(ports, _port)
-			if _port == 65535 {
-				break
-			}
-		}
-	}
-	if len(ports) == 0 {
-		err = errors.New("ports len is 0")
-		return
-	}
-	// 端口随机化
-	skip := uint64(len(selectTopPort)) // 跳过Top
-	_ports := make([]uint16, len(ports))
-	copy(_ports, ports)
-	sf := util.NewShuffle(uint64(len(ports)) - skip)
-	if sf != nil {
-		for i := skip; i < uint64(len(_ports)); i++ {
-			ports[i] = _ports[skip+sf.Get(i-skip)]
-		}
+	if ports = pl.Ports(protocol); len(ports) == 0 {
+		err = fmt.Errorf("no %s port in %q", protocol, portStr)
 	}
 	return
 }
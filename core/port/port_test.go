@@ -0,0 +1,146 @@
+package port
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestShuffleParseAndMergeTopPorts(t *testing.T) {
+	for _, portStr := range []string{"top1000", "8080-8083,22", "top1000,1-65535"} {
+		ports, err := ShuffleParseAndMergeTopPorts(portStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[uint16]bool)
+		for _, _port := range ports {
+			if seen[_port] {
+				t.Fatalf("%s: duplicate port %d", portStr, _port)
+			}
+			seen[_port] = true
+		}
+		// 各节点解析的端口顺序一致
+		ports2, _ := ShuffleParseAndMergeTopPorts(portStr)
+		for i := range ports {
+			if ports[i] != ports2[i] {
+				t.Fatalf("%s: port order not stable", portStr)
+			}
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	var p Pending
+	id1 := p.Add(net.IPv4(10, 0, 0, 1), 80, "", "")
+	id2 := p.Add(net.IPv4(10, 0, 0, 2), 443, "", "example.com")
+	p.Done(id1)
+	list := p.List()
+	if len(list) != 1 || list[0].Port != 443 || !list[0].Ip.Equal(net.IPv4(10, 0, 0, 2)) || list[0].Host != "example.com" {
+		t.Fatal(list)
+	}
+	p.Done(id2)
+	if len(p.List()) != 0 {
+		t.Fatal(p.List())
+	}
+}
+
+func TestSplitHosts(t *testing.T) {
+	op := OpenIpPort{Ip: net.IPv4(10, 0, 0, 1), Port: 443}
+	if ops := op.SplitHosts(); len(ops) != 1 || ops[0].Host != "" {
+		t.Fatal(ops)
+	}
+	op.Hosts = []string{"a.example.com", "b.example.com"}
+	ops := op.SplitHosts()
+	if len(ops) != 2 || ops[0].Host != "a.example.com" || ops[1].Host != "b.example.com" || len(ops[1].Hosts) != 1 || ops[1].Hosts[0] != "b.example.com" {
+		t.Fatal(ops)
+	}
+	if ops[1].String() != "10.0.0.1:443 (b.example.com)" {
+		t.Error(ops[1].String())
+	}
+}
+
+func TestParsePortList(t *testing.T) {
+	for _, c := range []struct {
+		spec     string
+		tcp, udp int
+		has, not []uint16
+	}{
+		{spec: "top100", tcp: 100, has: []uint16{80, 23, 37}},
+		{spec: "top1000", tcp: 1000, has: []uint16{80, 23, 37, 8080, 3306}},
+		{spec: "top5000", tcp: 5000, has: []uint16{80, 37, 6379, 27017, 1}},
+		{spec: "top" + strconv.Itoa(len(RankedTcpPorts)), tcp: 65535, has: []uint16{80, 23, 37}},
+		{spec: "1-65535,!9100", tcp: 65534, not: []uint16{9100}},
+		{spec: "!9000-9100,-", tcp: 65535 - 101, not: []uint16{9000, 9100}},
+		{spec: "http,ssh,MySQL,web", tcp: 19, has: []uint16{80, 22, 3306, 8443}},
+		{spec: "U:53,domain,T:80,443", tcp: 2, udp: 1, has: []uint16{53, 80, 443}},
+		{spec: "U:" + DefaultTopPorts(ProtocolUdp), udp: len(RankedUdpPorts)},
+		{spec: "0-10", tcp: 10, not: []uint16{0}},
+	} {
+		pl, err := ParsePortList(c.spec, ProtocolTcp)
+		if err != nil {
+			t.Fatal(c.spec, err)
+		}
+		if len(pl.Tcp) != c.tcp || len(pl.Udp) != c.udp {
+			t.Fatalf("%s: %d tcp %d udp", c.spec, len(pl.Tcp), len(pl.Udp))
+		}
+		set := make(map[uint16]bool)
+		for i := 0; i < pl.Len(); i++ {
+			_port, _ := pl.Get(i)
+			set[_port] = true
+		}
+		for _, _port := range c.has {
+			if !set[_port] {
+				t.Errorf("%s: missing %d", c.spec, _port)
+			}
+		}
+		for _, _port := range c.not {
+			if set[_port] {
+				t.Errorf("%s: unexpected %d", c.spec, _port)
+			}
+		}
+	}
+	// 常见端口按常见程度在前
+	pl, _ := ParsePortList("22,80,1-10", ProtocolTcp)
+	if pl.Tcp[0] != 80 || pl.Tcp[1] != 22 {
+		t.Error("top order", pl.Tcp[:2])
+	}
+	for _, spec := range []string{"80-", "abc", "70000", "100-90", "top0", "top70000", "U:top1000", "X:80", "80,,81", "!", "-80", "U:dns"} {
+		if _, err := ParsePortList(spec, ProtocolTcp); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+	if ranges, err := ParsePortRangeStr("80,81-90,!85,U:53"); err != nil || fmt.Sprint(ranges) != "[[53 53] [80 84] [86 90]]" {
+		t.Error(ranges, err)
+	}
+	for name := range PortSets {
+		if _, ok := TcpServices[name]; ok {
+			t.Errorf("port set %s is also a service name", name)
+		}
+	}
+}
+
+func TestRankedTcpPorts(t *testing.T) {
+	var seen portSet
+	for i, _port := range RankedTcpPorts {
+		if _port == 0 || seen.has(_port) {
+			t.Fatalf("invalid or dup port %d at %d", _port, i)
+		}
+		seen.add(_port)
+	}
+	// 按频率排序的端口在前, 之后为nmap top1000中的其余端口
+	for i, _port := range topTcpPortsByFreq {
+		if RankedTcpPorts[i] != _port {
+			t.Fatalf("rank %d = %d, want %d", i, RankedTcpPorts[i], _port)
+		}
+	}
+	top1000 := make(map[uint16]bool)
+	for _, _port := range RankedTcpPorts[:len(rankPorts(topTcpPortsByFreq, TopTcpPorts))] {
+		top1000[_port] = true
+	}
+	for _, _port := range TopTcpPorts {
+		if !top1000[_port] {
+			t.Error("nmap top1000 port ranked after other ports:", _port)
+		}
+	}
+}
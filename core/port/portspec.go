@@ -0,0 +1,379 @@
+package port
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/util"
+	"strconv"
+	"strings"
+)
+
+// 端口协议, tcp扫描结果的OpenIpPort.Protocol为空
+const (
+	ProtocolTcp  = "tcp"
+	ProtocolUdp  = "udp"
+	ProtocolSctp = "sctp"
+)
+
+// PortSets 命名的端口集合, 用于端口参数, eg: "web,db"
+var PortSets = map[string][]uint16{
+	"web":    {80, 81, 443, 591, 3000, 5000, 7001, 8000, 8008, 8080, 8081, 8088, 8443, 8888, 9000, 9090, 9443},
+	"db":     {1433, 1521, 3306, 5432, 5984, 6379, 7474, 9042, 9200, 11211, 27017},
+	"email":  {25, 110, 143, 465, 587, 993, 995},
+	"remote": {22, 23, 512, 513, 514, 3389, 5900, 5985, 5986},
+	"share":  {21, 139, 445, 873, 2049},
+	"ics":    {102, 502, 1911, 2404, 4911, 9600, 20000, 44818},
+}
+
+// topTcpPortsByFreq 最常见的100个TCP端口, 按开放频率排序 ref https://nmap.org/book/nmap-services.html
+var topTcpPortsByFreq = []uint16{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554,
+	26, 1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106,
+	2121, 1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543, 544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646, 49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// 按常见程度排序的端口, topN取前N个, N最大为各表的端口数
+// TCP依次为: 按频率排序的前100个, nmap top1000中的其余端口(TopTcpPorts的顺序), 服务表和端口集合中的端口,
+// 其余的特权端口, 其余端口; 后三组按端口号排序, 表中包含所有端口
+var (
+	RankedTcpPorts  = rankPorts(topTcpPortsByFreq, TopTcpPorts, namedTcpPorts(), portRange(1, 1023), portRange(1024, 65535))
+	RankedUdpPorts  = rankPorts(TopUdpPorts)
+	RankedSctpPorts = rankPorts(TopSctpPorts)
+)
+
+// rankPorts 按顺序拼接并去重
+func rankPorts(lists ...[]uint16) (ports []uint16) {
+	var seen portSet
+	for _, list := range lists {
+		for _, _port := range list {
+			if !seen.has(_port) {
+				seen.add(_port)
+				ports = append(ports, _port)
+			}
+		}
+	}
+	return
+}
+
+// namedTcpPorts 服务表和端口集合中的TCP端口, 按端口号排序
+func namedTcpPorts() (ports []uint16) {
+	var set portSet
+	for _, _port := range TcpServices {
+		set.add(_port)
+	}
+	for _, ports := range PortSets {
+		for _, _port := range ports {
+			set.add(_port)
+		}
+	}
+	for _port := 1; _port <= 65535; _port++ {
+		if set.has(uint16(_port)) {
+			ports = append(ports, uint16(_port))
+		}
+	}
+	return
+}
+
+// portRange start到end的所有端口
+func portRange(start, end uint16) (ports []uint16) {
+	ports = make([]uint16, 0, int(end)-int(start)+1)
+	for _port := int(start); _port <= int(end); _port++ {
+		ports = append(ports, uint16(_port))
+	}
+	return
+}
+
+// TopPorts 协议最常见的n个端口, n超出排序表的端口数时返回错误
+func TopPorts(protocol string, n int) ([]uint16, error) {
+	ranked := rankedPorts(protocol)
+	if n > len(ranked) {
+		return nil, fmt.Errorf("top%d: only %d %s ports are ranked, want top1-top%d", n, len(ranked), protocol, len(ranked))
+	}
+	return ranked[:n], nil
+}
+
+// DefaultTopPorts 协议默认扫描的常见端口, TCP为top1000, UDP和SCTP为排序表中的所有端口
+func DefaultTopPorts(protocol string) string {
+	if protocol == ProtocolTcp {
+		return "top1000"
+	}
+	return "top" + strconv.Itoa(len(rankedPorts(protocol)))
+}
+
+func rankedPorts(protocol string) []uint16 {
+	switch protocol {
+	case ProtocolUdp:
+		return RankedUdpPorts
+	case ProtocolSctp:
+		return RankedSctpPorts
+	}
+	return RankedTcpPorts
+}
+
+// portSet 端口集合, 位图
+type portSet [65536 / 64]uint64
+
+func (s *portSet) add(p uint16) {
+	s[p/64] |= 1 << (p % 64)
+}
+
+func (s *portSet) has(p uint16) bool {
+	return s[p/64]&(1<<(p%64)) != 0
+}
+
+// ranges 集合中的端口范围, 按端口号排序
+func (s *portSet) ranges() (out [][]uint16) {
+	for _port := uint32(1); _port <= 65535; _port++ {
+		if !s.has(uint16(_port)) {
+			continue
+		}
+		start := _port
+		for _port < 65535 && s.has(uint16(_port+1)) {
+			_port++
+		}
+		out = append(out, []uint16{uint16(start), uint16(_port)})
+	}
+	return
+}
+
+func (s *portSet) addRange(start, end uint16) {
+	for p := uint32(start); p <= uint32(end); p++ {
+		s.add(uint16(p))
+	}
+}
+
+// PortList 按协议解析后的端口, 各协议中排序表中的常见端口按常见程度在前, 其余端口为随机顺序
+type PortList struct {
+	Tcp  []uint16
+	Udp  []uint16
+	Sctp []uint16
+}
+
+// Ports 协议对应的端口
+func (pl PortList) Ports(protocol string) []uint16 {
+	switch protocol {
+	case ProtocolTcp:
+		return pl.Tcp
+	case ProtocolUdp:
+		return pl.Udp
+	case ProtocolSctp:
+		return pl.Sctp
+	}
+	return nil
+}
+
+// Protocols 有端口的协议
+func (pl PortList) Protocols() (protocols []string) {
+	for _, protocol := range []string{ProtocolTcp, ProtocolUdp, ProtocolSctp} {
+		if len(pl.Ports(protocol)) > 0 {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return
+}
+
+// Len 所有协议的端口数
+func (pl PortList) Len() int {
+	return len(pl.Tcp) + len(pl.Udp) + len(pl.Sctp)
+}
+
+// Get 第i个端口及其协议, 依次为Tcp、Udp、Sctp的端口
+func (pl PortList) Get(i int) (_port uint16, protocol string) {
+	if i < len(pl.Tcp) {
+		return pl.Tcp[i], ProtocolTcp
+	}
+	if i -= len(pl.Tcp); i < len(pl.Udp) {
+		return pl.Udp[i], ProtocolUdp
+	}
+	return pl.Sctp[i-len(pl.Udp)], ProtocolSctp
+}
+
+// ParsePortList 解析端口参数, 逗号分隔, protocol为没有协议前缀的端口的协议
+// 端口(80)、范围(8000-9000)、所有端口(-)、最常见的N个端口(top100, top1000)、服务名(http,ssh)、端口集合(web,db),
+// !开头为排除(!9100, !8000-8100), 协议前缀(T:80, U:53, S:2905)对之后的端口生效直到下一个前缀
+func ParsePortList(portStr string, protocol string) (pl PortList, err error) {
+	sets, err := parsePortSets(portStr, protocol)
+	if err != nil {
+		return
+	}
+	pl.Tcp = orderPorts(sets[ProtocolTcp], RankedTcpPorts)
+	pl.Udp = orderPorts(sets[ProtocolUdp], RankedUdpPorts)
+	pl.Sctp = orderPorts(sets[ProtocolSctp], RankedSctpPorts)
+	if pl.Len() == 0 {
+		err = fmt.Errorf("no port in %q", portStr)
+	}
+	return
+}
+
+// parsePortSets 解析端口参数为各协议的端口集合, 已去除排除的端口
+func parsePortSets(portStr string, protocol string) (sets map[string]*portSet, err error) {
+	include := make(map[string]*portSet)
+	exclude := make(map[string]*portSet)
+	get := func(m map[string]*portSet, protocol string) *portSet {
+		if m[protocol] == nil {
+			m[protocol] = new(portSet)
+		}
+		return m[protocol]
+	}
+	for _, item := range strings.Split(portStr, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if prefix, rest, ok := strings.Cut(item, ":"); ok {
+			switch prefix {
+			case "t":
+				protocol = ProtocolTcp
+			case "u":
+				protocol = ProtocolUdp
+			case "s":
+				protocol = ProtocolSctp
+			default:
+				return nil, fmt.Errorf("invalid protocol prefix %q, want T:, U: or S:", prefix+":")
+			}
+			item = rest
+		}
+		set := get(include, protocol)
+		if strings.HasPrefix(item, "!") {
+			set = get(exclude, protocol)
+			item = item[1:]
+		}
+		if item == "" {
+			return nil, fmt.Errorf("empty port in %q", portStr)
+		}
+		if err = addPortItem(set, item, protocol); err != nil {
+			return
+		}
+	}
+	for protocol, set := range include {
+		if ex := exclude[protocol]; ex != nil {
+			for i := range set {
+				set[i] &^= ex[i]
+			}
+		}
+		set[0] &^= 1 // 端口0
+	}
+	return include, nil
+}
+
+// addPortItem 解析一项端口并加入集合
+func addPortItem(set *portSet, item string, protocol string) error {
+	if item == "-" {
+		set.addRange(1, 65535)
+		return nil
+	}
+	if item[0] >= '0' && item[0] <= '9' {
+		start, end, err := parsePortRange(item)
+		if err != nil {
+			return err
+		}
+		set.addRange(start, end)
+		return nil
+	}
+	if strings.HasPrefix(item, "top") && isDigits(item[3:]) {
+		n, err := strconv.Atoi(item[3:])
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid top ports %q, want top1-top65535", item)
+		}
+		ports, err := TopPorts(protocol, n)
+		if err != nil {
+			return err
+		}
+		for _, _port := range ports {
+			set.add(_port)
+		}
+		return nil
+	}
+	if ports, ok := PortSets[item]; ok {
+		for _, _port := range ports {
+			set.add(_port)
+		}
+		return nil
+	}
+	var services map[string]uint16
+	switch protocol {
+	case ProtocolUdp:
+		services = UdpServices
+	case ProtocolSctp:
+		services = SctpServices
+	default:
+		services = TcpServices
+	}
+	if _port, ok := services[item]; ok {
+		set.add(_port)
+		return nil
+	}
+	return fmt.Errorf("unknown %s service or port %q", protocol, item)
+}
+
+// parsePortRange 解析端口或端口范围, eg: 80, 8000-9000
+func parsePortRange(item string) (start, end uint16, err error) {
+	startStr, endStr, isRange := strings.Cut(item, "-")
+	if start, err = parsePort(startStr); err != nil {
+		return
+	}
+	end = start
+	if isRange {
+		if endStr == "" {
+			return 0, 0, fmt.Errorf("invalid port range %q, missing end port", item)
+		}
+		if end, err = parsePort(endStr); err != nil {
+			return
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("invalid port range %q, start is greater than end", item)
+		}
+	}
+	return
+}
+
+func parsePort(s string) (uint16, error) {
+	if !isDigits(s) {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	p, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("port %s out of range 0-65535", s)
+	}
+	return uint16(p), nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// orderPorts 排序表中的端口按常见程度在前, 其余端口随机化, 相同参数的顺序相同
+func orderPorts(set *portSet, ranked []uint16) (ports []uint16) {
+	if set == nil {
+		return
+	}
+	var selected portSet
+	for _, _port := range ranked {
+		if set.has(_port) {
+			selected.add(_port)
+			ports = append(ports, _port)
+		}
+	}
+	skip := uint64(len(ports)) // 跳过Top
+	for _port := 1; _port <= 65535; _port++ {
+		if set.has(uint16(_port)) && !selected.has(uint16(_port)) {
+			ports = append(ports, uint16(_port))
+		}
+	}
+	// 端口随机化
+	_ports := make([]uint16, len(ports))
+	copy(_ports, ports)
+	sf := util.NewShuffle(uint64(len(ports)) - skip)
+	if sf != nil {
+		for i := skip; i < uint64(len(_ports)); i++ {
+			ports[i] = _ports[skip+sf.Get(i-skip)]
+		}
+	}
+	return
+}
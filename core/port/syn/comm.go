@@ -7,6 +7,13 @@ import (
 
 var ErrorNoSyn = errors.New("no syn support")
 
+// 收发包方式, 对应 port.ScannerOption.Backend, 为空时优先使用pcap
+const (
+	BackendPcap     = "pcap"
+	BackendAfPacket = "afpacket" // linux only, 无需libpcap
+	BackendTPacket  = "tpacket"  // linux only, AF_PACKET TPACKET_V3 环形缓冲区批量收发, 高速率扫描
+)
+
 var DefaultSynOption = port.ScannerOption{
 	Rate:     1500,
 	MiniRate: 500,
@@ -0,0 +1,58 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/twmb/murmur3"
+	"net"
+)
+
+// 源端口范围, 用于过滤无关的包
+const (
+	srcPortMin   = 49000
+	srcPortRange = 10000
+)
+
+// synCookie 无状态校验: 源端口和初始序列号由(目的IP, 目的端口, 扫描密钥)的哈希计算得出, ref masscan
+type synCookie struct {
+	k0, k1 uint64 // 扫描密钥
+}
+
+func newSynCookie() *synCookie {
+	var key [16]byte
+	rand.Read(key[:])
+	return &synCookie{
+		k0: binary.BigEndian.Uint64(key[:8]),
+		k1: binary.BigEndian.Uint64(key[8:]),
+	}
+}
+
+// Get 计算发送探测包时使用的源端口和序列号
+func (c *synCookie) Get(ip net.IP, dst uint16) (srcPort uint16, seq uint32) {
+	var data [18]byte
+	copy(data[:16], ip.To16())
+	binary.BigEndian.PutUint16(data[16:], dst)
+	h1, h2 := murmur3.SeedSum128(c.k0, c.k1, data[:])
+	return uint16(srcPortMin + h1%srcPortRange), uint32(h2)
+}
+
+// Verify 校验响应包: ip、port为响应包的源地址, dstPort为响应包的目的端口, seq、ack为响应包的序列号和确认号
+// 带ACK标志的响应, 确认号为探测包序列号(SYN、FIN占用一个序列号时+1); 否则序列号为探测包的确认号(ACK扫描)
+func (c *synCookie) Verify(ip net.IP, port, dstPort uint16, seq, ack uint32, hasAck bool) bool {
+	srcPort, cookie := c.Get(ip, port)
+	if srcPort != dstPort {
+		return false
+	}
+	if hasAck {
+		return ack == cookie+1 || ack == cookie
+	}
+	return seq == cookie
+}
+
+// Match 校验探测包的源端口和序列号(SCTP为Initiate Tag), 用于ICMP引用的原始包和SCTP响应
+func (c *synCookie) Match(ip net.IP, port, srcPort uint16, seq uint32) bool {
+	cookiePort, cookie := c.Get(ip, port)
+	return cookiePort == srcPort && cookie == seq
+}
@@ -0,0 +1,32 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSynCookie(t *testing.T) {
+	c := newSynCookie()
+	ip := net.ParseIP("192.168.1.1")
+	srcPort, seq := c.Get(ip, 80)
+	if srcPort < srcPortMin || srcPort >= srcPortMin+srcPortRange {
+		t.Fatal("src port out of range:", srcPort)
+	}
+	// ipv4 To4 与 To16 结果一致
+	if srcPort2, seq2 := c.Get(ip.To4(), 80); srcPort2 != srcPort || seq2 != seq {
+		t.Fatal("cookie not stable")
+	}
+	if !c.Verify(ip, 80, srcPort, 0, seq+1, true) || !c.Verify(ip, 80, srcPort, seq, 0, false) {
+		t.Error("valid reply rejected")
+	}
+	if c.Verify(ip, 81, srcPort, 0, seq+1, true) || c.Verify(ip, 80, srcPort, 0, seq+2, true) ||
+		c.Verify(ip, 80, srcPort, seq+1, 0, false) || c.Verify(net.ParseIP("192.168.1.2"), 80, srcPort, 0, seq+1, true) {
+		t.Error("invalid reply accepted")
+	}
+	// 不同扫描密钥
+	if srcPort2, seq2 := newSynCookie().Get(ip, 80); srcPort2 == srcPort && seq2 == seq {
+		t.Error("secret not used")
+	}
+}
@@ -5,47 +5,12 @@ package syn
 import (
 	"errors"
 	"fmt"
-	"github.com/google/gopacket/pcap"
 	"github.com/google/gopacket/routing"
 	"github.com/jackpal/gateway"
 	"github.com/libp2p/go-netroute"
 	"net"
-	"strings"
 )
 
-func GetAllDevs() (string, error) {
-	pcapDevices, err := pcap.FindAllDevs()
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("list pcapDevices failed: %s", err.Error()))
-	}
-	var buf strings.Builder
-	for _, dev := range pcapDevices {
-		buf.WriteString(fmt.Sprint("Dev:", dev.Name, "\tDes:", dev.Description))
-		if len(dev.Addresses) > 0 {
-			buf.WriteString(fmt.Sprint("\tAddr:", dev.Addresses[0].IP.String()))
-		}
-		buf.WriteString("\n")
-	}
-	return buf.String(), nil
-}
-
-// GetDevByIp get dev name by dev ip (use pcap)
-func GetDevByIp(ip net.IP) (devName string, err error) {
-	devices, err := pcap.FindAllDevs()
-	if err != nil {
-		return
-	}
-	for _, d := range devices {
-		for _, address := range d.Addresses {
-			_ip := address.IP
-			if _ip != nil && _ip.IsGlobalUnicast() && _ip.Equal(ip) {
-				return d.Name, nil
-			}
-		}
-	}
-	return "", errors.New("can not find dev")
-}
-
 // GetIfaceMac get interface mac addr by interface ip (use golang net)
 func GetIfaceMac(ifaceAddr net.IP) (src net.IP, src6 net.IP, mac net.HardwareAddr) {
 	interfaces, _ := net.Interfaces()
@@ -107,19 +72,28 @@ func GetMacByGw(gw net.IP) (srcIp net.IP, srcIp6 net.IP, srcMac net.HardwareAddr
 
 // GetRouter get ipv6 router by dst ip
 func GetRouter(dst net.IP) (srcIp net.IP, srcIp6 net.IP, srcMac net.HardwareAddr, gw net.IP, devName string, err error) {
+	r, err := netroute.New()
+	if err != nil {
+		r = nil
+	}
+	return getRouter(r, dst)
+}
+
+// getRouter 使用已加载的路由表r选路, r为nil时取第一个默认路由
+func getRouter(r routing.Router, dst net.IP) (srcIp net.IP, srcIp6 net.IP, srcMac net.HardwareAddr, gw net.IP, devName string, err error) {
 	// 同网段
 	srcIp, srcIp6, srcMac = GetIfaceMac(dst)
-	if srcIp == nil {
-		var r routing.Router
-		r, err = netroute.New()
-		if err == nil {
+	if srcMac == nil {
+		if r == nil {
+			err = errors.New("no routing table")
+		} else {
 			var sip net.IP
 			_, gw, sip, err = r.Route(dst)
 			if err == nil {
 				srcIp, srcIp6, srcMac = GetIfaceMac(sip)
 			}
 		}
-		if err != nil || srcMac == nil {
+		if (err != nil || srcMac == nil) && dst.To4() != nil {
 			// 取第一个默认路由
 			gw, err = gateway.DiscoverGateway()
 			if err == nil {
@@ -133,7 +107,11 @@ func GetRouter(dst net.IP) (srcIp net.IP, srcIp6 net.IP, srcMac net.HardwareAddr
 	if srcIp.To4() != nil {
 		srcIp = srcIp.To4()
 	}
-	devName, err = GetDevByIp(srcIp)
+	if srcIp != nil {
+		devName, err = GetDevByIp(srcIp)
+	} else {
+		devName, err = GetDevByIp(srcIp6)
+	}
 	if (srcIp == nil && srcIp6 == nil) || err != nil || srcMac == nil {
 		if err == nil {
 			err = fmt.Errorf("err")
@@ -0,0 +1,49 @@
+//go:build !nosyn && nopcap
+
+package syn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+func GetAllDevs() (string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("list interfaces failed: %s", err.Error()))
+	}
+	var buf strings.Builder
+	for _, iface := range interfaces {
+		buf.WriteString(fmt.Sprint("Dev:", iface.Name, "\tDes:", iface.Flags.String()))
+		if addrs, err := iface.Addrs(); err == nil && len(addrs) > 0 {
+			if ipNet, ok := addrs[0].(*net.IPNet); ok {
+				buf.WriteString(fmt.Sprint("\tAddr:", ipNet.IP.String()))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// GetDevByIp get dev name by dev ip (use golang net)
+func GetDevByIp(ip net.IP) (devName string, err error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.IsGlobalUnicast() && ipNet.IP.Equal(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", errors.New("can not find dev")
+}
@@ -0,0 +1,44 @@
+//go:build !nosyn && !nopcap
+
+package syn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/gopacket/pcap"
+	"net"
+	"strings"
+)
+
+func GetAllDevs() (string, error) {
+	pcapDevices, err := pcap.FindAllDevs()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("list pcapDevices failed: %s", err.Error()))
+	}
+	var buf strings.Builder
+	for _, dev := range pcapDevices {
+		buf.WriteString(fmt.Sprint("Dev:", dev.Name, "\tDes:", dev.Description))
+		if len(dev.Addresses) > 0 {
+			buf.WriteString(fmt.Sprint("\tAddr:", dev.Addresses[0].IP.String()))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// GetDevByIp get dev name by dev ip (use pcap)
+func GetDevByIp(ip net.IP) (devName string, err error) {
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return
+	}
+	for _, d := range devices {
+		for _, address := range d.Addresses {
+			_ip := address.IP
+			if _ip != nil && _ip.IsGlobalUnicast() && _ip.Equal(ip) {
+				return d.Name, nil
+			}
+		}
+	}
+	return "", errors.New("can not find dev")
+}
@@ -0,0 +1,36 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"fmt"
+	"net"
+)
+
+// packetHandle 原始包收发接口, SynScanner不关心底层是pcap还是AF_PACKET
+type packetHandle interface {
+	// ReadPacketData 读取一个以太网帧, 返回的数据可被调用方持有; 关闭后返回io.EOF
+	ReadPacketData() ([]byte, error)
+	// WritePacketData 发送一个完整的以太网帧
+	WritePacketData(data []byte) error
+	Close()
+}
+
+// openHandle 按backend打开dev的收发包句柄, 只接收目的MAC为srcMac的相关包
+func openHandle(backend, devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	switch backend {
+	case BackendPcap:
+		return openPcapHandle(devName, srcMac, srcIp)
+	case BackendAfPacket:
+		return openAfPacketHandle(devName, srcMac, srcIp)
+	case BackendTPacket:
+		return openTPacketHandle(devName, srcMac, srcIp)
+	case "":
+		if hasPcap {
+			return openPcapHandle(devName, srcMac, srcIp)
+		}
+		return openAfPacketHandle(devName, srcMac, srcIp)
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", backend)
+	}
+}
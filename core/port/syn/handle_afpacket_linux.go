@@ -0,0 +1,158 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"encoding/binary"
+	"errors"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// afPacketHandle AF_PACKET原始套接字, 不依赖libpcap, 可用于静态编译
+type afPacketHandle struct {
+	fd     int
+	buf    []byte
+	lock   sync.RWMutex // 读写期间不关闭fd, 避免fd被复用
+	closed bool
+}
+
+func htons(i uint16) uint16 {
+	return i<<8 | i>>8
+}
+
+func openAfPacketHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	fd, err := packetSocket(srcMac)
+	if err != nil {
+		return nil, err
+	}
+	h := &afPacketHandle{fd: fd, buf: make([]byte, 2048)}
+	if err = bindPacketSocket(fd, devName); err != nil {
+		h.Close()
+		return nil, err
+	}
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 4<<20)
+	// 读超时, 用于Close后退出阻塞的读取
+	tv := unix.NsecToTimeval(int64(200 * time.Millisecond))
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		h.Close()
+		return nil, err
+	}
+	// 丢弃设置过滤器之前收到的包
+	for {
+		if _, _, err = unix.Recvfrom(fd, h.buf, unix.MSG_DONTWAIT); err != nil {
+			break
+		}
+	}
+	return h, nil
+}
+
+// packetSocket 创建AF_PACKET套接字并设置过滤器, 在绑定网卡前调用
+func packetSocket(srcMac net.HardwareAddr) (fd int, err error) {
+	filter, err := afPacketFilter(srcMac)
+	if err != nil {
+		return
+	}
+	fd, err = unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: (*unix.SockFilter)(unsafe.Pointer(&filter[0])),
+	}
+	if err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return
+}
+
+// bindPacketSocket 绑定网卡
+func bindPacketSocket(fd int, devName string) error {
+	iface, err := net.InterfaceByName(devName)
+	if err != nil {
+		return err
+	}
+	return unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: iface.Index})
+}
+
+// afPacketFilter 与pcap过滤表达式近似的BPF程序: 目的MAC为本机, ARP或 IPv4/IPv6 的TCP、SCTP、ICMP包, 其余由recv校验
+func afPacketFilter(srcMac net.HardwareAddr) ([]bpf.RawInstruction, error) {
+	if len(srcMac) != 6 {
+		return nil, errors.New("invalid src mac")
+	}
+	const (
+		drop   = 15
+		accept = 16
+	)
+	// skip 为目标指令下标减去下一条指令下标
+	skip := func(from, to int) uint8 {
+		return uint8(to - from - 1)
+	}
+	return bpf.Assemble([]bpf.Instruction{
+		/* 0 */ bpf.LoadAbsolute{Off: 0, Size: 4},
+		/* 1 */ bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: binary.BigEndian.Uint32(srcMac[:4]), SkipTrue: skip(1, drop)},
+		/* 2 */ bpf.LoadAbsolute{Off: 4, Size: 2},
+		/* 3 */ bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(binary.BigEndian.Uint16(srcMac[4:])), SkipTrue: skip(3, drop)},
+		/* 4 */ bpf.LoadAbsolute{Off: 12, Size: 2}, // ether type
+		/* 5 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0806, SkipTrue: skip(5, accept)},
+		/* 6 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd, SkipTrue: skip(6, 11)},
+		/* 7 */ bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 0x0800, SkipTrue: skip(7, drop)},
+		/* 8 */ bpf.LoadAbsolute{Off: 14 + 9, Size: 1}, // ipv4 protocol
+		/* 9 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1, SkipTrue: skip(9, accept)},
+		/* 10 */ bpf.Jump{Skip: uint32(skip(10, 13))},
+		/* 11 */ bpf.LoadAbsolute{Off: 14 + 6, Size: 1}, // ipv6 next header
+		/* 12 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 58, SkipTrue: skip(12, accept)},
+		/* 13 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 6, SkipTrue: skip(13, accept)},
+		/* 14 */ bpf.JumpIf{Cond: bpf.JumpEqual, Val: 132, SkipTrue: skip(14, accept)},
+		/* 15 */ bpf.RetConstant{Val: 0},
+		/* 16 */ bpf.RetConstant{Val: 1024},
+	})
+}
+
+func (h *afPacketHandle) ReadPacketData() ([]byte, error) {
+	for {
+		h.lock.RLock()
+		if h.closed {
+			h.lock.RUnlock()
+			return nil, io.EOF
+		}
+		n, _, err := unix.Recvfrom(h.fd, h.buf, 0)
+		h.lock.RUnlock()
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			return nil, err
+		}
+		data := make([]byte, n)
+		copy(data, h.buf[:n])
+		return data, nil
+	}
+}
+
+func (h *afPacketHandle) WritePacketData(data []byte) error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if h.closed {
+		return io.EOF
+	}
+	_, err := unix.Write(h.fd, data)
+	return err
+}
+
+// Close 等待正在进行的读取超时返回后关闭
+func (h *afPacketHandle) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.closed {
+		h.closed = true
+		unix.Close(h.fd)
+	}
+}
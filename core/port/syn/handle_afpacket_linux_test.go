@@ -0,0 +1,71 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+	"net"
+	"testing"
+)
+
+func TestAfPacketFilter(t *testing.T) {
+	srcMac := net.HardwareAddr{0x00, 0x0c, 0x29, 0x01, 0x02, 0x03}
+	raw, err := afPacketFilter(srcMac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insts, _ := bpf.Disassemble(raw)
+	vm, err := bpf.NewVM(insts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := func(dstMac net.HardwareAddr, l ...gopacket.SerializableLayer) []byte {
+		buf := gopacket.NewSerializeBuffer()
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: dstMac, EthernetType: layers.EthernetTypeIPv4}
+		if len(l) > 0 {
+			switch l[0].(type) {
+			case *layers.IPv6:
+				eth.EthernetType = layers.EthernetTypeIPv6
+			case *layers.ARP:
+				eth.EthernetType = layers.EthernetTypeARP
+			}
+		}
+		gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, append([]gopacket.SerializableLayer{eth}, l...)...)
+		return buf.Bytes()
+	}
+	ip4 := func(proto layers.IPProtocol) *layers.IPv4 {
+		return &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: proto, SrcIP: net.IPv4(1, 1, 1, 1), DstIP: net.IPv4(2, 2, 2, 2)}
+	}
+	ip6 := func(proto layers.IPProtocol) *layers.IPv6 {
+		return &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: proto, SrcIP: net.ParseIP("::1"), DstIP: net.ParseIP("::2")}
+	}
+	payload := gopacket.Payload(make([]byte, 20))
+
+	cases := []struct {
+		name   string
+		data   []byte
+		accept bool
+	}{
+		{"arp", packet(srcMac, &layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+			SourceHwAddress: make([]byte, 6), SourceProtAddress: make([]byte, 4), DstHwAddress: make([]byte, 6), DstProtAddress: make([]byte, 4)}), true},
+		{"tcp", packet(srcMac, ip4(layers.IPProtocolTCP), payload), true},
+		{"icmp", packet(srcMac, ip4(layers.IPProtocolICMPv4), payload), true},
+		{"sctp6", packet(srcMac, ip6(layers.IPProtocolSCTP), payload), true},
+		{"icmp6", packet(srcMac, ip6(layers.IPProtocolICMPv6), payload), true},
+		{"udp", packet(srcMac, ip4(layers.IPProtocolUDP), payload), false},
+		{"udp6", packet(srcMac, ip6(layers.IPProtocolUDP), payload), false},
+		{"other mac", packet(net.HardwareAddr{0x00, 0x0c, 0x29, 0x01, 0x02, 0x04}, ip4(layers.IPProtocolTCP), payload), false},
+	}
+	for _, c := range cases {
+		n, err := vm.Run(c.data)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		if (n > 0) != c.accept {
+			t.Errorf("%s: got %d", c.name, n)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !nosyn && !linux
+
+package syn
+
+import (
+	"errors"
+	"net"
+)
+
+func openAfPacketHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	return nil, errors.New("afpacket backend is only supported on linux")
+}
+
+func openTPacketHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	return nil, errors.New("tpacket backend is only supported on linux")
+}
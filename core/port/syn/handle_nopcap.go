@@ -0,0 +1,14 @@
+//go:build !nosyn && nopcap
+
+package syn
+
+import (
+	"errors"
+	"net"
+)
+
+const hasPcap = false
+
+func openPcapHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	return nil, errors.New("pcap backend is not compiled in (nopcap)")
+}
@@ -0,0 +1,79 @@
+//go:build !nosyn && !nopcap
+
+package syn
+
+import (
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"net"
+	"runtime"
+	"time"
+)
+
+const hasPcap = true
+
+type pcapHandle struct {
+	handle  *pcap.Handle
+	devName string
+	srcMac  net.HardwareAddr
+	srcIp   net.IP
+}
+
+func openPcapHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	// 每个包最大读取长度1024, 不开启混杂模式, no TimeOut
+	handle, err := pcap.OpenLive(devName, 1024, false, pcap.BlockForever)
+	if err != nil {
+		return nil, err
+	}
+	// Set filter, Reduce the number of monitoring packets
+	handle.SetBPFFilter(fmt.Sprintf("ether dst %s && (arp || tcp[tcpflags] == tcp-syn|tcp-ack || tcp[tcpflags] & tcp-rst != 0 || ((ip6[6] = 6) && (ip6[53] & 0x07 != 0)) || sctp || icmp[icmptype] == icmp-unreach || ((ip6[6] = 58) && (ip6[40] = 1 || ip6[40] = 136)))", srcMac.String()))
+	return &pcapHandle{
+		handle:  handle,
+		devName: devName,
+		srcMac:  srcMac,
+		srcIp:   srcIp,
+	}, nil
+}
+
+func (h *pcapHandle) ReadPacketData() ([]byte, error) {
+	data, _, err := h.handle.ReadPacketData()
+	return data, err
+}
+
+func (h *pcapHandle) WritePacketData(data []byte) error {
+	return h.handle.WritePacketData(data)
+}
+
+func (h *pcapHandle) Close() {
+	// In linux, pcap can not stop when no packets to sniff with BlockForever
+	// ref:https://github.com/google/gopacket/issues/890
+	// ref:https://github.com/google/gopacket/issues/1089
+	if runtime.GOOS == "linux" {
+		eth := layers.Ethernet{
+			SrcMAC:       h.srcMac,
+			DstMAC:       h.srcMac,
+			EthernetType: layers.EthernetTypeARP,
+		}
+		arp := layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPReply,
+			SourceHwAddress:   []byte(h.srcMac),
+			SourceProtAddress: []byte(h.srcIp),
+			DstHwAddress:      []byte(h.srcMac),
+			DstProtAddress:    []byte(h.srcIp),
+		}
+		handle, err := pcap.OpenLive(h.devName, 1024, false, time.Second)
+		if err == nil {
+			buf := gopacket.NewSerializeBuffer()
+			gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, &eth, &arp)
+			handle.WritePacketData(buf.Bytes())
+			handle.Close()
+		}
+	}
+	h.handle.Close()
+}
@@ -0,0 +1,242 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	tpacketFrameSize    = 2048
+	tpacketRxBlockSize  = 1 << 20
+	tpacketRxBlockNr    = 16
+	tpacketTxBlockSize  = 1 << 16
+	tpacketTxBlockNr    = 64
+	tpacketRetireTov    = 10                     // ms, 未填满的接收块最长等待时间
+	tpacketTxBatch      = 64                     // 待发送帧数达到该值时提交
+	tpacketTxDataOffset = unix.SizeofTpacket3Hdr // TPACKET_ALIGN(sizeof(tpacket3_hdr))
+)
+
+// tpacketHandle AF_PACKET TPACKET_V3 收发环形缓冲区, 批量收发包以减少系统调用
+type tpacketHandle struct {
+	fd     int
+	ring   []byte // mmap: rx ring + tx ring
+	rxRing []byte
+	txRing []byte
+
+	// rx, 只在recv协程中读取
+	rxBlock  int // 当前块
+	rxPkt    int // 当前块中已读取的包数
+	rxOffset int // 下一个包在块中的偏移
+
+	// tx
+	txLock    sync.Mutex
+	txHead    int
+	txFrameNr int
+	txPending int
+
+	lock   sync.RWMutex // 读写期间不释放ring和fd
+	closed bool
+	done   chan struct{}
+}
+
+func openTPacketHandle(devName string, srcMac net.HardwareAddr, srcIp net.IP) (packetHandle, error) {
+	fd, err := packetSocket(srcMac)
+	if err != nil {
+		return nil, err
+	}
+	h := &tpacketHandle{fd: fd, done: make(chan struct{})}
+	if err = h.setup(devName); err != nil {
+		if h.ring != nil {
+			unix.Munmap(h.ring)
+		}
+		unix.Close(fd)
+		return nil, err
+	}
+	go h.flushLoop()
+	return h, nil
+}
+
+func (h *tpacketHandle) setup(devName string) (err error) {
+	if err = unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
+		return
+	}
+	// 跳过格式错误的帧, 不影响后续发送
+	unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_LOSS, 1)
+	// 绕过qdisc直接发送 (linux 3.14+)
+	unix.SetsockoptInt(h.fd, unix.SOL_PACKET, unix.PACKET_QDISC_BYPASS, 1)
+
+	rxReq := unix.TpacketReq3{
+		Block_size:     tpacketRxBlockSize,
+		Block_nr:       tpacketRxBlockNr,
+		Frame_size:     tpacketFrameSize,
+		Frame_nr:       tpacketRxBlockSize / tpacketFrameSize * tpacketRxBlockNr,
+		Retire_blk_tov: tpacketRetireTov,
+	}
+	if err = unix.SetsockoptTpacketReq3(h.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &rxReq); err != nil {
+		return
+	}
+	txReq := unix.TpacketReq3{
+		Block_size: tpacketTxBlockSize,
+		Block_nr:   tpacketTxBlockNr,
+		Frame_size: tpacketFrameSize,
+		Frame_nr:   tpacketTxBlockSize / tpacketFrameSize * tpacketTxBlockNr,
+	}
+	if err = unix.SetsockoptTpacketReq3(h.fd, unix.SOL_PACKET, unix.PACKET_TX_RING, &txReq); err != nil {
+		return
+	}
+	rxSize := tpacketRxBlockSize * tpacketRxBlockNr
+	txSize := tpacketTxBlockSize * tpacketTxBlockNr
+	h.ring, err = unix.Mmap(h.fd, 0, rxSize+txSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return
+	}
+	h.rxRing = h.ring[:rxSize]
+	h.txRing = h.ring[rxSize:]
+	h.txFrameNr = int(txReq.Frame_nr)
+	return bindPacketSocket(h.fd, devName)
+}
+
+// ReadPacketData 从RX环中读取一个包, 无包时等待内核填充, 关闭后返回io.EOF
+func (h *tpacketHandle) ReadPacketData() ([]byte, error) {
+	for {
+		h.lock.RLock()
+		if h.closed {
+			h.lock.RUnlock()
+			return nil, io.EOF
+		}
+		data, ok := h.nextPacket()
+		if !ok {
+			_, err := unix.Poll([]unix.PollFd{{Fd: int32(h.fd), Events: unix.POLLIN | unix.POLLERR}}, 100)
+			if err != nil && err != unix.EINTR {
+				h.lock.RUnlock()
+				return nil, err
+			}
+		}
+		h.lock.RUnlock()
+		if ok {
+			return data, nil
+		}
+	}
+}
+
+// nextPacket 读取当前块中的下一个包, 当前块读完后交还内核
+func (h *tpacketHandle) nextPacket() ([]byte, bool) {
+	for {
+		block := h.rxRing[h.rxBlock*tpacketRxBlockSize : (h.rxBlock+1)*tpacketRxBlockSize]
+		hdr := (*unix.TpacketHdrV1)(unsafe.Pointer(&block[unsafe.Offsetof(unix.TpacketBlockDesc{}.Hdr)]))
+		if atomic.LoadUint32(&hdr.Block_status)&unix.TP_STATUS_USER == 0 {
+			return nil, false
+		}
+		if h.rxPkt == 0 {
+			h.rxOffset = int(hdr.Offset_to_first_pkt)
+		}
+		if h.rxPkt < int(hdr.Num_pkts) {
+			pkt := (*unix.Tpacket3Hdr)(unsafe.Pointer(&block[h.rxOffset]))
+			start := h.rxOffset + int(pkt.Mac)
+			data := make([]byte, pkt.Snaplen)
+			copy(data, block[start:])
+			h.rxPkt++
+			h.rxOffset += int(pkt.Next_offset)
+			return data, true
+		}
+		h.rxPkt = 0
+		atomic.StoreUint32(&hdr.Block_status, unix.TP_STATUS_KERNEL)
+		h.rxBlock = (h.rxBlock + 1) % tpacketRxBlockNr
+	}
+}
+
+// WritePacketData 将包写入TX环, 累计tpacketTxBatch个或由flushLoop定时提交
+func (h *tpacketHandle) WritePacketData(data []byte) error {
+	if len(data) > tpacketFrameSize-tpacketTxDataOffset {
+		return errors.New("packet too large for tx ring frame")
+	}
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if h.closed {
+		return io.EOF
+	}
+	h.txLock.Lock()
+	defer h.txLock.Unlock()
+
+	frame := h.txRing[h.txHead*tpacketFrameSize : (h.txHead+1)*tpacketFrameSize]
+	hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&frame[0]))
+	for {
+		status := atomic.LoadUint32(&hdr.Status)
+		if status == unix.TP_STATUS_AVAILABLE || status == unix.TP_STATUS_WRONG_FORMAT {
+			break
+		}
+		// 环已满, 提交并等待内核发送完成
+		if err := h.flush(); err != nil {
+			return err
+		}
+		unix.Poll([]unix.PollFd{{Fd: int32(h.fd), Events: unix.POLLOUT}}, 10)
+	}
+	copy(frame[tpacketTxDataOffset:], data)
+	hdr.Next_offset = 0
+	hdr.Len = uint32(len(data))
+	hdr.Snaplen = uint32(len(data))
+	atomic.StoreUint32(&hdr.Status, unix.TP_STATUS_SEND_REQUEST)
+	h.txHead = (h.txHead + 1) % h.txFrameNr
+	h.txPending++
+	if h.txPending >= tpacketTxBatch {
+		return h.flush()
+	}
+	return nil
+}
+
+// flush 提交TX环中待发送的帧, 需持有txLock
+func (h *tpacketHandle) flush() error {
+	if h.txPending == 0 {
+		return nil
+	}
+	err := unix.Sendto(h.fd, nil, unix.MSG_DONTWAIT, nil)
+	if err == unix.EAGAIN || err == unix.ENOBUFS {
+		return nil // 未提交的帧在下次flush时发送
+	}
+	h.txPending = 0
+	return err
+}
+
+// flushLoop 定时提交不足一批的帧, 避免ARP等包延迟
+func (h *tpacketHandle) flushLoop() {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.lock.RLock()
+			if !h.closed {
+				h.txLock.Lock()
+				h.flush()
+				h.txLock.Unlock()
+			}
+			h.lock.RUnlock()
+		}
+	}
+}
+
+// Close 提交剩余的帧, 等待正在进行的读写返回后释放ring
+func (h *tpacketHandle) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	h.txLock.Lock()
+	h.flush()
+	h.txLock.Unlock()
+	unix.Munmap(h.ring)
+	unix.Close(h.fd)
+}
@@ -0,0 +1,56 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTPacketHandle(t *testing.T) {
+	// 需要CAP_NET_RAW
+	mac := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	h, err := openTPacketHandle("lo", mac, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	frame := make([]byte, 60)
+	frame[12], frame[13] = 0x08, 0x06 // arp
+	num := tpacketTxBatch*3 + 1       // 最后一个由flushLoop提交
+	for i := 0; i < num; i++ {
+		frame[20] = byte(i)
+		if err = h.WritePacketData(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := make(map[byte]bool)
+	start := time.Now()
+	for len(seen) < num && time.Since(start) < 2*time.Second {
+		data, err := h.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == len(frame) && data[12] == 0x08 && data[13] == 0x06 {
+			seen[data[20]] = true
+		}
+	}
+	if len(seen) != num {
+		t.Errorf("recv %d/%d", len(seen), num)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		h.Close()
+	}()
+	for {
+		if _, err = h.ReadPacketData(); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		t.Error("read after close:", err)
+	}
+}
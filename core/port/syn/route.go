@@ -0,0 +1,260 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"io"
+	"net"
+	"time"
+)
+
+// netIface 已打开收发包句柄的网卡, 每个网卡一个recv
+type netIface struct {
+	devName       string
+	srcMac        net.HardwareAddr
+	srcIp, srcIp6 net.IP
+	handle        packetHandle
+}
+
+// route 目的地址的出口网卡和下一跳
+type route struct {
+	ifc   *netIface
+	srcIp net.IP           // 与目的地址同协议族的源IP
+	gwMac net.HardwareAddr // 下一跳MAC, 同网段时为nil, 按目的IP解析MAC
+	tmpl  *tcpTemplate     // TCP探测包模板
+
+	hop    string        // 网卡+下一跳+源IP
+	ready  chan struct{} // 解析下一跳MAC后关闭, 之后才能使用路由
+	err    error         // 选路或解析下一跳MAC失败
+	expire time.Time     // 失败的路由过期后重新选路
+}
+
+// routeRetry 选路失败后重新选路的间隔
+const routeRetry = 10 * time.Second
+
+// routeKey 路由缓存键: 网段地址(IPv4使用IPv6映射地址)+前缀长度
+type routeKey [17]byte
+
+func newRouteKey(ip net.IP, ones int) (k routeKey) {
+	copy(k[:16], ip.To16())
+	for i := ones / 8; i < 16; i++ {
+		if i == ones/8 {
+			k[i] &^= 0xff >> (ones % 8)
+		} else {
+			k[i] = 0
+		}
+	}
+	k[16] = byte(ones)
+	return
+}
+
+// localNet 本机网卡的网段
+type localNet struct {
+	ipNet *net.IPNet
+	ones  int // 按IPv6映射地址计算的前缀长度
+}
+
+// getLocalNets 获取本机网卡的网段, 网段内的目的地址直接解析其MAC
+func getLocalNets() (nets []localNet) {
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || !ipNet.IP.IsGlobalUnicast() {
+				continue
+			}
+			ones, bits := ipNet.Mask.Size()
+			if bits == 32 {
+				ones += 96
+			}
+			nets = append(nets, localNet{ipNet: ipNet, ones: ones})
+		}
+	}
+	return
+}
+
+// routeKeyOf 路由缓存的网段, 网段内的目的地址使用相同的路由
+// 同网段的按本机网段, 其它按/24(IPv6为/64), 都与其中更具体的路由网段相交时按最长的路由网段;
+// 没有路由表的网段时按目的IP; 指定下一跳或没有路由表时所有地址使用默认路由
+func (ss *SynScanner) routeKeyOf(dstIp net.IP) routeKey {
+	isV4 := dstIp.To4() != nil
+	if ss.nextHop != nil || ss.router == nil {
+		if isV4 {
+			return newRouteKey(dstIp, 96)
+		}
+		return newRouteKey(dstIp, 0)
+	}
+	base, local := 64, false
+	if isV4 {
+		base = 96 + 24
+	}
+	for _, n := range ss.localNets {
+		if n.ipNet.Contains(dstIp) {
+			base, local = n.ones, true
+			break
+		}
+	}
+	if ss.routePrefixes == nil {
+		if local {
+			return newRouteKey(dstIp, base)
+		}
+		return newRouteKey(dstIp, 128)
+	}
+	key, ones := newRouteKey(dstIp, base), base
+	for _, p := range ss.routePrefixes {
+		if int(p[16]) > ones && newRouteKey(p[:16], base) == key {
+			ones = int(p[16])
+		}
+	}
+	return newRouteKey(dstIp, ones)
+}
+
+// getRoute 获取目的地址的路由, 首次使用的网卡打开收发包句柄并开始接收
+// 下一跳MAC在锁外解析, 使用同一下一跳的目的地址等待解析完成; 失败的路由缓存routeRetry后重新选路
+func (ss *SynScanner) getRoute(dstIp net.IP) (r *route, err error) {
+	key := ss.routeKeyOf(dstIp)
+	ss.routeLock.RLock()
+	r = ss.routeCache[key]
+	ss.routeLock.RUnlock()
+	if r == nil {
+		var gw net.IP
+		if r, gw, err = ss.addRoute(key, dstIp); err != nil {
+			return nil, err
+		}
+		if gw != nil {
+			ss.resolveRoute(r, gw)
+		}
+	}
+	<-r.ready
+	if r.err != nil {
+		if time.Now().After(r.expire) {
+			ss.routeLock.Lock()
+			if ss.routeCache[key] == r {
+				delete(ss.routeCache, key)
+			}
+			if ss.routes[r.hop] == r {
+				delete(ss.routes, r.hop)
+			}
+			ss.routeLock.Unlock()
+		}
+		return nil, r.err
+	}
+	return
+}
+
+// addRoute 选路并缓存, 新的下一跳返回gw, 由调用者解析其MAC
+func (ss *SynScanner) addRoute(key routeKey, dstIp net.IP) (r *route, gw net.IP, err error) {
+	ss.routeLock.Lock()
+	defer ss.routeLock.Unlock()
+	if r = ss.routeCache[key]; r != nil {
+		return
+	}
+	if ss.isDone {
+		return nil, nil, io.EOF
+	}
+	r, gw, err = ss.lookupRoute(dstIp)
+	if err != nil {
+		// 缓存失败, 避免每个探测包都重新选路
+		r, gw = &route{ready: make(chan struct{}), err: err, expire: time.Now().Add(routeRetry)}, nil
+		close(r.ready)
+		if ss.option.Debug {
+			fmt.Printf("[d] syn route: %s, %s\n", dstIp, err)
+		}
+	}
+	ss.routeCache[key] = r
+	return r, gw, nil
+}
+
+// lookupRoute 从路由表选路, 返回已有的或新建的路由, 新建的路由需要解析下一跳gw的MAC
+func (ss *SynScanner) lookupRoute(dstIp net.IP) (r *route, gw net.IP, err error) {
+	var srcIp, srcIp6 net.IP
+	var srcMac net.HardwareAddr
+	var devName string
+	if ss.nextHop != nil {
+		// specify dev
+		gw = ss.nextHop
+		srcIp, srcIp6, srcMac, devName, err = GetMacByGw(gw)
+	} else {
+		srcIp, srcIp6, srcMac, gw, devName, err = getRouter(ss.router, dstIp)
+	}
+	if err != nil {
+		return
+	}
+	if devName == "" {
+		return nil, nil, errors.New("get router info fail: no dev name")
+	}
+
+	ifc, ok := ss.ifaces[devName]
+	if !ok {
+		// Pcap or AF_PACKET
+		var handle packetHandle
+		handle, err = openHandle(ss.option.Backend, devName, srcMac, srcIp)
+		if err != nil {
+			return
+		}
+		ifc = &netIface{
+			devName: devName,
+			srcMac:  srcMac,
+			srcIp:   srcIp,
+			srcIp6:  srcIp6,
+			handle:  handle,
+		}
+		ss.ifaces[devName] = ifc
+		// start listen recv
+		go ss.recv(ifc)
+	}
+
+	if dstIp.To4() == nil {
+		srcIp = srcIp6
+	}
+	if srcIp == nil {
+		return nil, nil, fmt.Errorf("dev %s has no source ip for %s", devName, dstIp)
+	}
+
+	// 相同网卡、下一跳和源IP的网段共用路由
+	hop := devName + "|" + gw.String() + "|" + srcIp.String()
+	if r = ss.routes[hop]; r != nil {
+		return r, nil, nil
+	}
+	r = &route{ifc: ifc, srcIp: srcIp, hop: hop, ready: make(chan struct{})}
+	ss.routes[hop] = r
+	if ss.option.Debug {
+		fmt.Printf("[d] syn route: dev %s, src %s, gw %v\n", devName, srcIp, gw)
+	}
+	if gw == nil {
+		r.err = ss.buildTemplate(r)
+		r.expire = time.Now().Add(routeRetry)
+		close(r.ready)
+	}
+	return
+}
+
+// resolveRoute 解析下一跳的MAC并预构建探测包模板
+func (ss *SynScanner) resolveRoute(r *route, gw net.IP) {
+	defer close(r.ready)
+	// get gateway mac addr
+	if r.gwMac, r.err = ss.getHwAddr(r.ifc, gw); r.err == nil {
+		r.err = ss.buildTemplate(r)
+	}
+	if r.err != nil {
+		r.expire = time.Now().Add(routeRetry)
+		if ss.option.Debug {
+			fmt.Printf("[d] syn route: gw %s, %s\n", gw, r.err)
+		}
+	}
+}
+
+// buildTemplate 预构建TCP探测包模板
+func (ss *SynScanner) buildTemplate(r *route) (err error) {
+	if ss.option.ScanType != port.ScanTypeSctpInit {
+		r.tmpl, err = newTcpTemplate(r.ifc.srcMac, r.gwMac, r.srcIp, ss.probeTcp(0, 0, 0))
+	}
+	return
+}
@@ -0,0 +1,45 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// getRoutePrefixes 读取系统路由表(所有路由表)中路由的目的网段, 用于确定路由缓存的网段
+func getRoutePrefixes() (prefixes []routeKey, err error) {
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return
+	}
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		rt := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+		if rt.Table == syscall.RT_TABLE_LOCAL {
+			continue // 本机地址和广播地址的路由
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type != syscall.RTA_DST {
+				continue
+			}
+			ones := int(rt.Dst_len)
+			if len(attr.Value) == net.IPv4len {
+				ones += 96
+			}
+			prefixes = append(prefixes, newRouteKey(net.IP(attr.Value), ones))
+		}
+	}
+	return
+}
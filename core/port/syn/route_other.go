@@ -0,0 +1,10 @@
+//go:build !nosyn && !linux
+
+package syn
+
+import "errors"
+
+// getRoutePrefixes 只支持linux, 其它系统按目的IP缓存路由
+func getRoutePrefixes() (prefixes []routeKey, err error) {
+	return nil, errors.New("route prefixes are only supported on linux")
+}
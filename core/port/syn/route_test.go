@@ -0,0 +1,150 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testRouter 只用于表示已加载路由表
+type testRouter struct{}
+
+func (testRouter) Route(dst net.IP) (*net.Interface, net.IP, net.IP, error) {
+	return nil, nil, nil, nil
+}
+
+func (testRouter) RouteWithSrc(input net.HardwareAddr, src, dst net.IP) (*net.Interface, net.IP, net.IP, error) {
+	return nil, nil, nil, nil
+}
+
+func TestSynScanner_routeKeyOf(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("10.0.0.0/25")
+	ss := &SynScanner{
+		router:    testRouter{},
+		localNets: []localNet{{ipNet: lan, ones: 96 + 25}},
+		routePrefixes: []routeKey{
+			newRouteKey(net.ParseIP("1.1.0.0"), 96+16),
+			newRouteKey(net.ParseIP("1.1.2.16"), 96+28), // 1.1.2.0/24中更具体的路由
+			newRouteKey(net.ParseIP("2001:db8:0:2::"), 80),
+			newRouteKey(net.ParseIP("10.0.0.96"), 96+27), // 本机网段中更具体的路由
+		},
+	}
+	key := func(ip string) routeKey {
+		return ss.routeKeyOf(net.ParseIP(ip))
+	}
+
+	// 非本机网段按/24
+	if key("1.1.1.1") != key("1.1.1.200") || key("1.1.1.1") != ss.routeKeyOf(net.IPv4(1, 1, 1, 2).To4()) {
+		t.Error("same /24 got different key")
+	}
+	if key("1.1.1.1") == key("1.1.3.1") {
+		t.Error("different /24 got same key")
+	}
+	// 与更具体的路由相交的/24按该路由的网段
+	if key("1.1.2.1") != key("1.1.2.15") || key("1.1.2.17") != key("1.1.2.31") {
+		t.Error("same /28 got different key")
+	}
+	if key("1.1.2.1") == key("1.1.2.17") || key("1.1.2.17") == key("1.1.2.33") {
+		t.Error("more specific route shares key with its /24")
+	}
+	// 本机网段按网段掩码, 与同一/24中的路由网段区分; 本机网段中更具体的路由按该路由的网段
+	if key("10.0.0.1") != key("10.0.0.31") || key("10.0.0.97") != key("10.0.0.127") {
+		t.Error("same local net got different key")
+	}
+	if key("10.0.0.1") == key("10.0.0.97") {
+		t.Error("more specific route shares key with its local net")
+	}
+	if key("10.0.0.1") == key("10.0.0.129") {
+		t.Error("local net and routed net got same key")
+	}
+	// IPv6按/64
+	if key("2001:db8::1") != key("2001:db8::ffff:1") || key("2001:db8::1") == key("2001:db8:0:1::1") {
+		t.Error("ipv6 /64 key")
+	}
+	if key("2001:db8:0:2::1") == key("2001:db8:0:2:1::1") {
+		t.Error("ipv6 more specific route")
+	}
+	if newRouteKey(net.ParseIP("255.255.255.255"), 128) != newRouteKey(net.ParseIP("255.255.255.255"), 128) ||
+		newRouteKey(net.ParseIP("10.0.0.255"), 96+25)[15] != 0x80 {
+		t.Error("mask bits")
+	}
+
+	// 没有路由表的网段时按目的IP
+	ss.routePrefixes = nil
+	if key("1.1.1.1") == key("1.1.1.2") {
+		t.Error("no route prefixes, got same key")
+	}
+	// 指定下一跳时所有地址使用同一路由
+	ss.nextHop = net.ParseIP("10.0.0.1")
+	if key("1.1.1.1") != key("8.8.8.8") || key("1.1.1.1") == key("2001:db8::1") {
+		t.Error("next hop key")
+	}
+}
+
+func TestSynScanner_getRoute(t *testing.T) {
+	ss := &SynScanner{
+		nextHop:    net.ParseIP("203.0.113.1"), // 不在任何网卡的网段
+		ifaces:     make(map[string]*netIface),
+		routes:     make(map[string]*route),
+		routeCache: make(map[routeKey]*route),
+	}
+	dstIp := net.ParseIP("198.51.100.1")
+
+	// 失败的路由缓存, 过期后重新选路
+	if _, err := ss.getRoute(dstIp); err == nil {
+		t.Fatal("unknown next hop, want error")
+	}
+	r := ss.routeCache[ss.routeKeyOf(dstIp)]
+	if r == nil || r.err == nil {
+		t.Fatal("failed route not cached")
+	}
+	if _, err := ss.getRoute(dstIp); err != r.err {
+		t.Errorf("got %v, want cached %v", err, r.err)
+	}
+	r.expire = time.Now().Add(-time.Second)
+	ss.getRoute(dstIp)
+	if ss.routeCache[ss.routeKeyOf(dstIp)] == r {
+		t.Error("expired route not removed")
+	}
+
+	// 解析下一跳MAC时不持有锁, 使用该路由的目的地址等待解析完成
+	pending := &route{ready: make(chan struct{})}
+	ss.routeCache[ss.routeKeyOf(dstIp)] = pending
+	got := make(chan *route)
+	go func() {
+		r, _ := ss.getRoute(dstIp)
+		got <- r
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ss.routeLock.Lock()
+	ss.routeLock.Unlock()
+	select {
+	case <-got:
+		t.Fatal("got route before next hop resolved")
+	default:
+	}
+	close(pending.ready)
+	if r := <-got; r != pending {
+		t.Errorf("got %v, want resolved route", r)
+	}
+}
+
+func TestNewSynScannerRouteFail(t *testing.T) {
+	n := runtime.NumGoroutine()
+	option := DefaultSynOption
+	option.Backend = "unknown" // 打开网卡句柄失败
+	if _, err := NewSynScanner(net.ParseIP("1.1.1.1"), make(chan port.OpenIpPort), option); err == nil {
+		t.Fatal("want error")
+	}
+	// 选路失败后已启动的协程退出
+	for i := 0; i < 50 && runtime.NumGoroutine() > n; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > n {
+		t.Errorf("goroutines: got %d, want %d", got, n)
+	}
+}
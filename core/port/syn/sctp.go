@@ -0,0 +1,38 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket/layers"
+	"hash/crc32"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// sctpPacket 构造SCTP包(公共头+数据块), 并计算CRC32c校验和
+func sctpPacket(srcPort, dstPort uint16, vtag uint32, chunk []byte) []byte {
+	b := make([]byte, 12+len(chunk))
+	binary.BigEndian.PutUint16(b[0:2], srcPort)
+	binary.BigEndian.PutUint16(b[2:4], dstPort)
+	binary.BigEndian.PutUint32(b[4:8], vtag)
+	copy(b[12:], chunk)
+	binary.LittleEndian.PutUint32(b[8:12], crc32.Checksum(b, castagnoliTable))
+	return b
+}
+
+// sctpInitChunk INIT块, Initiate Tag 用于校验响应
+func sctpInitChunk(tag uint32) []byte {
+	b := make([]byte, 20)
+	b[0] = uint8(layers.SCTPChunkTypeInit)
+	binary.BigEndian.PutUint16(b[2:4], 20)
+	binary.BigEndian.PutUint32(b[4:8], tag)
+	binary.BigEndian.PutUint32(b[8:12], 65535) // a_rwnd
+	binary.BigEndian.PutUint16(b[12:14], 10)   // outbound streams
+	binary.BigEndian.PutUint16(b[14:16], 2048) // inbound streams
+	binary.BigEndian.PutUint32(b[16:20], tag)  // initial TSN
+	return b
+}
+
+// sctpAbortChunk ABORT块, 收到INIT-ACK后终止连接
+var sctpAbortChunk = []byte{uint8(layers.SCTPChunkTypeAbort), 0, 0, 4}
@@ -0,0 +1,31 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"hash/crc32"
+	"testing"
+)
+
+func TestSctpPacket(t *testing.T) {
+	b := sctpPacket(50000, 2905, 0, sctpInitChunk(0x12345678))
+	packet := gopacket.NewPacket(b, layers.LayerTypeSCTP, gopacket.Default)
+	sctp, _ := packet.Layer(layers.LayerTypeSCTP).(*layers.SCTP)
+	init, _ := packet.Layer(layers.LayerTypeSCTPInit).(*layers.SCTPInit)
+	if sctp == nil || init == nil {
+		t.Fatal(packet)
+	}
+	if sctp.SrcPort != 50000 || sctp.DstPort != 2905 || init.InitiateTag != 0x12345678 {
+		t.Error(sctp, init)
+	}
+
+	// 校验和计算时该字段为0
+	checksum := binary.LittleEndian.Uint32(b[8:12])
+	copy(b[8:12], []byte{0, 0, 0, 0})
+	if crc32.Checksum(b, castagnoliTable) != checksum {
+		t.Error("bad checksum")
+	}
+}
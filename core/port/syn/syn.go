@@ -4,55 +4,103 @@ package syn
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/XinRoom/go-portScan/core/port"
 	"github.com/XinRoom/go-portScan/core/port/fingerprint"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/routing"
+	"github.com/libp2p/go-netroute"
 	limiter "golang.org/x/time/rate"
 	"io"
 	"math/rand"
 	"net"
-	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type SynScanner struct {
-	srcMac, gwMac net.HardwareAddr // macAddr
-	devName       string           // eth dev(pcap)
-
-	// gateway (if applicable), and source IP addresses to use.
-	srcIp, srcIp6 net.IP
-
-	// pcap
-	handle *pcap.Handle
+	devName string // eth dev of first ip
+
+	// 按目的网段选择网卡、源IP和下一跳
+	router        routing.Router       // 系统路由表
+	nextHop       net.IP               // 指定的下一跳
+	localNets     []localNet           // 本机网段
+	routePrefixes []routeKey           // 路由表的目的网段, nil时按目的IP缓存路由
+	routeLock     sync.RWMutex         // 路由缓存锁
+	ifaces        map[string]*netIface // devName -> 网卡
+	routes        map[string]*route    // 网卡+下一跳+源IP -> 路由
+	routeCache    map[routeKey]*route  // 目的网段 -> 路由
 
 	// opts and buf allow us to easily serialize packets in the send() method.
 	opts gopacket.SerializeOptions
 
 	// Buffer复用
 	bufPool *sync.Pool
+	pktPool sync.Pool // *[]byte, 模板构建探测包使用
 
 	//
 	option         port.ScannerOption
 	openPortChan   chan port.OpenIpPort // inside chan
 	portProbeWg    sync.WaitGroup
+	pending        port.Pending         // 正在服务识别的端口
 	retChan        chan port.OpenIpPort // results chan
 	limiter        *limiter.Limiter
 	ctx            context.Context
+	cancel         context.CancelFunc
+	retryChan      chan retryProbe     // 重发队列
 	watchIpStatusT *watchIpStatusTable // IpStatusCacheTable
 	watchMacCacheT *watchMacCacheTable // MacCaches
+	macWait        map[string][]uint16 // 等待解析MAC的内网IP及其探测端口
+	macWaitLock    sync.Mutex          // macWait锁
+	cookie         *synCookie          // 无状态校验响应包
+	lastIpOption   atomic.Value        // *port.IpOption, 最近一次的IpOption(不含域名), 用于IP监视过期后收到的响应
 	isDone         bool
 
 	// stat
 	lastStatProbeTime time.Time
 	lastRate          int
-	lastMaxTokenTimes int // 连续最大可用Token次数
-	lastMinTokenTimes int // 连续最小可用Token次数
+	statSent          int64 // 发送的探测包数, 用于计算pps
+	lastMaxTokenTimes int   // 连续最大可用Token次数
+	lastMinTokenTimes int   // 连续最小可用Token次数
+	statRecv          int64 // 收到的有效响应数
+	statRetryHit      int64 // 重发后才收到的响应数, 表明存在丢包
+}
+
+type retryProbe struct {
+	ip    ipKey
+	ports []uint16
+}
+
+// SYN探测包携带的TCP选项
+var synOptions = []layers.TCPOption{
+	{
+		OptionType:   layers.TCPOptionKindMSS,
+		OptionLength: 4,
+		OptionData:   []byte{0x05, 0x50}, // 1360
+	},
+	{
+		OptionType: layers.TCPOptionKindNop,
+	},
+	{
+		OptionType:   layers.TCPOptionKindWindowScale,
+		OptionLength: 3,
+		OptionData:   []byte{0x08},
+	},
+	{
+		OptionType: layers.TCPOptionKindNop,
+	},
+	{
+		OptionType: layers.TCPOptionKindNop,
+	},
+	{
+		OptionType:   layers.TCPOptionKindSACKPermitted,
+		OptionLength: 2,
+	},
 }
 
 // NewSynScanner firstIp: Used to select routes; openPortChan: Result return channel
@@ -63,28 +111,6 @@ func NewSynScanner(firstIp net.IP, retChan chan port.OpenIpPort, option port.Sca
 		return
 	}
 
-	var devName string
-	var srcIp, srcIp6 net.IP
-	var srcMac net.HardwareAddr
-	var gw net.IP
-
-	// specify dev
-	if option.NextHop != "" {
-		gw = net.ParseIP(option.NextHop)
-		srcIp, srcIp6, srcMac, devName, err = GetMacByGw(gw)
-	} else {
-		// get router info
-		srcIp, srcIp6, srcMac, gw, devName, err = GetRouter(firstIp)
-	}
-	if err != nil {
-		return
-	}
-
-	if devName == "" {
-		err = errors.New("get router info fail: no dev name")
-		return
-	}
-
 	rand.Seed(time.Now().Unix())
 
 	ss = &SynScanner{
@@ -92,10 +118,10 @@ func NewSynScanner(firstIp net.IP, retChan chan port.OpenIpPort, option port.Sca
 			FixLengths:       true,
 			ComputeChecksums: true,
 		},
-		srcIp:   srcIp,
-		srcIp6:  srcIp6,
-		srcMac:  srcMac,
-		devName: devName,
+		localNets:  getLocalNets(),
+		ifaces:     make(map[string]*netIface),
+		routes:     make(map[string]*route),
+		routeCache: make(map[routeKey]*route),
 		bufPool: &sync.Pool{
 			New: func() interface{} {
 				return gopacket.NewSerializeBuffer()
@@ -105,35 +131,37 @@ func NewSynScanner(firstIp net.IP, retChan chan port.OpenIpPort, option port.Sca
 		openPortChan:   make(chan port.OpenIpPort, cap(retChan)),
 		retChan:        retChan,
 		limiter:        limiter.NewLimiter(limiter.Every(time.Second/time.Duration(option.Rate)), option.Rate/10),
-		ctx:            context.Background(),
-		watchIpStatusT: newWatchIpStatusTable(time.Duration(option.Timeout)),
+		retryChan:      make(chan retryProbe, 1000),
 		watchMacCacheT: newWatchMacCacheTable(),
+		macWait:        make(map[string][]uint16),
+		cookie:         newSynCookie(),
 	}
+	ss.ctx, ss.cancel = context.WithCancel(context.Background())
+	ss.lastIpOption.Store(&port.IpOption{})
+	ss.watchIpStatusT = newWatchIpStatusTable(time.Duration(option.Timeout), option.Retries, ss.ipStatusRetry, ss.ipStatusTimeout)
 	go ss.portProbeHandle()
+	go ss.retryHandle()
 
-	// Pcap
-	// 每个包最大读取长度1024, 不开启混杂模式, no TimeOut
-	handle, err := pcap.OpenLive(devName, 1024, false, pcap.BlockForever)
-	if err != nil {
-		return
-	}
-	// Set filter, Reduce the number of monitoring packets
-	handle.SetBPFFilter(fmt.Sprintf("ether dst %s && (arp || tcp[tcpflags] == tcp-syn|tcp-ack || ((ip6[6] = 6) && (ip6[53] & 0x03 != 0)))", srcMac.String()))
-	ss.handle = handle
-
-	// start listen recv
-	go ss.recv()
-
-	if gw != nil {
-		// get gateway mac addr
-		var dstMac net.HardwareAddr
-		dstMac, err = ss.getHwAddr(gw)
-		if err != nil {
-			return
+	// specify dev
+	if option.NextHop != "" {
+		ss.nextHop = net.ParseIP(option.NextHop)
+		if ss.nextHop.To4() != nil {
+			ss.nextHop = ss.nextHop.To4()
+		}
+	} else if r, e := netroute.New(); e == nil {
+		ss.router = r
+		if prefixes, e := getRoutePrefixes(); e == nil {
+			ss.routePrefixes = append([]routeKey{}, prefixes...)
 		}
-		ss.gwMac = dstMac
 	}
 
+	// 第一个目标选路, 其它目标在发包时按网段选路; 失败时停止已启动的协程
+	r, err := ss.getRoute(firstIp)
+	if err != nil {
+		ss.release()
+		return nil, err
+	}
+	ss.devName = r.ifc.devName
 	return
 }
 
@@ -146,29 +174,68 @@ func (ss *SynScanner) Scan(dstIp net.IP, dst uint16, ipOption port.IpOption) (er
 	ss.changeLimiter()
 
 	// watchIp, first
-	ipStr := dstIp.String()
-	ss.watchIpStatusT.CreateOrUpdateLastTime(ipStr, ipOption)
+	key := newIpKey(dstIp)
+	if ss.watchIpStatusT.CreateOrUpdateLastTime(key, ipOption) {
+		// 新的IP且选项变化时才更新, 不在每个探测包分配
+		if last := ss.lastIpOption.Load().(*port.IpOption); !sameIpOption(*last, ipOption) {
+			_ipOption := ipOption
+			_ipOption.Hosts = nil // 域名属于这个ip, 不用于其它ip的响应
+			ss.lastIpOption.Store(&_ipOption)
+		}
+	}
+	if ss.option.AllState || ss.option.Retries > 0 || ss.isReportState(ss.noReplyState()) {
+		ss.watchIpStatusT.RecordSentPort(key, dst)
+	}
+
+	return ss.sendProbe(dstIp, dst)
+}
+
+// sameIpOption 除域名外的选项是否相同, 有扩展属性时视为不同
+func sameIpOption(a, b port.IpOption) bool {
+	return a.FingerPrint == b.FingerPrint && a.Httpx == b.Httpx && a.Protocol == b.Protocol && a.Ext == nil && b.Ext == nil
+}
+
+// sendProbe 根据扫描类型构造并发送探测包
+func (ss *SynScanner) sendProbe(dstIp net.IP, dst uint16) (err error) {
+	r, err := ss.getRoute(dstIp)
+	if err != nil {
+		return
+	}
 
 	// First off, get the MAC address we should be sending packets to.
-	var dstMac net.HardwareAddr
-	if ss.gwMac != nil {
-		dstMac = ss.gwMac
-	} else {
+	dstMac := r.gwMac
+	if dstMac == nil {
 		// 内网IP
-		mac := ss.watchMacCacheT.GetMac(ipStr)
-		if mac != nil {
-			dstMac = mac
-		} else {
-			dstMac, err = ss.getHwAddr(dstIp)
-			if err != nil {
-				return
-			}
+		dstMac = ss.watchMacCacheT.GetMac(dstIp.String())
+		if dstMac == nil {
+			ss.waitHwAddr(r.ifc, dstIp, dst)
+			return
+		}
+	}
+	atomic.AddInt64(&ss.statSent, 1)
+
+	srcPort, seq := ss.cookie.Get(dstIp, dst) // Source port and seq used to verify the reply
+
+	// 使用预构建的模板
+	if tmpl := r.tmpl; tmpl != nil {
+		bp, _ := ss.pktPool.Get().(*[]byte)
+		if bp == nil {
+			b := make([]byte, 0, 128)
+			bp = &b
 		}
+		var ack uint32
+		if ss.option.ScanType == port.ScanTypeAck || ss.option.ScanType == port.ScanTypeWindow {
+			ack = seq // 同probeTcp
+		}
+		*bp = tmpl.build(*bp, dstMac, dstIp, srcPort, dst, seq, ack)
+		err = r.ifc.handle.WritePacketData(*bp)
+		ss.pktPool.Put(bp)
+		return
 	}
 
 	// Construct all the network layers we need.
 	eth := layers.Ethernet{
-		SrcMAC:       ss.srcMac,
+		SrcMAC:       r.ifc.srcMac,
 		DstMAC:       dstMac,
 		EthernetType: layers.EthernetTypeIPv4,
 	}
@@ -176,7 +243,7 @@ func (ss *SynScanner) Scan(dstIp net.IP, dst uint16, ipOption port.IpOption) (er
 	var ip6 *layers.IPv6
 	if dstIp.To4() != nil {
 		ip4 = &layers.IPv4{
-			SrcIP:    ss.srcIp,
+			SrcIP:    r.srcIp,
 			DstIP:    dstIp,
 			Version:  4,
 			TTL:      128,
@@ -190,58 +257,67 @@ func (ss *SynScanner) Scan(dstIp net.IP, dst uint16, ipOption port.IpOption) (er
 			Version:    6,
 			NextHeader: layers.IPProtocolTCP,
 			HopLimit:   64,
-			SrcIP:      ss.srcIp6,
+			SrcIP:      r.srcIp,
 			DstIP:      dstIp,
 		}
 	}
 
-	tcp := layers.TCP{
-		SrcPort: layers.TCPPort(49000 + rand.Intn(10000)), // Random source port and used to determine recv dst port range
-		DstPort: layers.TCPPort(dst),
-		SYN:     true,
-		Window:  65280,
-		Seq:     uint32(500000 + rand.Intn(10000)),
-		Options: []layers.TCPOption{
-			{
-				OptionType:   layers.TCPOptionKindMSS,
-				OptionLength: 4,
-				OptionData:   []byte{0x05, 0x50}, // 1360
-			},
-			{
-				OptionType: layers.TCPOptionKindNop,
-			},
-			{
-				OptionType:   layers.TCPOptionKindWindowScale,
-				OptionLength: 3,
-				OptionData:   []byte{0x08},
-			},
-			{
-				OptionType: layers.TCPOptionKindNop,
-			},
-			{
-				OptionType: layers.TCPOptionKindNop,
-			},
-			{
-				OptionType:   layers.TCPOptionKindSACKPermitted,
-				OptionLength: 2,
-			},
-		},
+	if ss.option.ScanType == port.ScanTypeSctpInit {
+		sctp := gopacket.Payload(sctpPacket(srcPort, dst, 0, sctpInitChunk(seq)))
+		if ip4 != nil {
+			ip4.Protocol = layers.IPProtocolSCTP
+			return ss.send(r.ifc, &eth, ip4, sctp)
+		}
+		ip6.NextHeader = layers.IPProtocolSCTP
+		return ss.send(r.ifc, &eth, ip6, sctp)
 	}
+
 	// Send one packet per loop iteration until we've sent packets
+	tcp := ss.probeTcp(srcPort, dst, seq)
 	if ip4 != nil {
 		tcp.SetNetworkLayerForChecksum(ip4)
-		ss.send(&eth, ip4, &tcp)
+		ss.send(r.ifc, &eth, ip4, &tcp)
 	} else if ip6 != nil {
 		tcp.SetNetworkLayerForChecksum(ip6)
-		ss.send(&eth, ip6, &tcp)
+		ss.send(r.ifc, &eth, ip6, &tcp)
 	}
 	return
 }
 
+// probeTcp 根据扫描类型构造TCP探测包的TCP层
+func (ss *SynScanner) probeTcp(srcPort, dst uint16, seq uint32) layers.TCP {
+	tcp := layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dst),
+		Window:  65280,
+		Seq:     seq,
+	}
+	switch ss.option.ScanType {
+	case port.ScanTypeAck, port.ScanTypeWindow:
+		// RST响应的序列号为探测包的确认号
+		tcp.ACK = true
+		tcp.Ack = seq
+		tcp.Window = 1024
+	case port.ScanTypeFin:
+		tcp.FIN = true
+	case port.ScanTypeNull:
+	case port.ScanTypeXmas:
+		tcp.FIN, tcp.PSH, tcp.URG = true, true, true
+	default:
+		tcp.SYN = true
+		tcp.Options = synOptions
+	}
+	return tcp
+}
+
 func (ss *SynScanner) Wait() {
-	// Delay 2s for a reply from the last packet
-	for i := 0; i < 20; i++ {
-		if ss.watchIpStatusT.IsEmpty() {
+	// Delay 2s for a reply from the last packet, and the time of retries
+	maxWait := 2*time.Second + time.Duration(ss.option.Retries)*(time.Duration(ss.option.Timeout)*time.Millisecond+time.Second)
+	for start := time.Now(); time.Since(start) < maxWait; {
+		ss.macWaitLock.Lock()
+		macWaitNum := len(ss.macWait)
+		ss.macWaitLock.Unlock()
+		if ss.watchIpStatusT.IsEmpty() && macWaitNum == 0 {
 			break
 		}
 		time.Sleep(time.Millisecond * 100)
@@ -254,40 +330,26 @@ func (ss *SynScanner) Wait() {
 	ss.portProbeWg.Wait()
 }
 
+// Pending 正在服务识别的端口
+func (ss *SynScanner) Pending() []port.OpenIpPort {
+	return ss.pending.List()
+}
+
 // Close cleans up the handle and chan.
 func (ss *SynScanner) Close() {
+	ss.release()
+	close(ss.retChan)
+}
+
+// release 停止后台协程并关闭网卡句柄, 不关闭调用者的retChan
+func (ss *SynScanner) release() {
 	ss.isDone = true
-	if ss.handle != nil {
-		// In linux, pcap can not stop when no packets to sniff with BlockForever
-		// ref:https://github.com/google/gopacket/issues/890
-		// ref:https://github.com/google/gopacket/issues/1089
-		if runtime.GOOS == "linux" {
-			eth := layers.Ethernet{
-				SrcMAC:       ss.srcMac,
-				DstMAC:       ss.srcMac,
-				EthernetType: layers.EthernetTypeARP,
-			}
-			arp := layers.ARP{
-				AddrType:          layers.LinkTypeEthernet,
-				Protocol:          layers.EthernetTypeIPv4,
-				HwAddressSize:     6,
-				ProtAddressSize:   4,
-				Operation:         layers.ARPReply,
-				SourceHwAddress:   []byte(ss.srcMac),
-				SourceProtAddress: []byte(ss.srcIp),
-				DstHwAddress:      []byte(ss.srcMac),
-				DstProtAddress:    []byte(ss.srcIp),
-			}
-			handle, _ := pcap.OpenLive(ss.devName, 1024, false, time.Second)
-			buf := ss.bufPool.Get().(gopacket.SerializeBuffer)
-			gopacket.SerializeLayers(buf, ss.opts, &eth, &arp)
-			handle.WritePacketData(buf.Bytes())
-			handle.Close()
-			buf.Clear()
-			ss.bufPool.Put(buf)
-		}
-		ss.handle.Close()
+	ss.cancel()
+	ss.routeLock.Lock()
+	for _, ifc := range ss.ifaces {
+		ifc.handle.Close()
 	}
+	ss.routeLock.Unlock()
 	if ss.watchMacCacheT != nil {
 		ss.watchMacCacheT.Close()
 	}
@@ -297,7 +359,6 @@ func (ss *SynScanner) Close() {
 	ss.watchMacCacheT = nil
 	ss.watchIpStatusT = nil
 	close(ss.openPortChan)
-	close(ss.retChan)
 }
 
 // WaitLimiter Waiting for the speed limit
@@ -305,7 +366,7 @@ func (ss *SynScanner) WaitLimiter() error {
 	return ss.limiter.Wait(ss.ctx)
 }
 
-// GetDevName Get the device name after the route selection
+// GetDevName Get the device name after the route selection of first ip
 func (ss *SynScanner) GetDevName() string {
 	return ss.devName
 }
@@ -319,10 +380,14 @@ func (ss *SynScanner) changeLimiter() {
 		return
 	}
 	// 每 2s 判断一次
-	if time.Since(ss.lastStatProbeTime) < 2*time.Second {
+	elapsed := time.Since(ss.lastStatProbeTime)
+	if elapsed < 2*time.Second {
 		return
 	}
 	ss.lastStatProbeTime = time.Now()
+	if ss.option.Debug {
+		fmt.Printf("[d] syn send:%.0f packets/s\n", float64(atomic.SwapInt64(&ss.statSent, 0))/elapsed.Seconds())
+	}
 
 	var setLimit = func(rate int) {
 		if rate <= 0 {
@@ -340,6 +405,17 @@ func (ss *SynScanner) changeLimiter() {
 		ss.limiter.SetLimit(limiter.Every(time.Second / time.Duration(rate)))
 	}
 
+	// 重发后才收到响应的比例超过10%, 说明存在丢包, 降速25%
+	recvNum := atomic.SwapInt64(&ss.statRecv, 0)
+	retryHit := atomic.SwapInt64(&ss.statRetryHit, 0)
+	if ss.option.Debug && ss.option.Retries > 0 {
+		fmt.Printf("[d] syn recv:%d, recv after retry:%d\n", recvNum, retryHit)
+	}
+	if recvNum >= 10 && retryHit*10 > recvNum {
+		setLimit(ss.lastRate * 3 / 4)
+		return
+	}
+
 	// 计算recv队列使用率（乘以10的整数）
 	ratio10 := (len(ss.openPortChan) * 10) / cap(ss.openPortChan)
 	// 当队列缓冲区到达80%时减少队列长度的50%，90%降为100/s
@@ -382,48 +458,281 @@ func (ss *SynScanner) changeLimiter() {
 	}
 }
 
+// ipStatusRetry 超时未响应的端口加入重发队列
+func (ss *SynScanner) ipStatusRetry(ip ipKey, ports []uint16) {
+	select {
+	case ss.retryChan <- retryProbe{ip: ip, ports: ports}:
+	case <-ss.ctx.Done():
+	}
+}
+
+// retryHandle 重发, 同样受速度限制
+func (ss *SynScanner) retryHandle() {
+	for {
+		select {
+		case <-ss.ctx.Done():
+			return
+		case rp := <-ss.retryChan:
+			ip := rp.ip.IP()
+			for _, _port := range rp.ports {
+				if ss.WaitLimiter() != nil {
+					return
+				}
+				ss.sendProbe(ip, _port)
+			}
+		}
+	}
+}
+
+// protocol 结果中的协议名, tcp为空
+func (ss *SynScanner) protocol() string {
+	if ss.option.ScanType == port.ScanTypeSctpInit {
+		return "sctp"
+	}
+	return ""
+}
+
+// noReplyState 探测包无响应时的端口状态
+func (ss *SynScanner) noReplyState() string {
+	switch ss.option.ScanType {
+	case port.ScanTypeFin, port.ScanTypeNull, port.ScanTypeXmas:
+		return port.StateOpenFiltered
+	}
+	return port.StateFiltered
+}
+
+// isReportState 默认只输出扫描类型的正向结果, AllState时输出所有状态
+func (ss *SynScanner) isReportState(state string) bool {
+	if ss.option.AllState || state == port.StateOpen {
+		return true
+	}
+	switch ss.option.ScanType {
+	case port.ScanTypeAck:
+		return state == port.StateUnfiltered
+	case port.ScanTypeFin, port.ScanTypeNull, port.ScanTypeXmas:
+		return state == port.StateOpenFiltered
+	}
+	return false
+}
+
+// tcpReplyState 根据扫描类型解析TCP响应对应的端口状态, 无关的响应返回空
+func (ss *SynScanner) tcpReplyState(tcp *layers.TCP) string {
+	switch ss.option.ScanType {
+	case port.ScanTypeAck:
+		if tcp.RST {
+			return port.StateUnfiltered
+		}
+	case port.ScanTypeWindow:
+		if tcp.RST {
+			// 部分系统对open端口的RST响应窗口非0
+			if tcp.Window > 0 {
+				return port.StateOpen
+			}
+			return port.StateClosed
+		}
+	case port.ScanTypeFin, port.ScanTypeNull, port.ScanTypeXmas:
+		if tcp.RST {
+			return port.StateClosed
+		}
+	case port.ScanTypeSctpInit:
+	default:
+		if tcp.RST {
+			return port.StateClosed
+		} else if tcp.SYN && tcp.ACK {
+			return port.StateOpen
+		}
+	}
+	return ""
+}
+
+// handleReply 记录IP端口的响应并输出对应状态, 重复的响应返回false
+func (ss *SynScanner) handleReply(ip net.IP, _port uint16, state string) bool {
+	key := newIpKey(ip)
+	ipOption, has := ss.watchIpStatusT.GetIpOption(key)
+	if !has { // IP监视已过期, 最近一次的IpOption不含域名
+		ipOption = *ss.lastIpOption.Load().(*port.IpOption)
+	} else {
+		if ss.watchIpStatusT.HasPort(key, _port) { // PORT
+			return false
+		} else {
+			ss.watchIpStatusT.RecordPort(key, _port) // record
+		}
+		if ss.watchIpStatusT.SentTimes(key, _port) > 1 {
+			atomic.AddInt64(&ss.statRetryHit, 1)
+		}
+	}
+	atomic.AddInt64(&ss.statRecv, 1)
+
+	if ss.isReportState(state) {
+		ss.openPortChan <- port.OpenIpPort{
+			Ip:       ip,
+			Port:     _port,
+			Protocol: ss.protocol(),
+			State:    state,
+			IpOption: ipOption,
+		}
+	}
+	return true
+}
+
+// naTargetMac 取NA报文中的目标链路层地址选项, 没有该选项时使用以太网源MAC
+func naTargetMac(na *layers.ICMPv6NeighborAdvertisement, ethSrc net.HardwareAddr) net.HardwareAddr {
+	for _, opt := range na.Options {
+		if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) >= 6 {
+			return net.HardwareAddr(opt.Data[:6])
+		}
+	}
+	return ethSrc
+}
+
+// parseIcmpQuote 解析ICMP不可达报文中引用的原始探测包, 返回其目的IP、传输层协议和传输层数据(至少8字节)
+func parseIcmpQuote(data []byte) (dstIp net.IP, proto layers.IPProtocol, transport []byte, ok bool) {
+	if len(data) == 0 {
+		return
+	}
+	switch data[0] >> 4 {
+	case 4:
+		ihl := int(data[0]&0x0f) * 4
+		if ihl < 20 || len(data) < ihl+8 {
+			return
+		}
+		dstIp = append(net.IP{}, data[16:20]...)
+		proto = layers.IPProtocol(data[9])
+		transport = data[ihl:]
+	case 6:
+		if len(data) < 48 {
+			return
+		}
+		dstIp = append(net.IP{}, data[24:40]...)
+		proto = layers.IPProtocol(data[6])
+		transport = data[40:]
+	default:
+		return
+	}
+	return dstIp, proto, transport, true
+}
+
+// matchIcmpQuote 校验ICMP引用的原始探测包是否为本扫描器发送, 返回其目的端口
+func (ss *SynScanner) matchIcmpQuote(dstIp net.IP, proto layers.IPProtocol, transport []byte) (dstPort uint16, ok bool) {
+	srcPort := binary.BigEndian.Uint16(transport[0:2])
+	dstPort = binary.BigEndian.Uint16(transport[2:4])
+	var seq uint32
+	if ss.option.ScanType == port.ScanTypeSctpInit {
+		// INIT包公共头的Verification Tag为0, 校验INIT块中的Initiate Tag
+		if proto != layers.IPProtocolSCTP || len(transport) < 20 {
+			return
+		}
+		seq = binary.BigEndian.Uint32(transport[16:20])
+	} else {
+		if proto != layers.IPProtocolTCP {
+			return
+		}
+		seq = binary.BigEndian.Uint32(transport[4:8])
+	}
+	return dstPort, ss.cookie.Match(dstIp, dstPort, srcPort, seq)
+}
+
+// ipStatusTimeout IP监视过期, 已发送但无响应的端口为filtered(FIN/NULL/Xmas扫描为open|filtered)
+func (ss *SynScanner) ipStatusTimeout(key ipKey, wi *watchIpStatus) {
+	if ss.isDone || len(wi.SentPort) == 0 {
+		return
+	}
+	state := ss.noReplyState()
+	if !ss.isReportState(state) {
+		return
+	}
+	ip := key.IP()
+	for _port := range wi.SentPort {
+		if _, ok := wi.ReceivedPort[_port]; ok {
+			continue
+		}
+		ss.openPortChan <- port.OpenIpPort{
+			Ip:       ip,
+			Port:     _port,
+			Protocol: ss.protocol(),
+			State:    state,
+			IpOption: wi.IpOption,
+		}
+	}
+}
+
 func (ss *SynScanner) portProbeHandle() {
 	for openIpPort := range ss.openPortChan {
-		ss.portProbeWg.Add(1)
-		if !openIpPort.FingerPrint && !openIpPort.Httpx {
-			ss.retChan <- openIpPort
-			ss.portProbeWg.Done()
-		} else {
-			go func(_openIpPort port.OpenIpPort) {
-				if _openIpPort.Port != 0 {
-					if _openIpPort.FingerPrint {
-						ss.WaitLimiter()
-						_openIpPort.Service, _openIpPort.Banner, _ = fingerprint.PortIdentify("tcp", _openIpPort.Ip, _openIpPort.Port, time.Duration(ss.option.Timeout)*time.Millisecond)
-					}
-					if _openIpPort.Httpx && (_openIpPort.Service == "" || _openIpPort.Service == "http" || _openIpPort.Service == "https") {
-						ss.WaitLimiter()
-						_openIpPort.HttpInfo, _openIpPort.Banner, _ = fingerprint.ProbeHttpInfo(_openIpPort.Ip.String(), _openIpPort.Port, _openIpPort.Service, time.Duration(ss.option.Timeout)*time.Millisecond)
-						if _openIpPort.HttpInfo != nil {
-							if strings.HasPrefix(_openIpPort.HttpInfo.Url, "https") {
-								_openIpPort.Service = "https"
-							} else {
-								_openIpPort.Service = "http"
-							}
+		// ip有多个域名时按域名分别探测和输出
+		for _, op := range openIpPort.SplitHosts() {
+			ss.portProbe(op)
+		}
+	}
+}
+
+// portProbe 对开放端口进行服务识别和Http探测后输出
+func (ss *SynScanner) portProbe(openIpPort port.OpenIpPort) {
+	ss.portProbeWg.Add(1)
+	if (!openIpPort.FingerPrint && !openIpPort.Httpx) || !openIpPort.IsOpen() || openIpPort.Protocol == "sctp" {
+		ss.retChan <- openIpPort
+		ss.portProbeWg.Done()
+	} else {
+		id := ss.pending.Add(openIpPort.Ip, openIpPort.Port, openIpPort.Protocol, openIpPort.Host)
+		go func(_openIpPort port.OpenIpPort) {
+			defer ss.pending.Done(id)
+			if _openIpPort.Port != 0 {
+				if _openIpPort.FingerPrint {
+					ss.WaitLimiter()
+					_openIpPort.Service, _openIpPort.Banner, _ = fingerprint.PortIdentifyHost("tcp", _openIpPort.Ip, _openIpPort.Host, _openIpPort.Port, time.Duration(ss.option.Timeout)*time.Millisecond)
+				}
+				if _openIpPort.Httpx && (_openIpPort.Service == "" || _openIpPort.Service == "http" || _openIpPort.Service == "https") {
+					ss.WaitLimiter()
+					_openIpPort.HttpInfo, _openIpPort.Banner, _ = fingerprint.ProbeHostHttpInfo(_openIpPort.Ip, _openIpPort.Host, _openIpPort.Port, _openIpPort.Service, time.Duration(ss.option.Timeout)*time.Millisecond)
+					if _openIpPort.HttpInfo != nil {
+						if strings.HasPrefix(_openIpPort.HttpInfo.Url, "https") {
+							_openIpPort.Service = "https"
+						} else {
+							_openIpPort.Service = "http"
 						}
 					}
 				}
-				ss.retChan <- _openIpPort
-				ss.portProbeWg.Done()
-			}(openIpPort)
-		}
+			}
+			ss.retChan <- _openIpPort
+			ss.portProbeWg.Done()
+		}(openIpPort)
 	}
 }
 
-func (ss *SynScanner) getHwAddr(arpDst net.IP) (mac net.HardwareAddr, err error) {
+// waitHwAddr 内网IP的MAC未知时暂存探测包, 异步解析MAC后发送, 避免不存活的IP阻塞发包
+func (ss *SynScanner) waitHwAddr(ifc *netIface, dstIp net.IP, dst uint16) {
+	ipStr := dstIp.String()
+	ss.macWaitLock.Lock()
+	ports, resolving := ss.macWait[ipStr]
+	ss.macWait[ipStr] = append(ports, dst)
+	ss.macWaitLock.Unlock()
+	if resolving {
+		return
+	}
+	go func() {
+		_, err := ss.getHwAddr(ifc, dstIp)
+		ss.macWaitLock.Lock()
+		ports := ss.macWait[ipStr]
+		delete(ss.macWait, ipStr)
+		ss.macWaitLock.Unlock()
+		if err != nil {
+			return
+		}
+		for _, _port := range ports {
+			ss.sendProbe(dstIp, _port)
+		}
+	}()
+}
+
+func (ss *SynScanner) getHwAddr(ifc *netIface, arpDst net.IP) (mac net.HardwareAddr, err error) {
 	if arpDst.To4() != nil {
-		return ss.getHwAddrV4(arpDst)
+		return ss.getHwAddrV4(ifc, arpDst)
 	} else {
-		return ss.getHwAddrV6(arpDst)
+		return ss.getHwAddrV6(ifc, arpDst)
 	}
 }
 
 // getHwAddrV4 get the destination hardware address for our packets.
-func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err error) {
+func (ss *SynScanner) getHwAddrV4(ifc *netIface, arpDst net.IP) (mac net.HardwareAddr, err error) {
 	ipStr := arpDst.String()
 	if ss.watchMacCacheT.IsNeedWatch(ipStr) {
 		return nil, errors.New("arp of this ip has been in monitoring")
@@ -432,7 +741,7 @@ func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err erro
 
 	// Prepare the layers to send for an ARP request.
 	eth := layers.Ethernet{
-		SrcMAC:       ss.srcMac,
+		SrcMAC:       ifc.srcMac,
 		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
 		EthernetType: layers.EthernetTypeARP,
 	}
@@ -442,13 +751,13 @@ func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err erro
 		HwAddressSize:     6,
 		ProtAddressSize:   4,
 		Operation:         layers.ARPRequest,
-		SourceHwAddress:   []byte(ss.srcMac),
-		SourceProtAddress: []byte(ss.srcIp),
+		SourceHwAddress:   []byte(ifc.srcMac),
+		SourceProtAddress: []byte(ifc.srcIp),
 		DstHwAddress:      []byte{0, 0, 0, 0, 0, 0},
 		DstProtAddress:    []byte(arpDst),
 	}
 
-	if err = ss.sendArp(&eth, &arp); err != nil {
+	if err = ss.sendArp(ifc, &eth, &arp); err != nil {
 		return nil, err
 	}
 
@@ -466,7 +775,7 @@ func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err erro
 		}
 		retry += 1
 		if retry%25 == 0 {
-			if err = ss.send(&eth, &arp); err != nil {
+			if err = ss.send(ifc, &eth, &arp); err != nil {
 				return nil, err
 			}
 		}
@@ -486,7 +795,7 @@ func (ss *SynScanner) convertIPv6ToMac(ipv6 net.IP) (net.HardwareAddr, error) {
 
 	// Extract the interface identifier from the last 8 bytes of the IPv6 address
 	interfaceIdentifier := ipv6[8:16]
-	if (interfaceIdentifier[0] & 0x02) != 0x02 {
+	if (interfaceIdentifier[0]&0x02) != 0x02 || interfaceIdentifier[3] != 0xff || interfaceIdentifier[4] != 0xfe {
 		return nil, errors.New("no SLAAC adder")
 	}
 
@@ -500,12 +809,15 @@ func (ss *SynScanner) convertIPv6ToMac(ipv6 net.IP) (net.HardwareAddr, error) {
 	return mac, nil
 }
 
-// getHwAddrV6 get the destination hardware address for our packets.
-func (ss *SynScanner) getHwAddrV6(arpDst net.IP) (mac net.HardwareAddr, err error) {
+// getHwAddrV6 get the destination hardware address for our packets, by ICMPv6 Neighbor Solicitation.
+func (ss *SynScanner) getHwAddrV6(ifc *netIface, arpDst net.IP) (mac net.HardwareAddr, err error) {
 	mac, err = ss.convertIPv6ToMac(arpDst)
 	if mac != nil {
 		return
 	}
+	if ifc.srcIp6 == nil {
+		return nil, errors.New("no ipv6 addr on dev " + ifc.devName)
+	}
 
 	ipStr := arpDst.String()
 	if ss.watchMacCacheT.IsNeedWatch(ipStr) {
@@ -513,17 +825,18 @@ func (ss *SynScanner) getHwAddrV6(arpDst net.IP) (mac net.HardwareAddr, err erro
 	}
 	ss.watchMacCacheT.UpdateLastTime(ipStr) // New one ip watch
 
+	// 发往目标的请求节点组播地址 ff02::1:ffXX:XXXX
 	eth := layers.Ethernet{
-		SrcMAC:       ss.srcMac,
-		DstMAC:       []byte{51, 51, 255, arpDst[13], arpDst[14], arpDst[15]},
+		SrcMAC:       ifc.srcMac,
+		DstMAC:       net.HardwareAddr{0x33, 0x33, 0xff, arpDst[13], arpDst[14], arpDst[15]},
 		EthernetType: layers.EthernetTypeIPv6,
 	}
 	ipv6 := layers.IPv6{
 		Version:    6,
 		NextHeader: layers.IPProtocolICMPv6,
-		HopLimit:   64,
-		SrcIP:      ss.srcIp,
-		DstIP:      arpDst,
+		HopLimit:   255, // NDP要求
+		SrcIP:      ifc.srcIp6,
+		DstIP:      net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0xff, arpDst[13], arpDst[14], arpDst[15]},
 	}
 	icmpv6 := layers.ICMPv6{
 		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0),
@@ -533,14 +846,18 @@ func (ss *SynScanner) getHwAddrV6(arpDst net.IP) (mac net.HardwareAddr, err erro
 		Options: []layers.ICMPv6Option{
 			{
 				Type: layers.ICMPv6OptSourceAddress,
-				Data: ss.srcMac,
+				Data: ifc.srcMac,
 			},
 		},
 	}
 
 	icmpv6.SetNetworkLayerForChecksum(&ipv6)
 
-	//start := time.Now()
+	if err = ss.send(ifc, &eth, &ipv6, &icmpv6, &icmpv6Payload); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
 	var retry int
 
 	for {
@@ -548,13 +865,13 @@ func (ss *SynScanner) getHwAddrV6(arpDst net.IP) (mac net.HardwareAddr, err erro
 		if mac != nil {
 			return mac, nil
 		}
-		// Wait 600 ms for an ARP reply.
-		//if time.Since(start) > time.Millisecond*600 {
-		//	return nil, errors.New("timeout getting ICMP V6 NA reply")
-		//}
+		// Wait 600 ms for an NA reply.
+		if time.Since(start) > time.Millisecond*600 {
+			return nil, errors.New("timeout getting ICMPv6 NA reply")
+		}
 		retry += 1
 		if retry%25 == 0 {
-			if err = ss.send(&eth, &ipv6, &icmpv6, &icmpv6Payload); err != nil {
+			if err = ss.send(ifc, &eth, &ipv6, &icmpv6, &icmpv6Payload); err != nil {
 				return nil, err
 			}
 		}
@@ -564,7 +881,7 @@ func (ss *SynScanner) getHwAddrV6(arpDst net.IP) (mac net.HardwareAddr, err erro
 }
 
 // send sends the given layers as a single packet on the network.
-func (ss *SynScanner) send(l ...gopacket.SerializableLayer) error {
+func (ss *SynScanner) send(ifc *netIface, l ...gopacket.SerializableLayer) error {
 	buf := ss.bufPool.Get().(gopacket.SerializeBuffer)
 	defer func() {
 		buf.Clear()
@@ -573,11 +890,11 @@ func (ss *SynScanner) send(l ...gopacket.SerializableLayer) error {
 	if err := gopacket.SerializeLayers(buf, ss.opts, l...); err != nil {
 		return err
 	}
-	return ss.handle.WritePacketData(buf.Bytes())
+	return ifc.handle.WritePacketData(buf.Bytes())
 }
 
 // send sends the given layers as a single packet on the network., need fix padding
-func (ss *SynScanner) sendArp(l ...gopacket.SerializableLayer) error {
+func (ss *SynScanner) sendArp(ifc *netIface, l ...gopacket.SerializableLayer) error {
 	buf := ss.bufPool.Get().(gopacket.SerializeBuffer)
 	defer func() {
 		buf.Clear()
@@ -586,25 +903,25 @@ func (ss *SynScanner) sendArp(l ...gopacket.SerializableLayer) error {
 	if err := gopacket.SerializeLayers(buf, ss.opts, l...); err != nil {
 		return err
 	}
-	return ss.handle.WritePacketData(buf.Bytes()[:42]) // need fix padding
+	return ifc.handle.WritePacketData(buf.Bytes()[:42]) // need fix padding
 }
 
-// recv packet on the network.
-func (ss *SynScanner) recv() {
+// recv packet on the network of ifc.
+func (ss *SynScanner) recv(ifc *netIface) {
 	eth := layers.Ethernet{
-		SrcMAC:       ss.srcMac,
+		SrcMAC:       ifc.srcMac,
 		DstMAC:       nil,
 		EthernetType: layers.EthernetTypeIPv4,
 	}
 	ip4 := layers.IPv4{
-		SrcIP:    ss.srcIp,
+		SrcIP:    ifc.srcIp,
 		DstIP:    []byte{},
 		Version:  4,
 		TTL:      64,
 		Protocol: layers.IPProtocolTCP,
 	}
 	ip6 := layers.IPv6{
-		SrcIP:      ss.srcIp,
+		SrcIP:      ifc.srcIp6,
 		DstIP:      []byte{},
 		Version:    6,
 		HopLimit:   64,
@@ -622,7 +939,10 @@ func (ss *SynScanner) recv() {
 	var ipLayer layers.IPv4
 	var ipv6Layer layers.IPv6
 	var ipv6IcmpNALayer layers.ICMPv6NeighborAdvertisement
+	var icmpLayer layers.ICMPv4
+	var icmp6Layer layers.ICMPv6
 	var tcpLayer layers.TCP
+	var sctpLayer layers.SCTP
 	var arpLayer layers.ARP
 	var ethLayer layers.Ethernet
 	var foundLayerTypes []gopacket.LayerType
@@ -634,7 +954,10 @@ func (ss *SynScanner) recv() {
 		&ipLayer,
 		&ipv6Layer,
 		&tcpLayer,
+		&sctpLayer,
 		&arpLayer,
+		&icmpLayer,
+		&icmp6Layer,
 		&ipv6IcmpNALayer,
 	)
 
@@ -644,10 +967,11 @@ func (ss *SynScanner) recv() {
 	var ipStr string
 	var _port uint16
 	var disIp net.IP
+	var icmpQuote []byte
 
 	for {
 		// Read in the next packet.
-		data, _, err = ss.handle.ReadPacketData()
+		data, err = ifc.handle.ReadPacketData()
 		if err != nil {
 			if err == io.EOF {
 				return
@@ -676,62 +1000,116 @@ func (ss *SynScanner) recv() {
 			continue
 		}
 
-		// ipv6NA
-		if len(ipv6IcmpNALayer.Options) != 0 {
-			ipStr = net.IP(arpLayer.SourceProtAddress).String()
+		// ipv6 NA
+		if ipv6IcmpNALayer.TargetAddress != nil {
+			ipStr = ipv6IcmpNALayer.TargetAddress.String()
 			if ss.watchMacCacheT.IsNeedWatch(ipStr) {
-				ss.watchMacCacheT.SetMac(ipStr, arpLayer.SourceHwAddress)
+				ss.watchMacCacheT.SetMac(ipStr, naTargetMac(&ipv6IcmpNALayer, ethLayer.SrcMAC))
+			}
+			ipv6IcmpNALayer.TargetAddress = nil // clean NA parse status
+			continue
+		}
+
+		// icmp unreachable, 探测包被过滤
+		icmpQuote = nil
+		for _, layerType := range foundLayerTypes {
+			switch layerType {
+			case layers.LayerTypeICMPv4:
+				if icmpLayer.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable {
+					switch icmpLayer.TypeCode.Code() {
+					case layers.ICMPv4CodeHost, layers.ICMPv4CodeProtocol, layers.ICMPv4CodePort,
+						layers.ICMPv4CodeNetAdminProhibited, layers.ICMPv4CodeHostAdminProhibited, layers.ICMPv4CodeCommAdminProhibited:
+						icmpQuote = icmpLayer.Payload
+					}
+				}
+			case layers.LayerTypeICMPv6:
+				if icmp6Layer.TypeCode.Type() == layers.ICMPv6TypeDestinationUnreachable && len(icmp6Layer.Payload) > 4 {
+					icmpQuote = icmp6Layer.Payload[4:] // 4 bytes unused
+				}
+			}
+		}
+		if icmpQuote != nil {
+			if dstIp, proto, transport, ok := parseIcmpQuote(icmpQuote); ok {
+				if dstPort, ok := ss.matchIcmpQuote(dstIp, proto, transport); ok {
+					ss.handleReply(dstIp, dstPort, port.StateFiltered)
+				}
 			}
-			ipv6IcmpNALayer.Options = []layers.ICMPv6Option{} // clean arp parse status
 			continue
 		}
 
 		if ethLayer.EthernetType == layers.EthernetTypeIPv6 {
 			disIp = ipv6Layer.SrcIP
-			ip6.DstIP = disIp
+			ip6.SrcIP, ip6.DstIP = ipv6Layer.DstIP, disIp
 			eth.EthernetType = layers.EthernetTypeIPv6
 		} else {
 			disIp = ipLayer.SrcIP
-			ip4.DstIP = disIp
+			ip4.SrcIP, ip4.DstIP = ipLayer.DstIP, disIp
+			eth.EthernetType = layers.EthernetTypeIPv4
 		}
 
 		// tcp Match ip and port
-		if tcpLayer.DstPort != 0 && tcpLayer.DstPort >= 49000 && tcpLayer.DstPort <= 59000 {
-			ipStr = disIp.String()
+		if tcpLayer.DstPort >= srcPortMin && tcpLayer.DstPort < srcPortMin+srcPortRange {
+			dstPort := tcpLayer.DstPort
+			tcpLayer.DstPort = 0 // clean tcp parse status
 			_port = uint16(tcpLayer.SrcPort)
-			ipOption, has := ss.watchIpStatusT.GetIpOption(ipStr)
-			if !has { // IP
+			if !ss.cookie.Verify(disIp, _port, uint16(dstPort), tcpLayer.Seq, tcpLayer.Ack, tcpLayer.ACK) { // 非本扫描器的响应
+				continue
+			}
+			state := ss.tcpReplyState(&tcpLayer)
+			if state == "" {
+				continue
+			}
+			if !ss.handleReply(disIp, _port, state) {
 				continue
-			} else {
-				if ss.watchIpStatusT.HasPort(ipStr, _port) { // PORT
-					continue
-				} else {
-					ss.watchIpStatusT.RecordPort(ipStr, _port) // record
-				}
 			}
 
 			if tcpLayer.SYN && tcpLayer.ACK {
-				ss.openPortChan <- port.OpenIpPort{
-					Ip:       disIp,
-					Port:     _port,
-					IpOption: ipOption,
-				}
 				// reply to target
 				eth.DstMAC = ethLayer.SrcMAC
 				tcp.DstPort = tcpLayer.SrcPort
-				tcp.SrcPort = tcpLayer.DstPort
+				tcp.SrcPort = dstPort
 				// RST && ACK
 				tcp.Ack = tcpLayer.Seq + 1
 				tcp.Seq = tcpLayer.Ack
 				if ethLayer.EthernetType == layers.EthernetTypeIPv6 {
 					tcp.SetNetworkLayerForChecksum(&ip6)
-					ss.send(&eth, &ip6, &tcp)
+					ss.send(ifc, &eth, &ip6, &tcp)
 				} else {
 					tcp.SetNetworkLayerForChecksum(&ip4)
-					ss.send(&eth, &ip4, &tcp)
+					ss.send(ifc, &eth, &ip4, &tcp)
 				}
 			}
-			tcpLayer.DstPort = 0 // clean tcp parse status
+		}
+
+		// sctp Match ip and port
+		if sctpLayer.DstPort >= srcPortMin && sctpLayer.DstPort < srcPortMin+srcPortRange {
+			dstPort := sctpLayer.DstPort
+			sctpLayer.DstPort = 0 // clean sctp parse status
+			_port = uint16(sctpLayer.SrcPort)
+			// 响应包的Verification Tag为INIT块中的Initiate Tag
+			if len(sctpLayer.Payload) < 4 || !ss.cookie.Match(disIp, _port, uint16(dstPort), sctpLayer.VerificationTag) {
+				continue
+			}
+			switch layers.SCTPChunkType(sctpLayer.Payload[0]) {
+			case layers.SCTPChunkTypeInitAck:
+				if len(sctpLayer.Payload) < 8 || !ss.handleReply(disIp, _port, port.StateOpen) {
+					continue
+				}
+				// ABORT, 使用对端的Initiate Tag
+				eth.DstMAC = ethLayer.SrcMAC
+				abort := gopacket.Payload(sctpPacket(uint16(dstPort), _port, binary.BigEndian.Uint32(sctpLayer.Payload[4:8]), sctpAbortChunk))
+				if ethLayer.EthernetType == layers.EthernetTypeIPv6 {
+					sctpIp6 := ip6
+					sctpIp6.NextHeader = layers.IPProtocolSCTP
+					ss.send(ifc, &eth, &sctpIp6, abort)
+				} else {
+					sctpIp4 := ip4
+					sctpIp4.Protocol = layers.IPProtocolSCTP
+					ss.send(ifc, &eth, &sctpIp4, abort)
+				}
+			case layers.SCTPChunkTypeAbort:
+				ss.handleReply(disIp, _port, port.StateClosed)
+			}
 		}
 	}
 }
@@ -1,10 +1,16 @@
+//go:build !nosyn
+
 package syn
 
 import (
+	"bytes"
 	"github.com/XinRoom/go-portScan/core/host"
 	"github.com/XinRoom/go-portScan/core/port"
 	"github.com/XinRoom/iprange"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/panjf2000/ants/v2"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -71,3 +77,199 @@ func TestSynScanner_Scan(t *testing.T) {
 	<-single
 	t.Log(time.Since(start))
 }
+
+func TestParseIcmpQuote(t *testing.T) {
+	dstIp := net.IPv4(1, 1, 1, 1).To4()
+	ip4 := layers.IPv4{
+		SrcIP:    net.IPv4(192, 168, 1, 2).To4(),
+		DstIP:    dstIp,
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+	}
+	tcp := layers.TCP{SrcPort: 50000, DstPort: 443, Seq: 12345, FIN: true}
+	tcp.SetNetworkLayerForChecksum(&ip4)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &ip4, &tcp); err != nil {
+		t.Fatal(err)
+	}
+	// icmp 只引用原始包的IP头和前8字节
+	ip, proto, transport, ok := parseIcmpQuote(buf.Bytes()[:28])
+	if !ok || !ip.Equal(dstIp) || proto != layers.IPProtocolTCP || len(transport) != 8 {
+		t.Fatal(ip, proto, transport, ok)
+	}
+	if _, _, _, ok = parseIcmpQuote(buf.Bytes()[:24]); ok {
+		t.Error("truncated quote accepted")
+	}
+
+	ss := &SynScanner{cookie: newSynCookie()}
+	srcPort, seq := ss.cookie.Get(dstIp, 443)
+	tcp.SrcPort, tcp.Seq = layers.TCPPort(srcPort), seq
+	buf.Clear()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &ip4, &tcp)
+	ip, proto, transport, _ = parseIcmpQuote(buf.Bytes()[:28])
+	if dstPort, ok := ss.matchIcmpQuote(ip, proto, transport); !ok || dstPort != 443 {
+		t.Error("quote of sent probe not matched")
+	}
+}
+
+func TestSynScanner_tcpReplyState(t *testing.T) {
+	cases := []struct {
+		scanType port.ScanType
+		tcp      layers.TCP
+		state    string
+	}{
+		{port.ScanTypeSyn, layers.TCP{SYN: true, ACK: true}, port.StateOpen},
+		{port.ScanTypeSyn, layers.TCP{RST: true, ACK: true}, port.StateClosed},
+		{port.ScanTypeAck, layers.TCP{RST: true}, port.StateUnfiltered},
+		{port.ScanTypeWindow, layers.TCP{RST: true, Window: 1024}, port.StateOpen},
+		{port.ScanTypeWindow, layers.TCP{RST: true}, port.StateClosed},
+		{port.ScanTypeFin, layers.TCP{RST: true, ACK: true}, port.StateClosed},
+		{port.ScanTypeXmas, layers.TCP{SYN: true, ACK: true}, ""},
+	}
+	for _, c := range cases {
+		ss := &SynScanner{option: port.ScannerOption{ScanType: c.scanType}}
+		if state := ss.tcpReplyState(&c.tcp); state != c.state {
+			t.Errorf("%s: got %q, want %q", c.scanType, state, c.state)
+		}
+	}
+
+	ss := &SynScanner{option: port.ScannerOption{ScanType: port.ScanTypeNull}}
+	if state := ss.noReplyState(); state != port.StateOpenFiltered || !ss.isReportState(state) || ss.isReportState(port.StateClosed) {
+		t.Error("null scan no reply state:", state)
+	}
+}
+
+func TestSynScanner_ipStatusTimeout(t *testing.T) {
+	wi := &watchIpStatus{
+		ReceivedPort: map[uint16]struct{}{80: {}},
+		SentPort:     map[uint16]sentProbe{80: {Times: 1}, 443: {Times: 2}},
+	}
+	// 默认不输出无响应的端口
+	ss := &SynScanner{openPortChan: make(chan port.OpenIpPort, 2)}
+	ss.ipStatusTimeout(newIpKey(net.ParseIP("10.0.0.1")), wi)
+	if len(ss.openPortChan) != 0 {
+		t.Errorf("no allState, got %d results", len(ss.openPortChan))
+	}
+	// AllState时已发送但无响应的端口为filtered, RST响应的端口已由tcpReplyState输出为closed
+	ss.option.AllState = true
+	ss.ipStatusTimeout(newIpKey(net.ParseIP("10.0.0.1")), wi)
+	if len(ss.openPortChan) != 1 {
+		t.Fatalf("allState, got %d results, want 1", len(ss.openPortChan))
+	}
+	if op := <-ss.openPortChan; op.Port != 443 || op.State != port.StateFiltered || op.Protocol != "" {
+		t.Errorf("got %+v, want 443 filtered", op)
+	}
+}
+
+// ndpHandle 对NS请求回复NA
+type ndpHandle struct {
+	mac  net.HardwareAddr
+	ns   gopacket.Packet
+	recv chan []byte
+}
+
+func (h *ndpHandle) ReadPacketData() ([]byte, error) {
+	data, ok := <-h.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return data, nil
+}
+
+func (h *ndpHandle) WritePacketData(data []byte) error {
+	pkt := gopacket.NewPacket(append([]byte{}, data...), layers.LayerTypeEthernet, gopacket.Default)
+	ns, ok := pkt.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+	if !ok {
+		return nil
+	}
+	h.ns = pkt
+	src := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6).SrcIP
+	eth := layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 0x99}, DstMAC: pkt.LinkLayer().(*layers.Ethernet).SrcMAC, EthernetType: layers.EthernetTypeIPv6}
+	ip6 := layers.IPv6{Version: 6, NextHeader: layers.IPProtocolICMPv6, HopLimit: 255, SrcIP: ns.TargetAddress, DstIP: src}
+	icmp6 := layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0)}
+	icmp6.SetNetworkLayerForChecksum(&ip6)
+	na := layers.ICMPv6NeighborAdvertisement{
+		Flags:         0x60, // Solicited, Override
+		TargetAddress: ns.TargetAddress,
+		Options:       []layers.ICMPv6Option{{Type: layers.ICMPv6OptTargetAddress, Data: h.mac}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, &eth, &ip6, &icmp6, &na)
+	h.recv <- buf.Bytes()
+	return nil
+}
+
+func (h *ndpHandle) Close() {
+	close(h.recv)
+}
+
+func TestSynScanner_getHwAddrV6(t *testing.T) {
+	ss := &SynScanner{
+		opts:           gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		bufPool:        &sync.Pool{New: func() interface{} { return gopacket.NewSerializeBuffer() }},
+		watchMacCacheT: newWatchMacCacheTable(),
+	}
+	h := &ndpHandle{mac: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x55}, recv: make(chan []byte, 1)}
+	ifc := &netIface{srcMac: testSrcMac, srcIp6: net.ParseIP("fd01::1"), handle: h}
+	go ss.recv(ifc)
+	defer h.Close()
+
+	mac, err := ss.getHwAddrV6(ifc, net.ParseIP("fd01::1:2345"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mac, h.mac) {
+		t.Error("mac:", mac)
+	}
+	// 请求节点组播
+	eth := h.ns.LinkLayer().(*layers.Ethernet)
+	ip6 := h.ns.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if eth.DstMAC.String() != "33:33:ff:01:23:45" || ip6.DstIP.String() != "ff02::1:ff01:2345" ||
+		!ip6.SrcIP.Equal(ifc.srcIp6) || ip6.HopLimit != 255 {
+		t.Error("ns:", eth.DstMAC, ip6.SrcIP, ip6.DstIP, ip6.HopLimit)
+	}
+
+	// 无响应超时
+	ifc2 := &netIface{srcMac: testSrcMac, srcIp6: ifc.srcIp6, handle: discardHandle{}}
+	if _, err = ss.getHwAddrV6(ifc2, net.ParseIP("fd01::9")); err == nil {
+		t.Error("no timeout")
+	}
+}
+
+func TestSynScanner_convertIPv6ToMac(t *testing.T) {
+	ss := &SynScanner{}
+	if mac, err := ss.convertIPv6ToMac(net.ParseIP("fe80::200:5eff:fe00:5301")); err != nil || mac.String() != "00:00:5e:00:53:01" {
+		t.Error(mac, err)
+	}
+	for _, ip := range []string{"fe80::1", "fe80::200:0:0:1", "2001:db8::200:5eff:fe00:5301"} {
+		if mac, err := ss.convertIPv6ToMac(net.ParseIP(ip)); err == nil {
+			t.Error(ip, mac)
+		}
+	}
+}
+
+func TestSynScanner_lastIpOption(t *testing.T) {
+	ss := &SynScanner{cookie: newSynCookie(), routeCache: make(map[routeKey]*route), option: port.ScannerOption{Rate: 1000, Timeout: 1000}}
+	ss.watchIpStatusT = newWatchIpStatusTable(time.Duration(ss.option.Timeout), 0, nil, nil)
+	defer ss.watchIpStatusT.Close()
+	ss.lastIpOption.Store(&port.IpOption{})
+	r := &route{ready: make(chan struct{}), err: io.EOF, expire: time.Now().Add(time.Hour)}
+	close(r.ready)
+	ss.routeCache[ss.routeKeyOf(net.IPv4(10, 0, 0, 1))] = r // 不发包
+
+	ss.Scan(net.IPv4(10, 0, 0, 1), 80, port.IpOption{FingerPrint: true, Hosts: []string{"a.com"}})
+	last := ss.lastIpOption.Load().(*port.IpOption)
+	if !last.FingerPrint || last.Hosts != nil {
+		t.Errorf("new option: got %+v", *last)
+	}
+	// 选项相同时不更新
+	ss.Scan(net.IPv4(10, 0, 0, 2), 80, port.IpOption{FingerPrint: true})
+	if ss.lastIpOption.Load().(*port.IpOption) != last {
+		t.Error("same option stored again")
+	}
+	ss.Scan(net.IPv4(10, 0, 0, 3), 80, port.IpOption{Httpx: true})
+	if last = ss.lastIpOption.Load().(*port.IpOption); !last.Httpx || last.FingerPrint {
+		t.Errorf("changed option: got %+v", *last)
+	}
+}
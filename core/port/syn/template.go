@@ -0,0 +1,134 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+)
+
+const ethHeaderLen = 14
+
+// tcpTemplate 预构建的TCP探测包(以太网+IP+TCP), 对应一组(源地址, 网关MAC)
+// 发送时只写入目的IP、端口、序列号和确认号, 并在预先计算的累加和上增量计算校验和
+type tcpTemplate struct {
+	data   []byte
+	gwMac  net.HardwareAddr // 为空时(内网)每次写入目的MAC
+	ipv6   bool
+	tcpOff int
+	ipSum  uint32 // IPv4首部中不变字段的累加和
+	tcpSum uint32 // 伪首部和TCP首部中不变字段的累加和
+}
+
+// newTcpTemplate 以源地址、网关MAC和tcp的标志位、选项构建模板
+func newTcpTemplate(srcMac, gwMac net.HardwareAddr, srcIp net.IP, tcp layers.TCP) (*tcpTemplate, error) {
+	eth := layers.Ethernet{
+		SrcMAC:       srcMac,
+		DstMAC:       make(net.HardwareAddr, 6),
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	if gwMac != nil {
+		eth.DstMAC = gwMac
+	}
+	// 可变字段置0
+	tcp.SrcPort, tcp.DstPort, tcp.Seq, tcp.Ack, tcp.Checksum = 0, 0, 0, 0, 0
+	t := &tcpTemplate{gwMac: gwMac}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	var err error
+	if srcIp.To4() != nil {
+		ip4 := layers.IPv4{
+			SrcIP:    srcIp.To4(),
+			DstIP:    net.IPv4zero.To4(),
+			Version:  4,
+			TTL:      128,
+			Flags:    layers.IPv4DontFragment,
+			Protocol: layers.IPProtocolTCP,
+		}
+		err = gopacket.SerializeLayers(buf, opts, &eth, &ip4, &tcp)
+		t.tcpOff = ethHeaderLen + 20
+	} else {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ip6 := layers.IPv6{
+			Version:    6,
+			NextHeader: layers.IPProtocolTCP,
+			HopLimit:   64,
+			SrcIP:      srcIp,
+			DstIP:      net.IPv6zero,
+		}
+		err = gopacket.SerializeLayers(buf, opts, &eth, &ip6, &tcp)
+		t.ipv6 = true
+		t.tcpOff = ethHeaderLen + 40
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.data = append([]byte{}, buf.Bytes()...)
+
+	// 不含以太网填充
+	ip := t.data[ethHeaderLen:t.tcpOff]
+	var tcpData []byte
+	if t.ipv6 {
+		tcpData = t.data[t.tcpOff : t.tcpOff+int(binary.BigEndian.Uint16(ip[4:6]))]
+		t.tcpSum = sum16(ip[8:24], 0) // src ip
+	} else {
+		tcpData = t.data[t.tcpOff : ethHeaderLen+int(binary.BigEndian.Uint16(ip[2:4]))]
+		t.ipSum = sum16(ip, 0)
+		t.tcpSum = sum16(ip[12:16], 0)
+	}
+	t.tcpSum += uint32(layers.IPProtocolTCP) + uint32(len(tcpData))
+	t.tcpSum = sum16(tcpData, t.tcpSum)
+	return t, nil
+}
+
+// build 将探测包写入buf并返回, buf容量足够时不分配内存
+func (t *tcpTemplate) build(buf []byte, dstMac net.HardwareAddr, dstIp net.IP, srcPort, dstPort uint16, seq, ack uint32) []byte {
+	data := append(buf[:0], t.data...)
+	if t.gwMac == nil {
+		copy(data[0:6], dstMac)
+	}
+	ip := data[ethHeaderLen:t.tcpOff]
+	tcp := data[t.tcpOff:]
+
+	var dstSum uint32
+	if t.ipv6 {
+		copy(ip[24:40], dstIp)
+		dstSum = sum16(ip[24:40], 0)
+	} else {
+		copy(ip[16:20], dstIp.To4())
+		dstSum = sum16(ip[16:20], 0)
+		id := uint16(40000 + seq%10000)
+		binary.BigEndian.PutUint16(ip[4:6], id)
+		binary.BigEndian.PutUint16(ip[10:12], fold(t.ipSum+dstSum+uint32(id)))
+	}
+
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	binary.BigEndian.PutUint32(tcp[8:12], ack)
+	sum := t.tcpSum + dstSum + uint32(srcPort) + uint32(dstPort) + seq>>16 + seq&0xffff + ack>>16 + ack&0xffff
+	binary.BigEndian.PutUint16(tcp[16:18], fold(sum))
+	return data
+}
+
+// sum16 按16位累加
+func sum16(b []byte, sum uint32) uint32 {
+	n := len(b)
+	for i := 0; i+1 < n; i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if n%2 == 1 {
+		sum += uint32(b[n-1]) << 8
+	}
+	return sum
+}
+
+// fold 折叠累加和并取反, 得到校验和
+func fold(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
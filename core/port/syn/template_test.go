@@ -0,0 +1,119 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"bytes"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	testSrcMac = net.HardwareAddr{0x00, 0x0c, 0x29, 0x01, 0x02, 0x03}
+	testGwMac  = net.HardwareAddr{0x00, 0x0c, 0x29, 0x0a, 0x0b, 0x0c}
+)
+
+// serializeProbe gopacket构建探测包, 用于对比
+func serializeProbe(buf gopacket.SerializeBuffer, srcIp, dstIp net.IP, tcp layers.TCP) []byte {
+	eth := layers.Ethernet{SrcMAC: testSrcMac, DstMAC: testGwMac, EthernetType: layers.EthernetTypeIPv4}
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if srcIp.To4() != nil {
+		ip4 := layers.IPv4{SrcIP: srcIp, DstIP: dstIp, Version: 4, TTL: 128, Id: uint16(40000 + tcp.Seq%10000),
+			Flags: layers.IPv4DontFragment, Protocol: layers.IPProtocolTCP}
+		tcp.SetNetworkLayerForChecksum(&ip4)
+		gopacket.SerializeLayers(buf, opts, &eth, &ip4, &tcp)
+	} else {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ip6 := layers.IPv6{Version: 6, NextHeader: layers.IPProtocolTCP, HopLimit: 64, SrcIP: srcIp, DstIP: dstIp}
+		tcp.SetNetworkLayerForChecksum(&ip6)
+		gopacket.SerializeLayers(buf, opts, &eth, &ip6, &tcp)
+	}
+	return buf.Bytes()
+}
+
+func TestTcpTemplate(t *testing.T) {
+	for _, c := range []struct {
+		src, dst net.IP
+		gwMac    net.HardwareAddr
+		tcp      layers.TCP
+	}{
+		{net.IPv4(192, 168, 1, 2).To4(), net.IPv4(1, 1, 1, 1).To4(), testGwMac,
+			layers.TCP{SrcPort: 50000, DstPort: 443, Seq: 0x12345678, SYN: true, Window: 65280, Options: synOptions}},
+		{net.IPv4(192, 168, 1, 2).To4(), net.IPv4(192, 168, 1, 254).To4(), nil,
+			layers.TCP{SrcPort: 58999, DstPort: 65535, Seq: 0xffffffff, Ack: 0xffffffff, ACK: true, Window: 1024}},
+		{net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::1:1"), testGwMac,
+			layers.TCP{SrcPort: 49000, DstPort: 22, Seq: 1, FIN: true, PSH: true, URG: true, Window: 65280}},
+	} {
+		tmpl, err := newTcpTemplate(testSrcMac, c.gwMac, c.src, c.tcp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := tmpl.build(nil, testGwMac, c.dst, uint16(c.tcp.SrcPort), uint16(c.tcp.DstPort), c.tcp.Seq, c.tcp.Ack)
+		// 与gopacket计算结果一致
+		if expect := serializeProbe(gopacket.NewSerializeBuffer(), c.src, c.dst, c.tcp); !bytes.Equal(data, expect) {
+			t.Errorf("%s template mismatch:\n%x\n%x", c.dst, data, expect)
+		}
+	}
+}
+
+func BenchmarkTcpTemplate_build(b *testing.B) {
+	tmpl, _ := newTcpTemplate(testSrcMac, testGwMac, net.IPv4(192, 168, 1, 2).To4(), layers.TCP{SYN: true, Window: 65280, Options: synOptions})
+	dstIp := net.IPv4(1, 1, 1, 1).To4()
+	buf := make([]byte, 0, 128)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = tmpl.build(buf, nil, dstIp, 50000, uint16(i), uint32(i), 0)
+	}
+}
+
+func BenchmarkSerializeProbe(b *testing.B) {
+	srcIp, dstIp := net.IPv4(192, 168, 1, 2).To4(), net.IPv4(1, 1, 1, 1).To4()
+	buf := gopacket.NewSerializeBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Clear()
+		serializeProbe(buf, srcIp, dstIp, layers.TCP{SrcPort: 50000, DstPort: layers.TCPPort(i), Seq: uint32(i), SYN: true, Window: 65280, Options: synOptions})
+	}
+}
+
+type discardHandle struct{}
+
+func (discardHandle) ReadPacketData() ([]byte, error) { return nil, nil }
+func (discardHandle) WritePacketData([]byte) error    { return nil }
+func (discardHandle) Close()                          {}
+
+func BenchmarkSynScanner_sendProbe(b *testing.B) {
+	srcIp := net.IPv4(192, 168, 1, 2).To4()
+	ss := &SynScanner{cookie: newSynCookie(), routeCache: make(map[routeKey]*route)}
+	r := &route{ifc: &netIface{srcMac: testSrcMac, srcIp: srcIp, handle: discardHandle{}}, srcIp: srcIp, gwMac: testGwMac, ready: make(chan struct{})}
+	close(r.ready)
+	r.tmpl, _ = newTcpTemplate(testSrcMac, testGwMac, srcIp, ss.probeTcp(0, 0, 0))
+	dstIp := net.IPv4(1, 1, 1, 1).To4()
+	ss.routeCache[ss.routeKeyOf(dstIp)] = r
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ss.sendProbe(dstIp, uint16(i))
+	}
+}
+
+func BenchmarkSynScanner_Scan(b *testing.B) {
+	srcIp := net.IPv4(192, 168, 1, 2).To4()
+	ss := &SynScanner{cookie: newSynCookie(), routeCache: make(map[routeKey]*route), option: port.ScannerOption{Rate: 1000, Timeout: 1000}}
+	ss.watchIpStatusT = newWatchIpStatusTable(time.Duration(ss.option.Timeout), 0, nil, nil)
+	defer ss.watchIpStatusT.Close()
+	ss.lastIpOption.Store(&port.IpOption{})
+	r := &route{ifc: &netIface{srcMac: testSrcMac, srcIp: srcIp, handle: discardHandle{}}, srcIp: srcIp, gwMac: testGwMac, ready: make(chan struct{})}
+	close(r.ready)
+	r.tmpl, _ = newTcpTemplate(testSrcMac, testGwMac, srcIp, ss.probeTcp(0, 0, 0))
+	dstIp := net.IPv4(1, 1, 1, 1).To4()
+	ss.routeCache[ss.routeKeyOf(dstIp)] = r
+	ipOption := port.IpOption{FingerPrint: true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ss.Scan(dstIp, uint16(i), ipOption)
+	}
+}
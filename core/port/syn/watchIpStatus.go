@@ -4,33 +4,69 @@ package syn
 
 import (
 	"github.com/XinRoom/go-portScan/core/port"
+	"net"
 	"sync"
 	"time"
 )
 
 type watchIpStatus struct {
 	ReceivedPort map[uint16]struct{}
+	SentPort     map[uint16]sentProbe // 仅在需要重发或判断无响应端口时记录
 	LastTime     time.Time
 	IpOption     port.IpOption
 }
 
+type sentProbe struct {
+	Times    uint8     // 已发送次数
+	LastTime time.Time // 最后发送时间
+}
+
+// ipKey IP状态表的键, IPv4使用IPv6映射地址, 避免每个探测包都转换为字符串
+type ipKey [16]byte
+
+func newIpKey(ip net.IP) (k ipKey) {
+	if ip4 := ip.To4(); ip4 != nil {
+		k[10], k[11] = 0xff, 0xff
+		copy(k[12:], ip4)
+	} else {
+		copy(k[:], ip)
+	}
+	return
+}
+
+// IP 转换为net.IP, IPv4为4字节
+func (k ipKey) IP() net.IP {
+	ip := make(net.IP, 16)
+	copy(ip, k[:])
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
 // IP状态更新表
 type watchIpStatusTable struct {
-	watchIpS map[string]*watchIpStatus
-	lock     sync.RWMutex
-	isDone   bool
+	watchIpS    map[ipKey]*watchIpStatus
+	lock        sync.RWMutex
+	isDone      bool
+	retries     int                               // 无响应时的重发次数
+	retryFunc   func(ip ipKey, ports []uint16)    // 重发回调
+	timeoutFunc func(ip ipKey, wi *watchIpStatus) // 过期回调
 }
 
-func newWatchIpStatusTable(timeout time.Duration) (w *watchIpStatusTable) {
+func newWatchIpStatusTable(timeout time.Duration, retries int, retryFunc func(ip ipKey, ports []uint16), timeoutFunc func(ip ipKey, wi *watchIpStatus)) (w *watchIpStatusTable) {
 	w = &watchIpStatusTable{
-		watchIpS: make(map[string]*watchIpStatus),
+		watchIpS:    make(map[ipKey]*watchIpStatus),
+		retries:     retries,
+		retryFunc:   retryFunc,
+		timeoutFunc: timeoutFunc,
 	}
 	go w.cleanTimeout(timeout)
 	return
 }
 
-// CreateOrUpdateLastTime 新建或者更新LastTime
-func (w *watchIpStatusTable) CreateOrUpdateLastTime(ip string, ipOption port.IpOption) {
+// CreateOrUpdateLastTime 新建或者更新LastTime, 新建时返回created
+func (w *watchIpStatusTable) CreateOrUpdateLastTime(ip ipKey, ipOption port.IpOption) (created bool) {
 	lastTime := time.Now()
 	w.lock.Lock()
 	wi, ok := w.watchIpS[ip]
@@ -38,12 +74,14 @@ func (w *watchIpStatusTable) CreateOrUpdateLastTime(ip string, ipOption port.IpO
 		wi.LastTime = lastTime
 	} else {
 		w.watchIpS[ip] = &watchIpStatus{LastTime: lastTime, ReceivedPort: make(map[uint16]struct{}), IpOption: ipOption}
+		created = true
 	}
 	w.lock.Unlock()
+	return
 }
 
 // RecordPort 记录收到的端口
-func (w *watchIpStatusTable) RecordPort(ip string, port uint16) {
+func (w *watchIpStatusTable) RecordPort(ip ipKey, port uint16) {
 	w.lock.Lock()
 	wi, ok := w.watchIpS[ip]
 	if ok {
@@ -52,8 +90,32 @@ func (w *watchIpStatusTable) RecordPort(ip string, port uint16) {
 	w.lock.Unlock()
 }
 
+// RecordSentPort 记录已发送探测的端口
+func (w *watchIpStatusTable) RecordSentPort(ip ipKey, port uint16) {
+	w.lock.Lock()
+	wi, ok := w.watchIpS[ip]
+	if ok {
+		if wi.SentPort == nil {
+			wi.SentPort = make(map[uint16]sentProbe)
+		}
+		wi.SentPort[port] = sentProbe{Times: 1, LastTime: time.Now()}
+	}
+	w.lock.Unlock()
+}
+
+// SentTimes 获取端口已发送探测的次数
+func (w *watchIpStatusTable) SentTimes(ip ipKey, port uint16) (times int) {
+	w.lock.RLock()
+	wi, ok := w.watchIpS[ip]
+	if ok {
+		times = int(wi.SentPort[port].Times)
+	}
+	w.lock.RUnlock()
+	return
+}
+
 // HasPort 判断是否检测过对应端口
-func (w *watchIpStatusTable) HasPort(ip string, port uint16) (has bool) {
+func (w *watchIpStatusTable) HasPort(ip ipKey, port uint16) (has bool) {
 	w.lock.RLock()
 	wi, ok := w.watchIpS[ip]
 	if ok {
@@ -64,7 +126,7 @@ func (w *watchIpStatusTable) HasPort(ip string, port uint16) (has bool) {
 }
 
 // GetIpOption 判断是否在监视对应IP
-func (w *watchIpStatusTable) GetIpOption(ip string) (ipOption port.IpOption, has bool) {
+func (w *watchIpStatusTable) GetIpOption(ip ipKey) (ipOption port.IpOption, has bool) {
 	w.lock.RLock()
 	wi, has := w.watchIpS[ip]
 	if has {
@@ -86,15 +148,43 @@ func (w *watchIpStatusTable) Close() {
 	w.isDone = true
 }
 
-// 清理过期数据
+// 清理过期数据, 并重发超时未响应的探测
 func (w *watchIpStatusTable) cleanTimeout(timeout time.Duration) {
-	var needDel map[string]struct{}
+	var needDel map[ipKey]struct{}
+	var needRetry map[ipKey][]uint16
+	interval := time.Second
+	if timeout*time.Millisecond < interval {
+		interval = timeout * time.Millisecond
+	}
 	for {
-		needDel = make(map[string]struct{})
+		needDel = make(map[ipKey]struct{})
+		needRetry = make(map[ipKey][]uint16)
 		if w.isDone {
 			break
 		}
-		time.Sleep(time.Second)
+		time.Sleep(interval)
+		if w.retries > 0 {
+			now := time.Now()
+			w.lock.Lock()
+			for k, v := range w.watchIpS {
+				for _port, sp := range v.SentPort {
+					if _, ok := v.ReceivedPort[_port]; ok {
+						continue
+					}
+					if int(sp.Times) <= w.retries && now.Sub(sp.LastTime) > timeout*time.Millisecond {
+						v.SentPort[_port] = sentProbe{Times: sp.Times + 1, LastTime: now}
+						v.LastTime = now
+						needRetry[k] = append(needRetry[k], _port)
+					}
+				}
+			}
+			w.lock.Unlock()
+			if w.retryFunc != nil {
+				for k, ports := range needRetry {
+					w.retryFunc(k, ports)
+				}
+			}
+		}
 		w.lock.RLock()
 		for k, v := range w.watchIpS {
 			if time.Since(v.LastTime) > timeout*time.Millisecond {
@@ -105,8 +195,16 @@ func (w *watchIpStatusTable) cleanTimeout(timeout time.Duration) {
 		if len(needDel) > 0 {
 			for k := range needDel {
 				w.lock.Lock()
-				delete(w.watchIpS, k)
+				wi, ok := w.watchIpS[k]
+				if ok && time.Since(wi.LastTime) <= timeout*time.Millisecond { // 期间被更新
+					ok = false
+				} else {
+					delete(w.watchIpS, k)
+				}
 				w.lock.Unlock()
+				if ok && w.timeoutFunc != nil {
+					w.timeoutFunc(k, wi)
+				}
 			}
 		}
 	}
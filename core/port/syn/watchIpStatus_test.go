@@ -0,0 +1,45 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchIpStatusTable_Retry(t *testing.T) {
+	var lock sync.Mutex
+	var retried []uint16
+	timeoutC := make(chan *watchIpStatus, 1)
+	w := newWatchIpStatusTable(100, 2, func(ip ipKey, ports []uint16) {
+		lock.Lock()
+		retried = append(retried, ports...)
+		lock.Unlock()
+	}, func(ip ipKey, wi *watchIpStatus) {
+		timeoutC <- wi
+	})
+	defer w.Close()
+
+	ip := newIpKey(net.ParseIP("192.168.1.1"))
+	w.CreateOrUpdateLastTime(ip, port.IpOption{})
+	w.RecordSentPort(ip, 80)
+	w.RecordSentPort(ip, 443)
+	w.RecordPort(ip, 443)
+
+	select {
+	case wi := <-timeoutC:
+		lock.Lock()
+		defer lock.Unlock()
+		if len(retried) != 2 || retried[0] != 80 || retried[1] != 80 {
+			t.Error("retried:", retried)
+		}
+		if wi.SentPort[80].Times != 3 || wi.SentPort[443].Times != 1 {
+			t.Error("sent times:", wi.SentPort)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("ip status not timeout")
+	}
+}
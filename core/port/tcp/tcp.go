@@ -27,6 +27,7 @@ type TcpScanner struct {
 	isDone  bool
 	option  port.ScannerOption
 	wg      sync.WaitGroup
+	pending port.Pending // 未完成的探测
 }
 
 // NewTcpScanner Tcp扫描器
@@ -58,53 +59,88 @@ func (ts *TcpScanner) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error
 		return errors.New("scanner is closed")
 	}
 	ts.wg.Add(1)
+	// ip有多个域名时按域名分别探测和输出
+	openIpPorts := port.OpenIpPort{
+		Ip:    ip,
+		Port:  dst,
+		State: port.StateOpen,
+		IpOption: port.IpOption{
+			Hosts: ipOption.Hosts,
+			Ext:   ipOption.Ext,
+		},
+	}.SplitHosts()
+	ids := make([]uint64, len(openIpPorts))
+	for i, openIpPort := range openIpPorts {
+		ids[i] = ts.pending.Add(ip, dst, "", openIpPort.Host)
+	}
 	go func() {
 		defer ts.wg.Done()
-		//fmt.Println(1)
-		openIpPort := port.OpenIpPort{
-			Ip:   ip,
-			Port: dst,
-			IpOption: port.IpOption{
-				Ext: ipOption.Ext,
-			},
-		}
-		var isDailErr bool
-		if ipOption.FingerPrint {
-			openIpPort.Service, openIpPort.Banner, isDailErr = fingerprint.PortIdentify("tcp", ip, dst, time.Duration(ts.option.Timeout)*time.Millisecond)
-			if isDailErr {
-				return
+		// 仅探测端口状态时进行一次连接; 服务识别和Http探测时使用其连接的结果
+		var dialErr error
+		if !ipOption.FingerPrint && !ipOption.Httpx {
+			var conn net.Conn
+			if conn, dialErr = net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(dst))), ts.timeout); conn != nil {
+				conn.Close()
 			}
 		}
-		if ipOption.Httpx && (openIpPort.Service == "" || openIpPort.Service == "http" || openIpPort.Service == "https") {
-			openIpPort.HttpInfo, openIpPort.Banner, isDailErr = fingerprint.ProbeHttpInfo(ip.String(), dst, openIpPort.Service, time.Duration(ts.option.Timeout)*time.Millisecond)
-			if isDailErr {
-				return
-			}
-			if openIpPort.HttpInfo != nil {
-				if strings.HasPrefix(openIpPort.HttpInfo.Url, "https") {
-					openIpPort.Service = "https"
-				} else {
-					openIpPort.Service = "http"
+		for i, openIpPort := range openIpPorts {
+			// 连接失败时端口对各域名均不可达
+			if dialErr == nil {
+				if dialErr = ts.identify(&openIpPort, ipOption); dialErr == nil {
+					ts.retChan <- openIpPort
 				}
 			}
-		}
-		if !ipOption.FingerPrint && !ipOption.Httpx {
-			conn, _ := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(dst))), ts.timeout)
-			if conn != nil {
-				conn.Close()
-			} else {
-				return
+			if dialErr != nil && ts.option.AllState {
+				openIpPort.State = dialState(dialErr)
+				ts.retChan <- openIpPort
 			}
+			ts.pending.Done(ids[i])
 		}
-		ts.retChan <- openIpPort
 	}()
 	return nil
 }
 
+// dialState 连接失败的端口状态, 对端发送了RST包时为closed, 否则为filtered
+func dialState(err error) string {
+	if strings.Contains(err.Error(), "refused") {
+		return port.StateClosed
+	}
+	return port.StateFiltered
+}
+
+// identify 服务识别和Http探测, 使用域名作为Host头和TLS SNI, 返回连接失败的错误
+func (ts *TcpScanner) identify(openIpPort *port.OpenIpPort, ipOption port.IpOption) (dialErr error) {
+	if ipOption.FingerPrint {
+		openIpPort.Service, openIpPort.Banner, dialErr = fingerprint.PortIdentifyHostErr("tcp", openIpPort.Ip, openIpPort.Host, openIpPort.Port, time.Duration(ts.option.Timeout)*time.Millisecond)
+		if dialErr != nil {
+			return
+		}
+	}
+	if ipOption.Httpx && (openIpPort.Service == "" || openIpPort.Service == "http" || openIpPort.Service == "https") {
+		openIpPort.HttpInfo, openIpPort.Banner, dialErr = fingerprint.ProbeHostHttpInfoErr(openIpPort.Ip, openIpPort.Host, openIpPort.Port, openIpPort.Service, time.Duration(ts.option.Timeout)*time.Millisecond)
+		if dialErr != nil {
+			return
+		}
+		if openIpPort.HttpInfo != nil {
+			if strings.HasPrefix(openIpPort.HttpInfo.Url, "https") {
+				openIpPort.Service = "https"
+			} else {
+				openIpPort.Service = "http"
+			}
+		}
+	}
+	return
+}
+
 func (ts *TcpScanner) Wait() {
 	ts.wg.Wait()
 }
 
+// Pending 未完成的探测
+func (ts *TcpScanner) Pending() []port.OpenIpPort {
+	return ts.pending.List()
+}
+
 // Close chan
 func (ts *TcpScanner) Close() {
 	ts.isDone = true
@@ -7,6 +7,7 @@ import (
 	"github.com/panjf2000/ants/v2"
 	"log"
 	"net"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -71,3 +72,65 @@ func TestTcpScanner_Scan(t *testing.T) {
 	<-single
 	t.Log(time.Since(start))
 }
+
+func TestTcpScanner_allState(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	openPort := uint16(ln.Addr().(*net.TCPAddr).Port)
+	ln2, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := uint16(ln2.Addr().(*net.TCPAddr).Port)
+	ln2.Close()
+
+	// 服务识别时使用其连接结果区分open和closed
+	for _, ipOption := range []port.IpOption{{}, {FingerPrint: true}} {
+		retChan := make(chan port.OpenIpPort, 10)
+		ts, err := NewTcpScanner(retChan, port.ScannerOption{Rate: 1000, Timeout: 500, AllState: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.Scan(net.ParseIP("127.0.0.1"), openPort, ipOption)
+		ts.Scan(net.ParseIP("127.0.0.1"), closedPort, ipOption)
+		ts.Wait()
+		ts.Close()
+		var n int
+		for op := range retChan {
+			state := "open"
+			if op.Port == closedPort {
+				state = "closed"
+			}
+			if op.State != state {
+				t.Errorf("fingerprint %v: %d got %s, want %s", ipOption.FingerPrint, op.Port, op.State, state)
+			}
+			n++
+		}
+		if n != 2 {
+			t.Errorf("fingerprint %v: got %d results, want 2", ipOption.FingerPrint, n)
+		}
+	}
+}
+
+func TestDialState(t *testing.T) {
+	_, err := net.DialTimeout("tcp", "127.0.0.1:1", time.Second)
+	if err == nil {
+		t.Skip("127.0.0.1:1 is open")
+	}
+	if state := dialState(err); state != port.StateClosed {
+		t.Errorf("refused: got %s", state)
+	}
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	if state := dialState(timeout); state != port.StateFiltered {
+		t.Errorf("timeout: got %s", state)
+	}
+}
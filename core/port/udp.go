@@ -1,3 +0,0 @@
-package port
-
-// A large number of UDP ports need to send packets in the corresponding format to return. Do not do temporarily.
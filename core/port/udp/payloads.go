@@ -0,0 +1,80 @@
+package udp
+
+// udp port payload def
+// ref https://github.com/nmap/nmap/blob/master/nmap-payloads
+// ref https://github.com/robertdavidgraham/masscan/blob/master/src/templ-payloads.c
+
+type payload struct {
+	Service string
+	Data    []byte
+}
+
+// 无对应载荷的端口发送空包
+var emptyPayload = payload{Data: []byte{}}
+
+var snmpV2cGet = []byte("\x30\x29\x02\x01\x01\x04\x06public\xa0\x1c\x02\x04\x56\x78\x9a\xbc\x02\x01\x00\x02\x01\x00\x30\x0e\x30\x0c\x06\x08\x2b\x06\x01\x02\x01\x01\x01\x00\x05\x00")
+
+var snmpV1Get = []byte("\x30\x29\x02\x01\x00\x04\x06public\xa0\x1c\x02\x04\x56\x78\x9a\xbc\x02\x01\x00\x02\x01\x00\x30\x0e\x30\x0c\x06\x08\x2b\x06\x01\x02\x01\x01\x01\x00\x05\x00")
+
+// rpcNull RPC NULL 调用
+func rpcNull(prog, vers byte) []byte {
+	return []byte{
+		0x72, 0xfe, 0x1d, 0x13, // xid
+		0x00, 0x00, 0x00, 0x00, // call
+		0x00, 0x00, 0x00, 0x02, // rpc version
+		0x00, 0x01, 0x86, prog, // program
+		0x00, 0x00, 0x00, vers, // program version
+		0x00, 0x00, 0x00, 0x00, // NULL procedure
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // AUTH_NULL credentials
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // AUTH_NULL verifier
+	}
+}
+
+var ntpClient = func() []byte {
+	b := make([]byte, 48)
+	b[0] = 0xe3 // LI=3 VN=4 Mode=3(client)
+	return b
+}()
+
+var portPayloads = map[uint16][]payload{
+	7:   {{"echo", []byte("\r\n\r\n")}},
+	19:  {{"chargen", []byte("\r\n")}},
+	53:  {{"dns", []byte("\x00\x06\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00\x07version\x04bind\x00\x00\x10\x00\x03")}},
+	69:  {{"tftp", []byte("\x00\x01r7tftp.txt\x00octet\x00")}},
+	111: {{"rpcbind", rpcNull(0xa0, 2)}},
+	123: {{"ntp", ntpClient}},
+	137: {{"netbios-ns", []byte("\x80\xf0\x00\x10\x00\x01\x00\x00\x00\x00\x00\x00\x20CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\x00\x00\x21\x00\x01")}},
+	161: {
+		{"snmp", snmpV2cGet},
+		{"snmp", snmpV1Get},
+	},
+	177: {{"xdmcp", []byte("\x00\x01\x00\x02\x00\x01\x00")}},
+	389: {{"ldap", []byte("\x30\x84\x00\x00\x00\x2d\x02\x01\x07\x63\x84\x00\x00\x00\x24\x04\x00\x0a\x01\x00\x0a\x01\x00\x02\x01\x00\x02\x01\x64\x01\x01\x00\x87\x0bobjectClass\x30\x84\x00\x00\x00\x00")}},
+	500: {{"isakmp", []byte("" +
+		"\x00\x11\x22\x33\x44\x55\x66\x77\x00\x00\x00\x00\x00\x00\x00\x00\x01\x10\x02\x00\x00\x00\x00\x00\x00\x00\x00\x54" + // header, main mode
+		"\x00\x00\x00\x38\x00\x00\x00\x01\x00\x00\x00\x01" + // SA
+		"\x00\x00\x00\x2c\x01\x01\x00\x01" + // proposal
+		"\x00\x00\x00\x24\x01\x01\x00\x00" + // transform
+		"\x80\x01\x00\x05\x80\x02\x00\x02\x80\x03\x00\x01\x80\x04\x00\x02\x80\x0b\x00\x01\x00\x0c\x00\x04\x00\x00\x70\x80")}}, // 3DES SHA PSK MODP1024 28800s
+	623:   {{"ipmi", []byte("\x06\x00\xff\x07\x00\x00\x00\x00\x00\x00\x00\x00\x00\x09\x20\x18\xc8\x81\x00\x38\x8e\x04\xb5")}},
+	1194:  {{"openvpn", []byte("\x38\x01\x02\x03\x04\x05\x06\x07\x08\x00\x00\x00\x00\x00")}},
+	1434:  {{"ms-sql-m", []byte("\x02")}},
+	1604:  {{"citrix-ica", []byte("\x1e\x00\x01\x30\x02\xfd\xa8\xe3\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")}},
+	1900:  {{"ssdp", []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n")}},
+	2049:  {{"nfs", rpcNull(0xa3, 3)}},
+	3478:  {{"stun", []byte("\x00\x01\x00\x00\x21\x12\xa4\x42\x47\x6f\x50\x6f\x72\x74\x53\x63\x61\x6e\x00\x00")}},
+	5060:  {{"sip", []byte("OPTIONS sip:nm SIP/2.0\r\nVia: SIP/2.0/UDP nm;branch=foo;rport\r\nFrom: <sip:nm@nm>;tag=root\r\nTo: <sip:nm2@nm2>\r\nCall-ID: 50000\r\nCSeq: 42 OPTIONS\r\nMax-Forwards: 70\r\nContent-Length: 0\r\nContact: <sip:nm@nm>\r\nAccept: application/sdp\r\n\r\n")}},
+	5351:  {{"nat-pmp", []byte("\x00\x00")}},
+	5353:  {{"mdns", []byte("\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x09_services\x07_dns-sd\x04_udp\x05local\x00\x00\x0c\x00\x01")}},
+	5683:  {{"coap", []byte("\x40\x01\x01\xce\xbb.well-known\x04core")}},
+	10001: {{"ubiquiti", []byte("\x01\x00\x00\x00")}},
+	11211: {{"memcached", []byte("\x00\x01\x00\x00\x00\x01\x00\x00stats\r\n")}},
+}
+
+// getPayloads 获取端口对应的探测载荷
+func getPayloads(_port uint16) []payload {
+	if p, ok := portPayloads[_port]; ok {
+		return p
+	}
+	return []payload{emptyPayload}
+}
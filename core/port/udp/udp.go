@@ -0,0 +1,166 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"github.com/XinRoom/go-portScan/core/port"
+	limiter "golang.org/x/time/rate"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var DefaultUdpOption = port.ScannerOption{
+	Rate:    500,
+	Timeout: 1500,
+}
+
+// 无响应时的重发次数
+const sendTimes = 2
+
+var readBufPool = &sync.Pool{
+	New: func() interface{} {
+		return make([]byte, 4096)
+	},
+}
+
+type UdpScanner struct {
+	retChan chan port.OpenIpPort // 返回值队列
+	limiter *limiter.Limiter
+	ctx     context.Context
+	timeout time.Duration
+	isDone  bool
+	option  port.ScannerOption
+	wg      sync.WaitGroup
+	pending port.Pending // 未完成的探测
+}
+
+// NewUdpScanner Udp扫描器
+func NewUdpScanner(retChan chan port.OpenIpPort, option port.ScannerOption) (us *UdpScanner, err error) {
+	// option verify
+	if option.Rate < 10 {
+		err = errors.New("rate can not set < 10")
+		return
+	}
+	if option.Timeout <= 0 {
+		err = errors.New("timeout can not set to 0")
+		return
+	}
+
+	us = &UdpScanner{
+		retChan: retChan,
+		limiter: limiter.NewLimiter(limiter.Every(time.Second/time.Duration(option.Rate)), option.Rate/10),
+		ctx:     context.Background(),
+		timeout: time.Duration(option.Timeout) * time.Millisecond,
+		option:  option,
+	}
+
+	return
+}
+
+// Scan 对指定IP和dis port进行扫描
+func (us *UdpScanner) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error {
+	if us.isDone {
+		return errors.New("scanner is closed")
+	}
+	us.wg.Add(1)
+	// ip有多个域名时按域名分别输出
+	openIpPorts := port.OpenIpPort{
+		Ip:       ip,
+		Port:     dst,
+		Protocol: "udp",
+		IpOption: port.IpOption{
+			Hosts: ipOption.Hosts,
+			Ext:   ipOption.Ext,
+		},
+	}.SplitHosts()
+	ids := make([]uint64, len(openIpPorts))
+	for i, openIpPort := range openIpPorts {
+		ids[i] = us.pending.Add(ip, dst, "udp", openIpPort.Host)
+	}
+	go func() {
+		defer us.wg.Done()
+		defer func() {
+			for _, id := range ids {
+				us.pending.Done(id)
+			}
+		}()
+		state, service, banner := us.probe(ip, dst)
+		if state != port.StateOpen && !us.option.AllState {
+			return
+		}
+		for _, openIpPort := range openIpPorts {
+			openIpPort.State = state
+			openIpPort.Service = service
+			if ipOption.FingerPrint {
+				openIpPort.Banner = banner
+			}
+			us.retChan <- openIpPort
+		}
+	}()
+	return nil
+}
+
+// probe 发送端口对应的载荷并判断端口状态: 收到响应为open，收到ICMP端口不可达为closed，无响应为open|filtered
+func (us *UdpScanner) probe(ip net.IP, dst uint16) (state string, service string, banner []byte) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), strconv.Itoa(int(dst))), us.timeout)
+	if err != nil {
+		return port.StateOpenFiltered, "", nil
+	}
+	defer conn.Close()
+
+	buf := readBufPool.Get().([]byte)
+	defer readBufPool.Put(buf)
+
+	payloads := getPayloads(dst)
+	for i := 0; i < sendTimes; i++ {
+		for _, p := range payloads {
+			if _, err = conn.Write(p.Data); err != nil {
+				if isUnreachable(err) {
+					return port.StateClosed, "", nil
+				}
+				return port.StateOpenFiltered, "", nil
+			}
+		}
+		conn.SetReadDeadline(time.Now().Add(us.timeout))
+		var n int
+		n, err = conn.Read(buf)
+		if n > 0 {
+			banner = make([]byte, n)
+			copy(banner, buf[:n])
+			return port.StateOpen, payloads[0].Service, banner
+		}
+		if err != nil && isUnreachable(err) {
+			return port.StateClosed, "", nil
+		}
+	}
+	return port.StateOpenFiltered, "", nil
+}
+
+// isUnreachable 已连接的udp socket在收到ICMP端口不可达后，读写会返回错误
+func isUnreachable(err error) bool {
+	errStr := err.Error()
+	return strings.Contains(errStr, "refused") || strings.Contains(errStr, "forcibly closed")
+}
+
+func (us *UdpScanner) Wait() {
+	us.wg.Wait()
+}
+
+// Pending 未完成的探测
+func (us *UdpScanner) Pending() []port.OpenIpPort {
+	return us.pending.List()
+}
+
+// Close chan
+func (us *UdpScanner) Close() {
+	us.isDone = true
+	close(us.retChan)
+}
+
+// WaitLimiter Waiting for the speed limit
+func (us *UdpScanner) WaitLimiter() error {
+	return us.limiter.Wait(us.ctx)
+}
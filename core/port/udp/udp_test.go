@@ -0,0 +1,62 @@
+package udp
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"testing"
+)
+
+func TestUdpScanner_Scan(t *testing.T) {
+	// udp echo server
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	openPort := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+	// closed port
+	conn2, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := uint16(conn2.LocalAddr().(*net.UDPAddr).Port)
+	conn2.Close()
+
+	retChan := make(chan port.OpenIpPort, 10)
+	us, err := NewUdpScanner(retChan, DefaultUdpOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.IPv4(127, 0, 0, 1).To4()
+	us.Scan(ip, openPort, port.IpOption{FingerPrint: true})
+	us.Scan(ip, closedPort, port.IpOption{})
+	us.Wait()
+	us.Close()
+
+	var rets []port.OpenIpPort
+	for ret := range retChan {
+		rets = append(rets, ret)
+	}
+	if len(rets) != 1 || rets[0].Port != openPort || rets[0].Protocol != "udp" || rets[0].State != port.StateOpen {
+		t.Fatal(rets)
+	}
+	if string(rets[0].Banner) != "echo:" {
+		t.Error(string(rets[0].Banner))
+	}
+
+	if state, _, _ := us.probe(ip, closedPort); state != port.StateClosed {
+		t.Error("closed port state:", state)
+	}
+}
@@ -0,0 +1,67 @@
+package scan
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint 扫描进度, 定期及中断时保存, 用于恢复扫描
+type Checkpoint struct {
+	Targets  []string          `json:"targets,omitempty"`  // -ip的目标, 使用-iL时为空, 文件路径在Flags中
+	Ports    string            `json:"ports"`              // 端口
+	Seed     int64             `json:"seed"`               // 全局扫描顺序的随机种子
+	Shard    string            `json:"shard,omitempty"`    // 分片
+	Flags    map[string]string `json:"flags"`              // 其它命令行参数
+	Batch    uint64            `json:"batch"`              // 目标批次序号, 之前的批次已扫描完成
+	Window   uint64            `json:"window"`             // 当前批次的ip窗口序号, 之前的窗口已扫描完成
+	Scanning bool              `json:"scanning,omitempty"` // 当前窗口已开始端口扫描, LiveIps和Index有效
+	LiveIps  []string          `json:"live_ips,omitempty"` // 当前窗口ping得到的存活ip
+	Index    uint64            `json:"index"`              // 当前窗口的置换序号, 之前的目标已扫描完成
+	Pending  []Target          `json:"pending,omitempty"`  // 中断时未完成的探测(如服务识别), 恢复时重新扫描
+	Time     time.Time         `json:"time"`
+}
+
+// Target 扫描目标
+type Target struct {
+	Ip       string `json:"ip"`
+	Port     uint16 `json:"port"`
+	Protocol string `json:"protocol,omitempty"` // 为空时为tcp
+	Host     string `json:"host,omitempty"`     // 目标域名
+}
+
+// LoadCheckpoint 读取进度文件
+func LoadCheckpoint(file string) (cp *Checkpoint, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	cp = &Checkpoint{}
+	err = json.Unmarshal(data, cp)
+	return
+}
+
+// Save 保存进度文件, 先写临时文件再重命名, 中途退出不会损坏已有的进度文件
+func (cp *Checkpoint) Save(file string) (err error) {
+	cp.Time = time.Now()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,42 @@
+package scan
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint_SaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scan.resume")
+	cp := &Checkpoint{
+		Targets:  []string{"10.0.0.0/24", "fd00::1"},
+		Ports:    "top1000,8080",
+		Seed:     42,
+		Shard:    "1/2",
+		Flags:    map[string]string{"sV": "true", "rate": "3000"},
+		Batch:    3,
+		Scanning: true,
+		LiveIps:  []string{"10.0.0.2"},
+		Index:    12345,
+		Pending:  []Target{{Ip: "10.0.0.2", Port: 443}},
+	}
+	for i := 0; i < 2; i++ { // 覆盖已有文件
+		if err := cp.Save(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cp2, err := LoadCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp2.Time.Equal(cp.Time) {
+		t.Error("time", cp2.Time, cp.Time)
+	}
+	cp2.Time = cp.Time
+	if !reflect.DeepEqual(cp, cp2) {
+		t.Errorf("%+v != %+v", cp2, cp)
+	}
+	if matches, _ := filepath.Glob(file + ".tmp*"); len(matches) != 0 {
+		t.Error("tmp file left:", matches)
+	}
+}
@@ -0,0 +1,146 @@
+package scan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReservedRanges 默认排除的保留地址: 本网络、环回、链路本地、文档、基准测试、组播、保留及广播地址
+var ReservedRanges = []string{
+	"0.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15",
+	"198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "100::/64", "2001:db8::/32", "fe80::/10", "ff00::/8",
+}
+
+// ip128 ip的整数形式, IPv4使用IPv6映射地址
+type ip128 struct {
+	hi, lo uint64
+}
+
+func toIp128(ip net.IP) ip128 {
+	ip16 := ip.To16()
+	return ip128{binary.BigEndian.Uint64(ip16[:8]), binary.BigEndian.Uint64(ip16[8:])}
+}
+
+func (a ip128) less(b ip128) bool {
+	return a.hi < b.hi || a.hi == b.hi && a.lo < b.lo
+}
+
+// next a+1, a为最大值时返回自身
+func (a ip128) next() ip128 {
+	if a.lo != ^uint64(0) {
+		return ip128{a.hi, a.lo + 1}
+	}
+	if a.hi != ^uint64(0) {
+		return ip128{a.hi + 1, 0}
+	}
+	return a
+}
+
+// ipInterval ip区间[start, end]
+type ipInterval struct {
+	start, end ip128
+}
+
+func (in ipInterval) contains(x ip128) bool {
+	return !x.less(in.start) && !in.end.less(x)
+}
+
+// Exclude 排除的ip, 区间排序合并后二分查找, 不展开ip范围
+type Exclude struct {
+	intervals []ipInterval
+}
+
+// ParseExclude 解析排除的ip, 格式与目标相同: CIDR、ip范围(1.1.1.1-1.1.1.2, 1.1.1.1-2)和单个ip, 支持IPv6
+// 忽略空行和#开头的注释
+func ParseExclude(specs []string) (e *Exclude, err error) {
+	e = &Exclude{}
+	for _, spec := range specs {
+		spec = strings.Trim(strings.TrimSpace(spec), "[]")
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		var in ipInterval
+		if in, err = parseIpInterval(spec); err != nil {
+			return nil, err
+		}
+		e.intervals = append(e.intervals, in)
+	}
+	sort.Slice(e.intervals, func(i, j int) bool { return e.intervals[i].start.less(e.intervals[j].start) })
+	// 合并重叠及相邻的区间
+	merged := e.intervals[:0]
+	for _, in := range e.intervals {
+		if n := len(merged); n > 0 && !merged[n-1].end.next().less(in.start) {
+			if merged[n-1].end.less(in.end) {
+				merged[n-1].end = in.end
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	e.intervals = merged
+	return
+}
+
+func parseIpInterval(spec string) (in ipInterval, err error) {
+	if _, ipNet, err2 := net.ParseCIDR(spec); err2 == nil {
+		start := ipNet.IP.To16()
+		end := make(net.IP, net.IPv6len)
+		mask := ipNet.Mask
+		if len(mask) == net.IPv4len {
+			mask = append(net.CIDRMask(96, 128)[:12], mask...)
+		}
+		for i := range end {
+			end[i] = start[i] | ^mask[i]
+		}
+		return ipInterval{toIp128(start), toIp128(end)}, nil
+	}
+	var start, end net.IP
+	if i := strings.Index(spec, "-"); i > 0 {
+		start = net.ParseIP(spec[:i])
+		if end = net.ParseIP(spec[i+1:]); end == nil && start != nil {
+			// 1.1.1.1-2, 最后一段的范围
+			var last uint64
+			if last, err = strconv.ParseUint(spec[i+1:], 10, 8); err != nil || start.To4() == nil {
+				return in, fmt.Errorf("%s is not ip range", spec)
+			}
+			end = make(net.IP, net.IPv4len)
+			copy(end, start.To4())
+			end[3] = byte(last)
+		}
+	} else {
+		start = net.ParseIP(spec)
+		end = start
+	}
+	if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+		return in, fmt.Errorf("%s is not ip/ip range", spec)
+	}
+	in = ipInterval{toIp128(start), toIp128(end)}
+	if in.end.less(in.start) {
+		return in, fmt.Errorf("%s is not ip range", spec)
+	}
+	return
+}
+
+// Len 合并后的区间数
+func (e *Exclude) Len() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.intervals)
+}
+
+// Contains ip是否被排除, e为nil时不排除任何ip
+func (e *Exclude) Contains(ip net.IP) bool {
+	if e == nil || len(e.intervals) == 0 {
+		return false
+	}
+	x := toIp128(ip)
+	// 第一个end >= x的区间
+	i := sort.Search(len(e.intervals), func(i int) bool { return !e.intervals[i].end.less(x) })
+	return i < len(e.intervals) && !x.less(e.intervals[i].start)
+}
@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseExclude(t *testing.T) {
+	e, err := ParseExclude([]string{
+		"10.0.0.0/24", "10.0.1.0-10.0.1.9", "10.0.1.10-20", "# comment", "",
+		"192.168.1.1", "[fd00::1]", "fe80::/10", "10.0.0.128/25",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10.0.0.0/24和10.0.1.0-20合并
+	if e.Len() != 4 {
+		t.Error("intervals:", e.Len())
+	}
+	for ip, want := range map[string]bool{
+		"10.0.0.0": true, "10.0.0.255": true, "10.0.1.20": true, "10.0.1.21": false, "9.255.255.255": false,
+		"192.168.1.1": true, "192.168.1.2": false, "fd00::1": true, "fd00::2": false,
+		"fe80::1": true, "febf:ffff::1": true, "fec0::": false, "::ffff:10.0.0.1": true,
+	} {
+		if got := e.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: %v != %v", ip, got, want)
+		}
+	}
+	for _, spec := range []string{"10.0.0.1-10.0.0.0", "10.0.0.1-300", "fd00::1-2", "10.0.0.1-fd00::1", "host"} {
+		if _, err = ParseExclude([]string{spec}); err == nil {
+			t.Error("invalid exclude accepted:", spec)
+		}
+	}
+	var nilExclude *Exclude
+	if nilExclude.Contains(net.ParseIP("10.0.0.1")) {
+		t.Error("nil exclude")
+	}
+}
+
+func TestReservedRanges(t *testing.T) {
+	e, err := ParseExclude(ReservedRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"127.0.0.1": true, "224.0.0.1": true, "255.255.255.255": true, "0.0.0.0": true,
+		"ff02::1": true, "::1": true, "10.0.0.1": false, "8.8.8.8": false, "2001:4860::8888": false,
+	} {
+		if got := e.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: %v != %v", ip, got, want)
+		}
+	}
+}
+
+func BenchmarkExclude_Contains(b *testing.B) {
+	specs := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		specs = append(specs, net.IPv4(10, byte(i>>8), byte(i), 0).String()+"/28")
+	}
+	e, _ := ParseExclude(specs)
+	ip := net.IPv4(10, 1, 200, 5)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e.Contains(ip)
+	}
+}
@@ -0,0 +1,106 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"sync/atomic"
+)
+
+// DefaultMaxTargets 默认的ip*端口总数上限, 可扫描一个/16的所有端口
+const DefaultMaxTargets = 1 << 32
+
+// ErrOutOfScope 目标不在授权范围内
+var ErrOutOfScope = errors.New("target out of scope")
+
+// ErrMaxTargets 扫描的目标数超出上限
+var ErrMaxTargets = errors.New("exceed the max targets")
+
+// Guard 扫描范围保护, 包装Scanner, 调用Scan前检查目标是否在授权范围内, 并限制目标总数
+type Guard struct {
+	refused uint64 // 拒绝的目标数, atomic, 放在首位保证64位对齐
+	scanned uint64 // 已扫描的目标数, atomic
+	port.Scanner
+	scope      *Scope
+	maxTargets uint64                      // 目标总数上限, 0为不限制
+	onRefuse   func(ip net.IP, dst uint16) // 拒绝目标时回调, 用于记录日志
+}
+
+// NewGuard 新建扫描范围保护, scope为nil时不限制范围
+func NewGuard(s port.Scanner, scope *Scope, maxTargets uint64, onRefuse func(ip net.IP, dst uint16)) *Guard {
+	return &Guard{Scanner: s, scope: scope, maxTargets: maxTargets, onRefuse: onRefuse}
+}
+
+// CheckTotal 检查ip数*端口数是否超出上限, 用于扫描前提前报错, Scan时仍按已扫描的目标数限制
+func (g *Guard) CheckTotal(ipNum, portNum uint64) error {
+	if g.maxTargets == 0 || portNum == 0 {
+		return nil
+	}
+	if ipNum > g.maxTargets/portNum {
+		return fmt.Errorf("%d ip * %d port exceed the max targets %d", ipNum, portNum, g.maxTargets)
+	}
+	return nil
+}
+
+// AllowIp ip是否在授权范围内, 不在时记录拒绝, 用于ping等不区分端口的探测
+func (g *Guard) AllowIp(ip net.IP) bool {
+	if g.scope.AllowIp(ip) {
+		return true
+	}
+	g.refuse(ip, 0)
+	return false
+}
+
+// Allow ip和协议的端口是否在授权范围内, 不在时记录拒绝
+func (g *Guard) Allow(ip net.IP, dst uint16, protocol string) bool {
+	if g.scope.Allow(ip, dst, protocol) {
+		return true
+	}
+	g.refuse(ip, dst)
+	return false
+}
+
+func (g *Guard) refuse(ip net.IP, dst uint16) {
+	atomic.AddUint64(&g.refused, 1)
+	if g.onRefuse != nil {
+		g.onRefuse(ip, dst)
+	}
+}
+
+// Refused 拒绝的目标数
+func (g *Guard) Refused() uint64 {
+	return atomic.LoadUint64(&g.refused)
+}
+
+// Scan 目标在授权范围内(按IpOption.Protocol)时扫描, 否则返回ErrOutOfScope; 扫描的目标数超出上限时返回ErrMaxTargets
+func (g *Guard) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error {
+	if err := g.Take(ip, dst, ipOption.Protocol); err != nil {
+		return err
+	}
+	return g.Scanner.Scan(ip, dst, ipOption)
+}
+
+// Take 检查目标并计入已扫描的目标数, 用于不经过Scanner的探测(如url模式), 返回值同Scan
+func (g *Guard) Take(ip net.IP, dst uint16, protocol string) error {
+	if !g.Allow(ip, dst, protocol) {
+		return ErrOutOfScope
+	}
+	if g.maxTargets > 0 && atomic.AddUint64(&g.scanned, 1) > g.maxTargets {
+		return ErrMaxTargets
+	}
+	return nil
+}
+
+// Scanned 已扫描的目标数
+func (g *Guard) Scanned() uint64 {
+	return atomic.LoadUint64(&g.scanned)
+}
+
+// Pending 被包装的Scanner未完成的探测
+func (g *Guard) Pending() []port.OpenIpPort {
+	if ps, ok := g.Scanner.(port.PendingScanner); ok {
+		return ps.Pending()
+	}
+	return nil
+}
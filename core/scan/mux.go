@@ -0,0 +1,84 @@
+package scan
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"sync"
+)
+
+// Mux 混合扫描器, 按IpOption.Protocol将目标分发到对应协议的扫描器, 用于TCP和UDP混合扫描
+// 其它扫描器的结果转发到主扫描器的结果chan
+type Mux struct {
+	primary   string
+	scanners  map[string]port.Scanner
+	secondary []port.Scanner
+	forwardWg sync.WaitGroup
+}
+
+// NewMux 新建混合扫描器, protocol为主扫描器的协议, 也是IpOption.Protocol为空时的协议
+func NewMux(protocol string, primary port.Scanner) *Mux {
+	return &Mux{
+		primary:  protocol,
+		scanners: map[string]port.Scanner{protocol: primary},
+	}
+}
+
+// Add 添加协议的扫描器, 其结果chan ret转发到主扫描器的结果chan out
+func (m *Mux) Add(protocol string, s port.Scanner, ret <-chan port.OpenIpPort, out chan<- port.OpenIpPort) {
+	m.scanners[protocol] = s
+	m.secondary = append(m.secondary, s)
+	m.forwardWg.Add(1)
+	go func() {
+		defer m.forwardWg.Done()
+		for openIpPort := range ret {
+			out <- openIpPort
+		}
+	}()
+}
+
+// Scan 使用协议对应的扫描器扫描, 并等待该扫描器的速率限制
+func (m *Mux) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error {
+	protocol := ipOption.Protocol
+	if protocol == "" {
+		protocol = m.primary
+	}
+	s, ok := m.scanners[protocol]
+	if !ok {
+		return fmt.Errorf("no %s scanner", protocol)
+	}
+	if err := s.WaitLimiter(); err != nil {
+		return err
+	}
+	return s.Scan(ip, dst, ipOption)
+}
+
+// WaitLimiter 各扫描器的速率限制不同, 在Scan中等待
+func (m *Mux) WaitLimiter() error {
+	return nil
+}
+
+func (m *Mux) Wait() {
+	for _, s := range m.scanners {
+		s.Wait()
+	}
+}
+
+// Close 先关闭其它扫描器并完成结果转发, 最后关闭主扫描器
+func (m *Mux) Close() {
+	for _, s := range m.secondary {
+		s.Close()
+	}
+	m.forwardWg.Wait()
+	m.scanners[m.primary].Close()
+}
+
+// Pending 各扫描器未完成的探测
+func (m *Mux) Pending() (ret []port.OpenIpPort) {
+	for _, s := range m.scanners {
+		if ps, ok := s.(port.PendingScanner); ok {
+			ret = append(ret, ps.Pending()...)
+		}
+	}
+	return
+}
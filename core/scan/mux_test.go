@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"testing"
+)
+
+// chanScanner 将目标作为结果输出
+type chanScanner struct {
+	port.Scanner
+	protocol string
+	ret      chan port.OpenIpPort
+}
+
+func (s *chanScanner) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error {
+	s.ret <- port.OpenIpPort{Ip: ip, Port: dst, Protocol: s.protocol}
+	return nil
+}
+
+func (s *chanScanner) WaitLimiter() error { return nil }
+func (s *chanScanner) Wait()              {}
+func (s *chanScanner) Close()             { close(s.ret) }
+
+func TestMux(t *testing.T) {
+	retChan := make(chan port.OpenIpPort, 10)
+	udpRet := make(chan port.OpenIpPort, 10)
+	m := NewMux(port.ProtocolTcp, &chanScanner{ret: retChan})
+	m.Add(port.ProtocolUdp, &chanScanner{protocol: "udp", ret: udpRet}, udpRet, retChan)
+	ip := net.IPv4(10, 0, 0, 1)
+	m.Scan(ip, 80, port.IpOption{})
+	m.Scan(ip, 53, port.IpOption{Protocol: port.ProtocolUdp})
+	if err := m.Scan(ip, 2905, port.IpOption{Protocol: port.ProtocolSctp}); err == nil {
+		t.Error("no sctp scanner")
+	}
+	m.Wait()
+	m.Close() // 转发完UDP结果后关闭retChan
+	got := make(map[string]bool)
+	for op := range retChan {
+		got[op.String()] = true
+	}
+	if len(got) != 2 || !got["10.0.0.1:80"] || !got["10.0.0.1:53/udp"] {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,67 @@
+package scan
+
+// feistel轮数
+const feistelRounds = 6
+
+// Permutation [0, size)上的伪随机置换, 基于Feistel网络和cycle-walking, 内存占用O(1), ref masscan blackrock
+// 相同的size和seed得到相同的顺序
+type Permutation struct {
+	size     uint64
+	halfBits uint   // Feistel左右两半的位数
+	halfMask uint64 //
+	keys     [feistelRounds]uint64
+}
+
+// NewPermutation 新建[0, size)上的置换
+func NewPermutation(size uint64, seed int64) *Permutation {
+	// 取覆盖size的最小偶数位宽, 置换域不超过4倍size, cycle-walking平均不超过4次
+	var bits uint
+	for bits < 64 && uint64(1)<<bits < size {
+		bits++
+	}
+	if bits%2 == 1 {
+		bits++
+	}
+	p := &Permutation{
+		size:     size,
+		halfBits: bits / 2,
+		halfMask: uint64(1)<<(bits/2) - 1,
+	}
+	x := uint64(seed)
+	for i := range p.keys {
+		x += 0x9e3779b97f4a7c15
+		p.keys[i] = mix64(x)
+	}
+	return p
+}
+
+// Size 置换的元素个数
+func (p *Permutation) Size() uint64 {
+	return p.size
+}
+
+// Shuffle 返回第index个元素, index需小于size
+func (p *Permutation) Shuffle(index uint64) uint64 {
+	for {
+		index = p.encrypt(index)
+		if index < p.size {
+			return index
+		}
+	}
+}
+
+// encrypt [0, 2^(2*halfBits))上的Feistel置换
+func (p *Permutation) encrypt(x uint64) uint64 {
+	l, r := x>>p.halfBits, x&p.halfMask
+	for _, key := range p.keys {
+		l, r = r, l^(mix64(r^key)&p.halfMask)
+	}
+	return l<<p.halfBits | r
+}
+
+// mix64 splitmix64的混淆函数
+func mix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"testing"
+)
+
+func TestPermutation_Shuffle(t *testing.T) {
+	for _, size := range []uint64{1, 2, 3, 100, 1000, 65537} {
+		p := NewPermutation(size, 1)
+		seen := make([]bool, size)
+		var fixed uint64
+		for i := uint64(0); i < size; i++ {
+			v := p.Shuffle(i)
+			if v >= size || seen[v] {
+				t.Fatalf("size %d: index %d -> %d duplicate or out of range", size, i, v)
+			}
+			seen[v] = true
+			if v == i {
+				fixed++
+			}
+		}
+		if size >= 1000 && fixed > size/100 {
+			t.Errorf("size %d: %d fixed points, not shuffled", size, fixed)
+		}
+	}
+
+	// 相同seed顺序相同, 不同seed顺序不同
+	p1, p2, p3 := NewPermutation(1000, 42), NewPermutation(1000, 42), NewPermutation(1000, 43)
+	var same, diff bool
+	for i := uint64(0); i < 1000; i++ {
+		if p1.Shuffle(i) != p2.Shuffle(i) {
+			same = true
+		}
+		if p1.Shuffle(i) != p3.Shuffle(i) {
+			diff = true
+		}
+	}
+	if same || !diff {
+		t.Error("seed not reproducible")
+	}
+}
+
+func BenchmarkPermutation_Shuffle(b *testing.B) {
+	p := NewPermutation(1<<24*1000, 1)
+	for i := 0; i < b.N; i++ {
+		p.Shuffle(uint64(i))
+	}
+}
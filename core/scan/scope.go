@@ -0,0 +1,98 @@
+package scan
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/XinRoom/go-portScan/util"
+	"net"
+	"strings"
+)
+
+// scopeEntry 授权的ip范围及各协议的端口, ports为nil时为所有协议的所有端口, key为空字符串的端口为所有协议
+type scopeEntry struct {
+	ips   ipInterval
+	ports map[string][][]uint16
+}
+
+// Scope 授权扫描范围
+type Scope struct {
+	entries []scopeEntry
+}
+
+// ParseScope 解析授权范围, 每行为"ip范围 [端口]", ip范围格式与目标相同, 端口为空或"-"时为所有端口
+// 端口可带协议前缀(T:80,U:53), 只授权该协议, 没有前缀时为所有协议; 忽略空行和#开头的注释, eg:
+//
+//	10.0.0.0/8
+//	192.168.1.1-192.168.1.20 22,80,443,8000-9000
+//	192.168.2.1 T:80,443,U:53,161
+//	fd00::/64 1-1024
+func ParseScope(lines []string) (s *Scope, err error) {
+	s = &Scope{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("scope line %q: want \"ip [ports]\"", line)
+		}
+		var e scopeEntry
+		if e.ips, err = parseIpInterval(strings.Trim(fields[0], "[]")); err != nil {
+			return nil, err
+		}
+		if len(fields) == 2 && fields[1] != "-" {
+			if strings.Contains(strings.ToLower(fields[1]), "top") {
+				return nil, fmt.Errorf("scope line %q: ports must be explicit", line)
+			}
+			if e.ports, err = port.ParseProtocolPortRanges(fields[1]); err != nil {
+				return nil, fmt.Errorf("scope line %q: %s", line, err)
+			}
+		}
+		s.entries = append(s.entries, e)
+	}
+	if len(s.entries) == 0 {
+		return nil, fmt.Errorf("scope is empty")
+	}
+	return
+}
+
+// LoadScope 读取授权范围文件
+func LoadScope(file string) (*Scope, error) {
+	lines, err := util.GetLines(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScope(lines)
+}
+
+// AllowIp ip是否在授权范围内(任意端口), s为nil时不限制
+func (s *Scope) AllowIp(ip net.IP) bool {
+	if s == nil {
+		return true
+	}
+	x := toIp128(ip)
+	for _, e := range s.entries {
+		if e.ips.contains(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow ip和协议的端口是否在授权范围内, protocol为空时为tcp, s为nil时不限制
+func (s *Scope) Allow(ip net.IP, dst uint16, protocol string) bool {
+	if s == nil {
+		return true
+	}
+	if protocol == "" {
+		protocol = port.ProtocolTcp
+	}
+	x := toIp128(ip)
+	for _, e := range s.entries {
+		if e.ips.contains(x) && (e.ports == nil || port.IsInPortRange(dst, e.ports[""]) || port.IsInPortRange(dst, e.ports[protocol])) {
+			return true
+		}
+	}
+	return false
+}
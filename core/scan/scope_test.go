@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	scope, err := ParseScope([]string{
+		"# rules of engagement",
+		"10.0.0.0/8",
+		"192.168.1.1-192.168.1.20 22,80,8000-9000",
+		"[fd00::1] -",
+		"172.16.0.1 T:80,U:53,161",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		ip       string
+		port     uint16
+		protocol string
+		allow    bool
+	}{
+		{"10.1.2.3", 65535, "", true},
+		{"1.0.0.1", 80, "", false},
+		{"192.168.1.5", 8080, port.ProtocolUdp, true},
+		{"192.168.1.5", 443, "", false},
+		{"192.168.1.21", 80, "", false},
+		{"fd00::1", 1, port.ProtocolSctp, true},
+		{"fd00::2", 1, "", false},
+		// 带协议前缀的端口只授权该协议
+		{"172.16.0.1", 80, port.ProtocolTcp, true},
+		{"172.16.0.1", 80, port.ProtocolUdp, false},
+		{"172.16.0.1", 161, port.ProtocolUdp, true},
+		{"172.16.0.1", 53, port.ProtocolSctp, false},
+	} {
+		if got := scope.Allow(net.ParseIP(c.ip), c.port, c.protocol); got != c.allow {
+			t.Errorf("%s:%d/%s: %v != %v", c.ip, c.port, c.protocol, got, c.allow)
+		}
+	}
+	if !scope.AllowIp(net.ParseIP("192.168.1.5")) || scope.AllowIp(net.ParseIP("1.0.0.1")) {
+		t.Error("AllowIp")
+	}
+	for _, lines := range [][]string{{}, {"# only comment"}, {"10.0.0.0/8 top1000"}, {"10.0.0.0/8 top100"}, {"10.0.0.0/8 80-"}, {"10.0.0.0/8 80 443"}, {"host 80"}, {"10.0.0.1 a"}} {
+		if _, err = ParseScope(lines); err == nil {
+			t.Error("invalid scope accepted:", lines)
+		}
+	}
+}
+
+type countScanner struct {
+	port.Scanner
+	scanned int
+}
+
+func (s *countScanner) Scan(ip net.IP, dst uint16, ipOption port.IpOption) error {
+	s.scanned++
+	return nil
+}
+
+func TestGuard(t *testing.T) {
+	scope, _ := ParseScope([]string{"10.0.0.0/24 80"})
+	inner := &countScanner{}
+	var refused []string
+	g := NewGuard(inner, scope, 1000, func(ip net.IP, dst uint16) {
+		refused = append(refused, ip.String())
+	})
+	if err := g.Scan(net.IPv4(10, 0, 0, 1), 80, port.IpOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Scan(net.IPv4(10, 0, 0, 1), 443, port.IpOption{}); err != ErrOutOfScope {
+		t.Fatal(err)
+	}
+	if err := g.Scan(net.IPv4(1, 0, 0, 1), 80, port.IpOption{}); err != ErrOutOfScope {
+		t.Fatal(err)
+	}
+	if inner.scanned != 1 || g.Refused() != 2 || len(refused) != 2 {
+		t.Error(inner.scanned, g.Refused(), refused)
+	}
+	if g.CheckTotal(10, 100) != nil || g.CheckTotal(11, 100) == nil || g.CheckTotal(1<<40, 1<<40) == nil {
+		t.Error("CheckTotal")
+	}
+	if NewGuard(inner, nil, 0, nil).CheckTotal(1<<40, 1<<40) != nil {
+		t.Error("CheckTotal no limit")
+	}
+
+	// 不调用CheckTotal时Scan仍限制目标数
+	inner = &countScanner{}
+	g = NewGuard(inner, nil, 3, nil)
+	for i := 0; i < 5; i++ {
+		err := g.Scan(net.IPv4(10, 0, 0, byte(i)), 80, port.IpOption{})
+		if (i < 3 && err != nil) || (i >= 3 && err != ErrMaxTargets) {
+			t.Errorf("scan %d: %v", i, err)
+		}
+	}
+	if inner.scanned != 3 {
+		t.Errorf("scanned %d, want 3", inner.scanned)
+	}
+
+	// Take计入目标数, 不调用Scanner
+	g = NewGuard(nil, scope, 1, nil)
+	if g.Take(net.IPv4(10, 0, 0, 1), 443, "") != ErrOutOfScope || g.Take(net.IPv4(10, 0, 0, 1), 80, "") != nil ||
+		g.Take(net.IPv4(10, 0, 0, 2), 80, "") != ErrMaxTargets || g.Scanned() != 2 {
+		t.Error("Take", g.Scanned())
+	}
+}
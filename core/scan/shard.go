@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shard 分片, 共Count个分片中的第Index个(从1开始)
+// 使用相同seed的各分片按置换序号取模分配目标, 合起来恰好覆盖所有目标一次
+type Shard struct {
+	Index uint64
+	Count uint64
+}
+
+// NoShard 不分片
+var NoShard = Shard{Index: 1, Count: 1}
+
+// ParseShard 解析分片, eg: "1/3"
+func ParseShard(s string) (shard Shard, err error) {
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return shard, errors.New("shard format is i/N, eg: 1/3")
+	}
+	if shard.Index, err = strconv.ParseUint(s[:i], 10, 64); err != nil {
+		return
+	}
+	if shard.Count, err = strconv.ParseUint(s[i+1:], 10, 64); err != nil {
+		return
+	}
+	if shard.Count == 0 || shard.Index == 0 || shard.Index > shard.Count {
+		return shard, fmt.Errorf("shard %s out of range", s)
+	}
+	return
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// IsSharded 是否分片
+func (s Shard) IsSharded() bool {
+	return s.Count > 1
+}
+
+// Start 分片的第一个置换序号, 之后每次加Count
+func (s Shard) Start() uint64 {
+	return s.Index - 1
+}
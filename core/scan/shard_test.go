@@ -0,0 +1,41 @@
+package scan
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	shard, err := ParseShard("2/3")
+	if err != nil || shard.Index != 2 || shard.Count != 3 || shard.Start() != 1 || shard.String() != "2/3" {
+		t.Fatal(shard, err)
+	}
+	for _, s := range []string{"", "3", "0/3", "4/3", "1/0", "a/3"} {
+		if _, err = ParseShard(s); err == nil {
+			t.Error("invalid shard accepted:", s)
+		}
+	}
+}
+
+func TestShard_cover(t *testing.T) {
+	ips := IpList{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), net.IPv4(10, 0, 0, 3)}
+	ports := port.PortList{Tcp: []uint16{22, 80, 443, 3389, 8080}}
+	seen := make(map[uint64]int)
+	for index := uint64(1); index <= 4; index++ {
+		shard := Shard{Index: index, Count: 4}
+		targets, _ := NewTargets(ips, ports, 99)
+		for i := shard.Start(); i < targets.Total(); i += shard.Count {
+			ip, _port, _ := targets.Get(i)
+			seen[uint64(ip[len(ip)-1])<<16|uint64(_port)]++
+		}
+	}
+	if len(seen) != len(ips)*ports.Len() {
+		t.Fatal("not all targets covered:", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Error("target scanned more than once:", k, n)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 首批目标的行数, 之后逐批加倍直到BatchSize, 使扫描尽快开始
+const firstBatchSize = 1024
+
+// TargetBatch 一批目标, 按行顺序排列
+type TargetBatch struct {
+	Index  uint64    // 批次序号, 从0开始
+	Ranges []IpRange // 解析成功的行
+}
+
+// TargetStream 逐行读取目标, 按批并发解析(域名解析等), 不一次性读入所有目标
+// 批次的划分只与行数有关, 相同输入的批次相同, 用于分片和恢复扫描
+type TargetStream struct {
+	BatchSize int                                // 每批最大行数
+	Workers   int                                // 并发解析数
+	Skip      uint64                             // 跳过的批数, 不解析, 用于恢复扫描
+	Parse     func(line string) (IpRange, error) // 解析一行目标, 可能阻塞(如域名解析)
+	OnError   func(line string, err error)       // 解析失败的行被跳过, line为空时为读取错误
+}
+
+// batchSize 第index批的行数
+func (ts *TargetStream) batchSize(index uint64) int {
+	size := firstBatchSize
+	for i := uint64(0); i < index && size < ts.BatchSize; i++ {
+		size *= 2
+	}
+	if size > ts.BatchSize {
+		size = ts.BatchSize
+	}
+	return size
+}
+
+// Run 开始读取, 返回的chan按批次顺序输出, 读完后关闭; 下一批在当前批扫描时解析
+func (ts *TargetStream) Run(r io.Reader) <-chan *TargetBatch {
+	ch := make(chan *TargetBatch, 1)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for index := uint64(0); ; index++ {
+			lines := make([]string, 0, ts.batchSize(index))
+			for len(lines) < cap(lines) && scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) == 0 {
+				break
+			}
+			if index < ts.Skip {
+				continue
+			}
+			ch <- &TargetBatch{Index: index, Ranges: ts.parse(lines)}
+		}
+		if err := scanner.Err(); err != nil && ts.OnError != nil {
+			ts.OnError("", err)
+		}
+	}()
+	return ch
+}
+
+// parse 并发解析一批目标, 保持行顺序
+func (ts *TargetStream) parse(lines []string) (ranges []IpRange) {
+	parsed := make([]IpRange, len(lines))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < ts.Workers || w == 0; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(lines) {
+					return
+				}
+				ir, err := ts.Parse(lines[i])
+				if err != nil {
+					if ts.OnError != nil {
+						ts.OnError(lines[i], err)
+					}
+					continue
+				}
+				parsed[i] = ir
+			}
+		}()
+	}
+	wg.Wait()
+	for _, ir := range parsed {
+		if ir != nil {
+			ranges = append(ranges, ir)
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTargetStream(t *testing.T) {
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("10.0.%d.%d", i>>8, i&0xff))
+		if i%1000 == 0 {
+			lines = append(lines, "", "bad host") // 空行跳过, 解析失败的行跳过
+		}
+	}
+	var errLock sync.Mutex
+	var errLines []string
+	newStream := func(skip uint64) *TargetStream {
+		return &TargetStream{
+			BatchSize: 2048,
+			Workers:   16,
+			Skip:      skip,
+			Parse: func(line string) (IpRange, error) {
+				ip := net.ParseIP(line)
+				if ip == nil {
+					return nil, errors.New("not ip")
+				}
+				time.Sleep(time.Duration(ip[15]%3) * time.Microsecond) // 乱序完成
+				return IpList{ip}, nil
+			},
+			OnError: func(line string, err error) {
+				errLock.Lock()
+				errLines = append(errLines, line)
+				errLock.Unlock()
+			},
+		}
+	}
+
+	var got []string
+	var sizes []int
+	for batch := range newStream(0).Run(strings.NewReader(strings.Join(lines, "\n"))) {
+		if batch.Index != uint64(len(sizes)) {
+			t.Fatal("batch index", batch.Index)
+		}
+		sizes = append(sizes, len(batch.Ranges))
+		for _, ir := range batch.Ranges {
+			got = append(got, ir.GetIpByIndex(0).String())
+		}
+	}
+	if len(got) != 5000 || len(errLines) != 5 {
+		t.Fatal(len(got), len(errLines))
+	}
+	for i, ip := range got {
+		if want := fmt.Sprintf("10.0.%d.%d", i>>8, i&0xff); ip != want {
+			t.Fatalf("order: %d %s != %s", i, ip, want)
+		}
+	}
+	// 1024, 2048, 2048行, 其中每批有解析失败的行
+	if fmt.Sprint(sizes) != "[1022 2046 1932]" {
+		t.Error("batch sizes", sizes)
+	}
+
+	// 跳过已扫描的批次
+	var first *TargetBatch
+	for batch := range newStream(2).Run(strings.NewReader(strings.Join(lines, "\n"))) {
+		if first == nil {
+			first = batch
+		}
+	}
+	if first == nil || first.Index != 2 || first.Ranges[0].GetIpByIndex(0).String() != got[1022+2046] {
+		t.Error("skip", first)
+	}
+}
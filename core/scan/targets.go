@@ -0,0 +1,163 @@
+package scan
+
+import (
+	"errors"
+	"github.com/XinRoom/go-portScan/core/port"
+	"math"
+	"net"
+	"sort"
+)
+
+// IpRange ip范围, iprange.Iter实现了该接口
+type IpRange interface {
+	TotalNum() uint64
+	GetIpByIndex(index uint64) net.IP
+}
+
+// IpRanges 将多个ip范围按顺序拼接为一个
+type IpRanges struct {
+	ranges []IpRange
+	sums   []uint64 // 累计ip数
+}
+
+// NewIpRanges 拼接ip范围, ip总数超出uint64时返回错误
+func NewIpRanges(ranges ...IpRange) (*IpRanges, error) {
+	r := &IpRanges{ranges: ranges, sums: make([]uint64, len(ranges))}
+	var total uint64
+	for i, ir := range ranges {
+		if ir.TotalNum() > math.MaxUint64-total {
+			return nil, errors.New("too many ips")
+		}
+		total += ir.TotalNum()
+		r.sums[i] = total
+	}
+	return r, nil
+}
+
+func (r *IpRanges) TotalNum() uint64 {
+	if len(r.sums) == 0 {
+		return 0
+	}
+	return r.sums[len(r.sums)-1]
+}
+
+// GetIpByIndex 获取第index个ip, 与iprange.Iter相同, 返回值没有复制
+func (r *IpRanges) GetIpByIndex(index uint64) net.IP {
+	i := sort.Search(len(r.sums), func(i int) bool { return r.sums[i] > index })
+	if i > 0 {
+		index -= r.sums[i-1]
+	}
+	return r.ranges[i].GetIpByIndex(index)
+}
+
+// IpList ip列表
+type IpList []net.IP
+
+func (l IpList) TotalNum() uint64 {
+	return uint64(len(l))
+}
+
+func (l IpList) GetIpByIndex(index uint64) net.IP {
+	return l[index]
+}
+
+// HostIps 域名及其解析得到的ip, 扫描结果中保留域名
+type HostIps struct {
+	Host string
+	Ips  IpList
+}
+
+func (h *HostIps) TotalNum() uint64 {
+	return h.Ips.TotalNum()
+}
+
+func (h *HostIps) GetIpByIndex(index uint64) net.IP {
+	return h.Ips.GetIpByIndex(index)
+}
+
+// Hosts ip对应的域名
+type Hosts map[string][]string
+
+// Get ip对应的域名, 不是域名解析得到的ip时为nil
+func (h Hosts) Get(ip net.IP) []string {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[ip.String()]
+}
+
+// MergeHosts 合并解析到相同ip的域名, 每个ip只扫描一次, 开放端口按各域名分别探测
+// 返回去重后的目标(保持顺序)及ip对应的域名
+func MergeHosts(ranges []IpRange) (merged []IpRange, hosts Hosts) {
+	hosts = make(Hosts)
+	for _, ir := range ranges {
+		h, ok := ir.(*HostIps)
+		if !ok {
+			merged = append(merged, ir)
+			continue
+		}
+		var ips IpList
+		for _, ip := range h.Ips {
+			ipStr := ip.String()
+			names, seen := hosts[ipStr]
+			if !seen {
+				ips = append(ips, ip)
+			}
+			if !containsString(names, h.Host) {
+				hosts[ipStr] = append(names, h.Host)
+			}
+		}
+		if len(ips) > 0 {
+			merged = append(merged, ips)
+		}
+	}
+	return
+}
+
+func containsString(list []string, s string) bool {
+	for _, s2 := range list {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Targets ip与端口的笛卡尔积, 按全局置换顺序遍历(ip, port), 各ip的端口不再集中发送
+type Targets struct {
+	ips   IpRange
+	ports port.PortList
+	perm  *Permutation
+}
+
+// NewTargets 新建扫描目标, seed相同时遍历顺序相同
+func NewTargets(ips IpRange, ports port.PortList, seed int64) (*Targets, error) {
+	ipNum := ips.TotalNum()
+	if ipNum == 0 || ports.Len() == 0 {
+		return nil, errors.New("no ip or port")
+	}
+	if ipNum > math.MaxUint64/uint64(ports.Len()) {
+		return nil, errors.New("too many ip*port")
+	}
+	return &Targets{
+		ips:   ips,
+		ports: ports,
+		perm:  NewPermutation(ipNum*uint64(ports.Len()), seed),
+	}, nil
+}
+
+// Total 目标总数
+func (t *Targets) Total() uint64 {
+	return t.perm.Size()
+}
+
+// Get 获取置换后第index个目标及端口的协议, index需小于Total, 返回的ip为副本
+func (t *Targets) Get(index uint64) (ip net.IP, _port uint16, protocol string) {
+	i := t.perm.Shuffle(index)
+	ipNum := t.ips.TotalNum()
+	_ip := t.ips.GetIpByIndex(i % ipNum)
+	ip = make(net.IP, len(_ip))
+	copy(ip, _ip)
+	_port, protocol = t.ports.Get(int(i / ipNum))
+	return
+}
@@ -0,0 +1,73 @@
+package scan
+
+import (
+	"fmt"
+	"github.com/XinRoom/go-portScan/core/port"
+	"net"
+	"testing"
+)
+
+func TestTargets_Get(t *testing.T) {
+	ips, err := NewIpRanges(IpList{net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4()}, IpList{net.ParseIP("fd00::1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips.TotalNum() != 3 || ips.GetIpByIndex(1).String() != "10.0.0.2" || ips.GetIpByIndex(2).String() != "fd00::1" {
+		t.Fatal("ip ranges:", ips.TotalNum(), ips.GetIpByIndex(1), ips.GetIpByIndex(2))
+	}
+
+	ports := port.PortList{Tcp: []uint16{22, 80, 443}, Udp: []uint16{53}}
+	targets, err := NewTargets(ips, ports, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets.Total() != 12 {
+		t.Fatal("total:", targets.Total())
+	}
+	seen := make(map[string]bool)
+	var order []string
+	for i := uint64(0); i < targets.Total(); i++ {
+		ip, _port, protocol := targets.Get(i)
+		key := fmt.Sprintf("%s:%d/%s", ip, _port, protocol)
+		if seen[key] {
+			t.Fatal("duplicate:", key)
+		}
+		seen[key] = true
+		order = append(order, key)
+	}
+	if len(seen) != 12 {
+		t.Error("not all targets:", seen)
+	}
+
+	// 相同seed顺序相同
+	targets2, _ := NewTargets(ips, ports, 1)
+	for i := uint64(0); i < targets2.Total(); i++ {
+		if ip, _port, protocol := targets2.Get(i); fmt.Sprintf("%s:%d/%s", ip, _port, protocol) != order[i] {
+			t.Fatal("order not reproducible")
+		}
+	}
+
+	if _, err = NewTargets(IpList{}, ports, 1); err == nil {
+		t.Error("empty ips accepted")
+	}
+}
+
+func TestMergeHosts(t *testing.T) {
+	ip1, ip2, ip3 := net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4(), net.ParseIP("fd00::1")
+	merged, hosts := MergeHosts([]IpRange{
+		&HostIps{Host: "a.example.com", Ips: IpList{ip1, ip3}},
+		IpList{ip2},
+		&HostIps{Host: "b.example.com", Ips: IpList{ip1}},
+		&HostIps{Host: "a.example.com", Ips: IpList{ip3}},
+	})
+	// 重复的ip只扫描一次, 其它目标保持原样
+	if len(merged) != 2 || merged[0].TotalNum() != 2 || merged[1].GetIpByIndex(0).String() != "10.0.0.2" {
+		t.Fatal(merged)
+	}
+	if fmt.Sprint(hosts.Get(ip1)) != "[a.example.com b.example.com]" || fmt.Sprint(hosts.Get(ip3)) != "[a.example.com]" || hosts.Get(ip2) != nil {
+		t.Error(hosts)
+	}
+	if Hosts(nil).Get(ip1) != nil {
+		t.Error("nil hosts")
+	}
+}
@@ -0,0 +1,53 @@
+package scan
+
+import "net"
+
+// IpWindows 按置换顺序将一批目标的ip分为每组size个的窗口, 窗口内的ip存活探测后按(ip, port)置换顺序扫描
+// 存活探测和端口扫描可以按窗口并行, 内存占用只与窗口大小有关; 分片时只包含本分片的ip
+type IpWindows struct {
+	ips   IpRange
+	perm  *Permutation
+	shard Shard
+	size  uint64
+	total uint64 // 本分片的ip数
+}
+
+// NewIpWindows 新建窗口, seed相同时各窗口的ip相同
+func NewIpWindows(ips IpRange, seed int64, shard Shard, size uint64) *IpWindows {
+	if size == 0 {
+		size = 1
+	}
+	w := &IpWindows{ips: ips, perm: NewPermutation(ips.TotalNum(), seed), shard: shard, size: size}
+	if n := ips.TotalNum(); n > shard.Start() {
+		w.total = (n-shard.Start()-1)/shard.Count + 1
+	}
+	return w
+}
+
+// Count 窗口数
+func (w *IpWindows) Count() uint64 {
+	return (w.total + w.size - 1) / w.size
+}
+
+// Get 第k个窗口的ip, 返回值为副本, skip返回true的ip(排除、不在授权范围内)不包含在内
+func (w *IpWindows) Get(k uint64, skip func(ip net.IP) bool) (ips IpList) {
+	end := (k + 1) * w.size
+	if end > w.total {
+		end = w.total
+	}
+	for m := k * w.size; m < end; m++ {
+		ip := w.ips.GetIpByIndex(w.perm.Shuffle(w.shard.Start() + m*w.shard.Count))
+		if skip != nil && skip(ip) {
+			continue
+		}
+		_ip := make(net.IP, len(ip))
+		copy(_ip, ip) // Note: GetIpByIndex not to do dup copy
+		ips = append(ips, _ip)
+	}
+	return
+}
+
+// WindowSeed 批次中窗口的(ip, port)置换种子, 各批次各窗口使用不同的置换
+func WindowSeed(seed int64, batch, window uint64) int64 {
+	return int64(mix64(uint64(seed) ^ mix64(batch<<32|window&0xffffffff) ^ window>>32))
+}
@@ -0,0 +1,95 @@
+package scan
+
+import (
+	"github.com/XinRoom/go-portScan/core/port"
+	"github.com/XinRoom/iprange"
+	"net"
+	"testing"
+)
+
+func TestIpWindows(t *testing.T) {
+	it, _, _ := iprange.NewIter("10.0.0.0/24")
+	seen := make(map[string]int)
+	for index := uint64(1); index <= 3; index++ {
+		w := NewIpWindows(it, 7, Shard{Index: index, Count: 3}, 20)
+		var n int
+		for k := uint64(0); k < w.Count(); k++ {
+			ips := w.Get(k, nil)
+			if len(ips) == 0 || len(ips) > 20 {
+				t.Fatalf("shard %d window %d: %d ips", index, k, len(ips))
+			}
+			for _, ip := range ips {
+				seen[ip.String()]++
+			}
+			n += len(ips)
+		}
+		if want := []int{86, 85, 85}[index-1]; n != want {
+			t.Errorf("shard %d: %d ips, want %d", index, n, want)
+		}
+	}
+	if len(seen) != 256 {
+		t.Fatal("not all ips covered:", len(seen))
+	}
+	for ip, n := range seen {
+		if n != 1 {
+			t.Error("ip in more than one window:", ip, n)
+		}
+	}
+
+	// 相同seed的窗口相同, 跳过的ip不包含在窗口内
+	w1, w2 := NewIpWindows(it, 7, NoShard, 20), NewIpWindows(it, 7, NoShard, 20)
+	ips1 := w1.Get(3, nil)
+	ips2 := w2.Get(3, func(ip net.IP) bool { return ip.Equal(ips1[0]) })
+	if len(ips2) != len(ips1)-1 || !ips2[0].Equal(ips1[1]) {
+		t.Errorf("skip: %v, %v", ips1, ips2)
+	}
+	if w := NewIpWindows(IpList{}, 7, Shard{Index: 2, Count: 3}, 20); w.Count() != 0 {
+		t.Error("empty windows:", w.Count())
+	}
+	if WindowSeed(1, 0, 1) == WindowSeed(1, 1, 0) || WindowSeed(1, 0, 0) != WindowSeed(1, 0, 0) {
+		t.Error("window seed")
+	}
+}
+
+// 扫描顺序只在窗口内随机: 各窗口的目标依次扫描, 合起来恰好覆盖所有(ip, port)一次
+func TestIpWindowsOrder(t *testing.T) {
+	it, _, _ := iprange.NewIter("10.0.0.0/26")
+	ports := port.PortList{Tcp: []uint16{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}}
+	w := NewIpWindows(it, 3, NoShard, 16)
+	seen := make(map[Target]bool)
+	var sameIp int
+	for k := uint64(0); k < w.Count(); k++ {
+		ips := w.Get(k, nil)
+		inWindow := make(map[string]bool)
+		for _, ip := range ips {
+			inWindow[ip.String()] = true
+		}
+		targets, err := NewTargets(ips, ports, WindowSeed(3, 0, k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lastIp net.IP
+		for index := uint64(0); index < targets.Total(); index++ {
+			ip, _port, protocol := targets.Get(index)
+			if !inWindow[ip.String()] {
+				t.Fatalf("window %d: %s is not in the window", k, ip)
+			}
+			target := Target{Ip: ip.String(), Port: _port, Protocol: protocol}
+			if seen[target] {
+				t.Fatal("dup target:", target)
+			}
+			seen[target] = true
+			if ip.Equal(lastIp) {
+				sameIp++
+			}
+			lastIp = ip
+		}
+	}
+	if len(seen) != 64*16 {
+		t.Fatal("not all targets covered:", len(seen))
+	}
+	// 窗口内的ip和端口交错, 不是逐个ip扫描所有端口
+	if sameIp > 64*16/4 {
+		t.Error("targets of an ip are not spread:", sameIp)
+	}
+}
@@ -13,6 +13,7 @@ require (
 	github.com/twmb/murmur3 v1.1.8
 	github.com/urfave/cli/v2 v2.27.5
 	golang.org/x/net v0.33.0
+	golang.org/x/sys v0.29.0
 	golang.org/x/text v0.21.0
 	golang.org/x/time v0.9.0
 )
@@ -31,6 +32,5 @@ require (
 	github.com/stretchr/testify v1.10.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20240521201337-686a1a2994c1 // indirect
 	golang.org/x/sync v0.10.0 // indirect
-	golang.org/x/sys v0.29.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -3,11 +3,13 @@ package httputil
 import (
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"errors"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,15 +17,35 @@ var ErrOverflow = errors.New("OverflowMax")
 
 var DefHttpClient *http.Client
 
+type dialIpKey struct{}
+
+type dialIp struct {
+	host string
+	ip   net.IP
+}
+
+// WithDialIp 请求host时直接连接ip, 不再解析域名, Host头和TLS SNI仍为host
+func WithDialIp(ctx context.Context, host string, ip net.IP) context.Context {
+	return context.WithValue(ctx, dialIpKey{}, dialIp{host: host, ip: ip})
+}
+
 func NewHttpClient(dialTimeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+	}
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 			MinVersion:         tls.VersionTLS10,
 		},
-		DialContext: (&net.Dialer{
-			Timeout: dialTimeout,
-		}).DialContext,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if d, ok := ctx.Value(dialIpKey{}).(dialIp); ok {
+				if host, port, err := net.SplitHostPort(addr); err == nil && strings.EqualFold(host, d.host) {
+					addr = net.JoinHostPort(d.ip.String(), port)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
 		MaxIdleConnsPerHost:   1,
 		IdleConnTimeout:       100 * time.Millisecond,
 		TLSHandshakeTimeout:   3 * time.Second,